@@ -4,9 +4,12 @@ The main entry point and handling of discord events.
 package bot
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/camd67/moebot/moebot_bot/bot/commands"
 	"github.com/camd67/moebot/moebot_bot/bot/permissions"
@@ -45,15 +48,28 @@ func SetupMoebot(session *discordgo.Session, redditHandle *reddit.Handle) {
 	setupOperations(session, redditHandle)
 }
 
+/*
+Gives every operation a chance to finish up before moebot exits. Discord and the database are still connected at this point
+*/
+func ShutdownMoebot(session *discordgo.Session) {
+	for _, o := range operations {
+		if shutdown, ok := o.(commands.ShutdownHandler); ok {
+			shutdown.Shutdown(session)
+		}
+	}
+}
+
 /*
 Create all the operations to handle commands and events within moebot.
 Whenever a new operation, command, or event is added it should be added to this list
 */
 func setupOperations(session *discordgo.Session, redditHandle *reddit.Handle) {
 	operations = []interface{}{
-		&commands.RoleCommand{},
+		&commands.RoleCommand{CodeSigner: newRoleCodeSigner()},
 		&commands.RoleSetCommand{ComPrefix: ComPrefix},
 		&commands.GroupSetCommand{ComPrefix: ComPrefix},
+		&commands.RoleConfigCommand{ComPrefix: ComPrefix},
+		commands.NewBulkRoleCommand(ComPrefix),
 		&commands.HelpCommand{ComPrefix: ComPrefix, Commands: getCommands, Checker: checker}, //using a delegate here because it will remain accurate regardless of what gets added to operations
 		&commands.ChangelogCommand{Version: version},
 		&commands.RaffleCommand{MasterId: masterId, DebugChannel: masterDebugChannel},
@@ -65,10 +81,22 @@ func setupOperations(session *discordgo.Session, redditHandle *reddit.Handle) {
 		&commands.PollCommand{PollsHandler: commands.NewPollsHandler()},
 		&commands.MentionCommand{},
 		&commands.ServerCommand{ComPrefix: ComPrefix},
+		&commands.AccessCommand{ComPrefix: ComPrefix},
+		&commands.TierCommand{ComPrefix: ComPrefix},
+		&commands.PreviewCommand{ComPrefix: ComPrefix},
+		&commands.MemberHistoryCommand{},
+		&commands.VerifyCommand{ComPrefix: ComPrefix},
 		&commands.ProfileCommand{MasterId: masterId},
+		commands.NewLeaderboardCommand(masterId),
+		&commands.RankDecayCommand{ComPrefix: ComPrefix, MasterId: masterId},
+		&commands.RankCommand{ComPrefix: ComPrefix, MasterId: masterId, Checker: checker},
 		&commands.PinMoveCommand{ShouldLoadPins: Config["loadPins"] == "1"},
 		&commands.SubCommand{RedditHandle: redditHandle},
 		commands.NewVeteranHandler(ComPrefix, masterDebugChannel, masterId),
+		commands.NewRoleSyncHandler(),
+		&commands.MemberHandler{},
+		&commands.RuleAgreementHandler{ComPrefix: ComPrefix},
+		&commands.GuildLifecycleHandler{ComPrefix: ComPrefix},
 	}
 
 	setupCommands()
@@ -76,6 +104,27 @@ func setupOperations(session *discordgo.Session, redditHandle *reddit.Handle) {
 	setupEvents(session)
 }
 
+/*
+Creates the signer for role confirmation codes from the config. Without a configured secret codes won't survive a restart
+*/
+func newRoleCodeSigner() *commands.RoleCodeSigner {
+	signer := &commands.RoleCodeSigner{
+		Secret:         Config["roleCodeSecret"],
+		PreviousSecret: Config["roleCodePreviousSecret"],
+		Expiry:         commands.DefaultRoleCodeExpiry,
+	}
+	if signer.Secret == "" {
+		log.Println("!!! WARNING !!! No roleCodeSecret configured, generating a temporary one. Role confirmation codes will stop working on restart")
+		secretBytes := make([]byte, 32)
+		rand.Read(secretBytes)
+		signer.Secret = hex.EncodeToString(secretBytes)
+	}
+	if expiryMinutes, err := strconv.Atoi(Config["roleCodeExpiry"]); err == nil && expiryMinutes > 0 {
+		signer.Expiry = time.Duration(expiryMinutes) * time.Minute
+	}
+	return signer
+}
+
 func getCommands() []commands.Command {
 	result := []commands.Command{}
 	for _, o := range operations {
@@ -134,13 +183,17 @@ func addGlobalHandlers(discord *discordgo.Session) {
 Global handler for when new guild members join a discord guild. Typically used to welcome them if the server has enabled it.
 */
 func guildMemberAdd(session *discordgo.Session, member *discordgo.GuildMemberAdd) {
-	guild, err := moeDiscord.GetGuild(member.GuildID, session)
-	if err != nil {
-		session.ChannelMessageSend(masterDebugChannel, fmt.Sprint("Error fetching guild during guild member add", err, member))
+	if !db.AccessGuildAllowed(member.GuildID) {
 		return
 	}
-	server, err := db.ServerQueryOrInsert(guild.ID)
-	if !server.Enabled {
+	server, err := db.ServerQueryOrInsert(member.GuildID)
+	if err != nil || !server.Enabled {
+		return
+	}
+	guild, err := moeDiscord.GetGuild(member.GuildID, session)
+	if err != nil {
+		commands.Notify(session, server, db.NoticeFailure, "Sorry, I couldn't load this server's information when "+member.User.Mention()+
+			" joined, so they didn't get a welcome message or starter role.")
 		return
 	}
 	// only send out a welcome message is the server has one
@@ -157,7 +210,9 @@ func guildMemberAdd(session *discordgo.Session, member *discordgo.GuildMemberAdd
 			}
 			channelId = dmChannel.ID
 		}
-		session.ChannelMessageSend(channelId, server.WelcomeMessage.String)
+		if err = commands.SendWelcomeMessage(session, channelId, server, member.User, guild); err != nil {
+			log.Println("Error sending welcome message", err)
+		}
 	}
 	// then only assign a starter role if they have one set
 	if server.StarterRole.Valid {
@@ -169,19 +224,14 @@ func guildMemberAdd(session *discordgo.Session, member *discordgo.GuildMemberAdd
 			}
 		}
 		if starterRole == nil {
-			// couldn't find the starter role, try to let them know and then delete the starter role to prevent this error from appearing again
-			if server.BotChannel.Valid {
-				session.ChannelMessageSend(server.WelcomeChannel.String, "Hello, I couldn't find the starter role for this server! "+
-					"Please notify a server admin (Like "+util.UserIdToMention(guild.OwnerID)+") Starter role will be removed.")
-			} else if server.WelcomeChannel.Valid {
-				session.ChannelMessageSend(server.WelcomeChannel.String, "Hello, I couldn't find the starter role for this server! "+
-					"Please notify a server admin (Like "+util.UserIdToMention(guild.OwnerID)+") Starter role will be removed.")
-			}
+			// couldn't find the starter role, let them know and then delete the starter role to prevent this error from appearing again
+			commands.Notify(session, server, db.NoticeConfig, "I couldn't find the starter role for this server, so "+member.User.Mention()+
+				" didn't get it. The starter role will be removed from my settings, set a new one with `"+ComPrefix+" server StarterRole <role name>`.")
 			log.Println("ERROR! Unable to find starter role for guild " + guild.Name + ". Deleting starter role.")
 			server.StarterRole.Scan(nil)
-			db.ServerFullUpdate(server)
-		} else {
-			session.GuildMemberRoleAdd(member.GuildID, member.User.ID, starterRole.ID)
+			db.ServerFullUpdate(server, "", "starter role not found")
+		} else if err = commands.AddMemberRole(session, guild, member.User.ID, starterRole); err != nil {
+			commands.ReportRoleError(session, "", server, err)
 		}
 	}
 }
@@ -194,6 +244,9 @@ func messageCreate(session *discordgo.Session, message *discordgo.MessageCreate)
 	if message.Author.ID == session.State.User.ID || message.Author.Bot {
 		return
 	}
+	if db.AccessListContains(db.AccessListBlockUser, message.Author.ID) {
+		return
+	}
 
 	timer := event.StartNamedTimer("channel_start")
 	channel, err := moeDiscord.GetChannel(message.ChannelID, session)
@@ -203,6 +256,9 @@ func messageCreate(session *discordgo.Session, message *discordgo.MessageCreate)
 		return
 	}
 	timer.AddMark("end_channel")
+	if !db.AccessGuildAllowed(channel.GuildID) {
+		return
+	}
 
 	guild, err := moeDiscord.GetGuild(channel.GuildID, session)
 	if err != nil {
@@ -255,13 +311,16 @@ func messageCreate(session *discordgo.Session, message *discordgo.MessageCreate)
 
 	// Check if this user is a new user. This will determine what they can/can't do on the server.
 	// Masters and guild owners are never a new user
-	isNewUser := !isMaster && !isGuildOwner && server.RuleAgreement.Valid && starterRole != nil &&
+	isNewUser := !isMaster && !isGuildOwner && (server.RuleAgreement.Valid || server.RuleMessage.Valid || server.VerifyMode == db.VerifyModeCaptcha) &&
+		starterRole != nil &&
 		util.StrContains(member.Roles, starterRole.ID, util.CaseSensitive)
 
 	if strings.HasPrefix(strings.ToUpper(message.Content), strings.ToUpper(ComPrefix)) {
 		// todo: [rate-limit-spam] should add a check here for command spam
 
-		if isNewUser {
+		// new users can still ask for a new captcha, since that's how they stop being a new user
+		isVerify := server.VerifyMode == db.VerifyModeCaptcha && strings.HasPrefix(strings.ToUpper(message.Content), strings.ToUpper(ComPrefix+" verify"))
+		if isNewUser && !isVerify {
 			// if a starter role requested a command and the server has rule agreements, let them know they can't do that
 			session.ChannelMessageSend(channel.ID, "Sorry "+message.Author.Mention()+", but you have to agree to the rules first to use bot commands! "+
 				"Check the rules channel or ask an admin for more info.")
@@ -275,23 +334,26 @@ func messageCreate(session *discordgo.Session, message *discordgo.MessageCreate)
 	db.MetricInsertTimer(timer, userProfile)
 
 	// make sure to also check if they agreed to the rules
-	if isNewUser {
-		sanitizedMessage := util.MakeAlphaOnly(message.Content)
-		if strings.HasPrefix(strings.ToUpper(sanitizedMessage), strings.ToUpper(server.RuleAgreement.String)) {
+	if isNewUser && server.RuleAgreement.Valid && server.VerifyMode == db.VerifyModeRules {
+		if commands.MatchesRuleAgreement(message.Content, server.RuleAgreement.String) {
 			if baseRole == nil {
 				// Server only had a partial setup (rule agreement + starter role but no base role)
 				session.ChannelMessageSend(channel.ID, "Hey... this is awkward... It seems like this server's admins setup a rule agreement but no base role. "+
 					"Please notify a server admin (Like "+util.UserIdToMention(guild.OwnerID)+") Rule agreement will now be removed.")
+				commands.Notify(session, server, db.NoticeConfig, "Someone agreed to the rules, but there's no base role to give them. The rule "+
+					"agreement will be removed from my settings, set a base role with `"+ComPrefix+" server BaseRole <role name>` before adding it back.")
 				server.RuleAgreement.Scan(nil)
-				err = db.ServerFullUpdate(server)
+				err = db.ServerFullUpdate(server, "", "rule agreement removed, no base role")
 				if err != nil {
 					log.Println("Error updateing server", err)
 				}
 				return
 			}
-			session.ChannelMessageSend(message.ChannelID, "Welcome "+message.Author.Mention()+"! We hope you enjoy your stay in our Discord server!")
-			session.GuildMemberRoleAdd(guild.ID, member.User.ID, baseRole.ID)
-			session.GuildMemberRoleRemove(guild.ID, member.User.ID, starterRole.ID)
+			if err = commands.VerifyMember(session, guild, server, member.User.ID); err != nil {
+				commands.ReportRoleError(session, channel.ID, server, err)
+				return
+			}
+			session.ChannelMessageSend(message.ChannelID, commands.RenderRuleAgreementReply(server, message.Author, guild))
 			log.Println("Updated user <" + member.User.Username + "> after reading the rules")
 		}
 	}
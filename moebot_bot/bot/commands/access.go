@@ -0,0 +1,195 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+/*
+Master only management of the guild allowlist and the user and guild blocklists
+*/
+type AccessCommand struct {
+	ComPrefix string
+}
+
+func (ac *AccessCommand) Execute(pack *CommPackage) {
+	if len(pack.params) == 0 {
+		ac.printSummary(pack)
+		return
+	}
+	if strings.EqualFold(pack.params[0], "allowlist") {
+		ac.setAllowlistMode(pack)
+		return
+	}
+	listType := db.GetAccessListTypeFromString(pack.params[0])
+	if listType < 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a valid list. One of: "+db.OptionsForAccessListType)
+		return
+	}
+	if len(pack.params) == 1 {
+		ac.printList(pack, listType)
+		return
+	}
+	if len(pack.params) < 3 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide an ID. Example: `"+ac.ComPrefix+" access blockuser add <user ID> [reason]`")
+		return
+	}
+	uid := pack.params[2]
+	if listType == db.AccessListBlockUser {
+		// let users be given as mentions too
+		uid = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(uid, "<@"), "!"), ">")
+	}
+	if _, err := strconv.ParseUint(uid, 10, 64); err != nil || len(uid) > db.DbMaxUidLength {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a valid ID")
+		return
+	}
+	listName := db.GetStringFromAccessListType(listType)
+	switch strings.ToUpper(pack.params[1]) {
+	case "ADD":
+		if listType == db.AccessListBlockUser && uid == pack.message.Author.ID {
+			pack.session.ChannelMessageSend(pack.channel.ID, "You can't block yourself!")
+			return
+		}
+		reason := strings.Join(pack.params[3:], " ")
+		if len(reason) > db.AccessListMaxReasonLength {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, the reason has a max length of: "+db.AccessListMaxReasonLengthString)
+			return
+		}
+		if db.AccessListInsert(listType, uid, reason, pack.message.Author.ID) != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error updating the list. This is an issue with moebot not discord.")
+			return
+		}
+		pack.session.ChannelMessageSend(pack.channel.ID, "Added `"+uid+"` to "+listName+".")
+	case "REMOVE":
+		removed, err := db.AccessListDelete(listType, uid)
+		if err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error updating the list. This is an issue with moebot not discord.")
+			return
+		} else if !removed {
+			pack.session.ChannelMessageSend(pack.channel.ID, "`"+uid+"` isn't on "+listName+".")
+			return
+		}
+		pack.session.ChannelMessageSend(pack.channel.ID, "Removed `"+uid+"` from "+listName+".")
+	default:
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please use `add` or `remove`.")
+		return
+	}
+	if listType == db.AccessListBlockGuild || listType == db.AccessListAllowGuild {
+		ac.leaveDisallowedGuilds(pack)
+	}
+}
+
+func (ac *AccessCommand) printSummary(pack *CommPackage) {
+	mode := "off"
+	if db.AccessAllowlistMode() {
+		mode = "on"
+	}
+	var lines []string
+	for _, listType := range []db.AccessListType{db.AccessListAllowGuild, db.AccessListBlockGuild, db.AccessListBlockUser, db.AccessListRaffleGuild} {
+		entries, err := db.AccessListQueryType(listType)
+		if err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading the lists. This is an issue with moebot not discord.")
+			return
+		}
+		lines = append(lines, db.GetStringFromAccessListType(listType)+": "+strconv.Itoa(len(entries))+" entries")
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("The guild allowlist is "+mode+".", lines))
+}
+
+func (ac *AccessCommand) printList(pack *CommPackage, listType db.AccessListType) {
+	entries, err := db.AccessListQueryType(listType)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading the list. This is an issue with moebot not discord.")
+		return
+	}
+	listName := db.GetStringFromAccessListType(listType)
+	if len(entries) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, listName+" is empty.")
+		return
+	}
+	var lines []string
+	for _, e := range entries {
+		actor := "moebot"
+		if e.ActorUid != "" {
+			actor = util.UserIdToMention(e.ActorUid)
+		}
+		lines = append(lines, "`"+e.Uid+"` added by "+actor+" on "+e.CreatedAt.UTC().Format("2006-01-02")+": "+
+			util.GetStringOrDefault(e.Reason))
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines(listName+":", lines))
+}
+
+/*
+Turns the allowlist on or off. Turning it on leaves every guild not on the allowlist, so it needs confirming
+*/
+func (ac *AccessCommand) setAllowlistMode(pack *CommPackage) {
+	if len(pack.params) < 2 || (!strings.EqualFold(pack.params[1], "on") && !strings.EqualFold(pack.params[1], "off")) {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide `on` or `off`.")
+		return
+	}
+	on := strings.EqualFold(pack.params[1], "on")
+	confirmed := len(pack.params) > 2 && strings.EqualFold(pack.params[2], "-confirm")
+	if on && !confirmed {
+		allowed := make(map[string]bool)
+		entries, err := db.AccessListQueryType(db.AccessListAllowGuild)
+		if err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading the allowlist. This is an issue with moebot not discord.")
+			return
+		}
+		for _, e := range entries {
+			allowed[e.Uid] = true
+		}
+		var toLeave []string
+		pack.session.State.RLock()
+		for _, guild := range pack.session.State.Guilds {
+			if !allowed[guild.ID] {
+				toLeave = append(toLeave, "`"+guild.ID+"` "+guild.Name)
+			}
+		}
+		pack.session.State.RUnlock()
+		pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("Turning on the allowlist will leave "+strconv.Itoa(len(toLeave))+
+			" guilds. Use `"+ac.ComPrefix+" access allowlist on -confirm` to turn it on.", toLeave))
+		return
+	}
+	if db.AccessSetAllowlistMode(on) != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error updating the allowlist. This is an issue with moebot not discord.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, "The guild allowlist is now "+strings.ToLower(pack.params[1])+".")
+	if on {
+		ac.leaveDisallowedGuilds(pack)
+	}
+}
+
+func (ac *AccessCommand) leaveDisallowedGuilds(pack *CommPackage) {
+	guilds := disallowedGuilds(pack.session)
+	if len(guilds) == 0 {
+		return
+	}
+	var names []string
+	for _, guild := range guilds {
+		names = append(names, "`"+guild.ID+"` "+guild.Name)
+	}
+	// the reply has to go out first, since we might be leaving the guild this was sent in
+	pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("Leaving "+strconv.Itoa(len(guilds))+" guilds:", names))
+	for _, guild := range guilds {
+		leaveGuild(pack.session, guild)
+	}
+}
+
+func (ac *AccessCommand) GetPermLevel() db.Permission {
+	return db.PermMaster
+}
+
+func (ac *AccessCommand) GetCommandKeys() []string {
+	return []string{"ACCESS"}
+}
+
+func (ac *AccessCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s access [<list> [add|remove <ID> [reason]]]` - Master only. Shows or edits a global list, one of: %[2]s. "+
+		"`%[1]s access allowlist on|off` turns the guild allowlist on or off.", commPrefix, db.OptionsForAccessListType)
+}
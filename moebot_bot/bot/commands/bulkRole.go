@@ -0,0 +1,336 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const (
+	// time to wait between each member update so we stay well under discord's rate limits
+	bulkRoleRateLimit = 500 * time.Millisecond
+	// how often to update the progress message
+	bulkRoleProgressInterval = 15 * time.Second
+	bulkRoleDateFormat       = "2006-01-02"
+)
+
+type BulkRoleCommand struct {
+	ComPrefix string
+	jobs      struct {
+		sync.Mutex
+		m map[string]*bulkRoleJob
+	}
+}
+
+/*
+A running bulk role update for a single guild. Only one can run per guild at a time
+*/
+type bulkRoleJob struct {
+	sync.Mutex
+	cancelled bool
+	total     int
+	done      int
+	failed    int
+}
+
+/*
+Which members a bulk role update applies to. Members must match every filter that's set
+*/
+type bulkRoleFilter struct {
+	all          bool
+	hasRole      *discordgo.Role
+	joinedBefore time.Time
+	joinedAfter  time.Time
+	minRank      int
+	ranks        map[string]int
+}
+
+func NewBulkRoleCommand(comPrefix string) *BulkRoleCommand {
+	result := &BulkRoleCommand{ComPrefix: comPrefix}
+	result.jobs.m = make(map[string]*bulkRoleJob)
+	return result
+}
+
+func (bc *BulkRoleCommand) Execute(pack *CommPackage) {
+	args := ParseCommand(pack.params, []string{"-all", "-has", "-joinedbefore", "-joinedafter", "-minrank", "-add", "-remove", "-confirm", "-cancel",
+		"-status"})
+	if _, hasCancel := args["-cancel"]; hasCancel {
+		bc.cancelJob(pack)
+		return
+	}
+	if _, hasStatus := args["-status"]; hasStatus {
+		bc.printStatus(pack)
+		return
+	}
+
+	filter, ok := bc.parseFilter(pack, args)
+	if !ok {
+		return
+	}
+	addName, hasAdd := args["-add"]
+	removeName, hasRemove := args["-remove"]
+	if !hasAdd && !hasRemove {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a role to `-add`, `-remove`, or both to swap roles.")
+		return
+	}
+	var addRole, removeRole *discordgo.Role
+	if hasAdd {
+		addRole = moeDiscord.FindRoleByName(pack.guild.Roles, addName)
+		if addRole == nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I couldn't find the role `"+addName+"`. Make sure it's the full role name.")
+			return
+		}
+	}
+	if hasRemove {
+		removeRole = moeDiscord.FindRoleByName(pack.guild.Roles, removeName)
+		if removeRole == nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I couldn't find the role `"+removeName+"`. Make sure it's the full role name.")
+			return
+		}
+	}
+	for _, role := range []*discordgo.Role{addRole, removeRole} {
+		if role == nil {
+			continue
+		}
+		if err := CheckRoleManageable(pack.session, pack.guild, role); err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+err.Error())
+			return
+		}
+	}
+
+	members, err := moeDiscord.GetAllMembers(pack.guild.ID, pack.session)
+	if err != nil {
+		log.Println("Error loading members for bulk role update", err)
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue loading the members of this server. Please try again later.")
+		return
+	}
+	var targets []*discordgo.Member
+	for _, member := range members {
+		if member.User.Bot || !filter.matches(member) {
+			continue
+		}
+		needsAdd := addRole != nil && !util.StrContains(member.Roles, addRole.ID, util.CaseSensitive)
+		needsRemove := removeRole != nil && util.StrContains(member.Roles, removeRole.ID, util.CaseSensitive)
+		if needsAdd || needsRemove {
+			targets = append(targets, member)
+		}
+	}
+
+	action := describeBulkRoleAction(addRole, removeRole)
+	if len(targets) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "No members match that selection, so there's nothing to "+action+".")
+		return
+	}
+	estimate := time.Duration(len(targets)) * bulkRoleRateLimit
+	if _, hasConfirm := args["-confirm"]; !hasConfirm {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Dry run: this would "+action+" for "+strconv.Itoa(len(targets))+" member(s), taking about "+
+			estimate.Round(time.Second).String()+". Run the same command with `-confirm` to start.")
+		return
+	}
+
+	job := &bulkRoleJob{total: len(targets)}
+	bc.jobs.Lock()
+	if _, running := bc.jobs.m[pack.guild.ID]; running {
+		bc.jobs.Unlock()
+		pack.session.ChannelMessageSend(pack.channel.ID, "There's already a bulk role update running in this server. Use `"+bc.ComPrefix+
+			" bulkrole -status` to check on it or `-cancel` to stop it.")
+		return
+	}
+	bc.jobs.m[pack.guild.ID] = job
+	bc.jobs.Unlock()
+
+	progress, err := pack.session.ChannelMessageSend(pack.channel.ID, "Starting to "+action+" for "+strconv.Itoa(len(targets))+" member(s)...")
+	if err != nil {
+		log.Println("Error sending bulk role progress message", err)
+	}
+	go bc.runJob(pack.session, pack.guild, pack.channel.ID, progress, job, targets, addRole, removeRole, action)
+}
+
+func (bc *BulkRoleCommand) parseFilter(pack *CommPackage, args map[string]string) (filter bulkRoleFilter, ok bool) {
+	_, filter.all = args["-all"]
+	filter.minRank = -1
+	if hasName, present := args["-has"]; present {
+		filter.hasRole = moeDiscord.FindRoleByName(pack.guild.Roles, hasName)
+		if filter.hasRole == nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I couldn't find the role `"+hasName+"`. Make sure it's the full role name.")
+			return
+		}
+	}
+	var err error
+	if before, present := args["-joinedbefore"]; present {
+		if filter.joinedBefore, err = time.Parse(bulkRoleDateFormat, before); err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide join dates in the format YYYY-MM-DD")
+			return
+		}
+	}
+	if after, present := args["-joinedafter"]; present {
+		if filter.joinedAfter, err = time.Parse(bulkRoleDateFormat, after); err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide join dates in the format YYYY-MM-DD")
+			return
+		}
+	}
+	if minRank, present := args["-minrank"]; present {
+		filter.minRank, err = strconv.Atoi(minRank)
+		if err != nil || filter.minRank < 0 {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a positive number for the minimum rank")
+			return
+		}
+		filter.ranks, err = db.UserServerRankQueryServer(pack.guild.ID)
+		if err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue loading ranks for this server. This is an issue with moebot not discord.")
+			return
+		}
+	}
+	if !filter.all && filter.hasRole == nil && filter.joinedBefore.IsZero() && filter.joinedAfter.IsZero() && filter.minRank < 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please select members with at least one of `-has`, `-joinedbefore`, `-joinedafter`, "+
+			"`-minrank`, or use `-all` to select everyone.")
+		return
+	}
+	return filter, true
+}
+
+func (f *bulkRoleFilter) matches(member *discordgo.Member) bool {
+	if f.hasRole != nil && !util.StrContains(member.Roles, f.hasRole.ID, util.CaseSensitive) {
+		return false
+	}
+	if !f.joinedBefore.IsZero() || !f.joinedAfter.IsZero() {
+		joined, err := time.Parse(time.RFC3339Nano, member.JoinedAt)
+		if err != nil {
+			return false
+		}
+		if !f.joinedBefore.IsZero() && !joined.Before(f.joinedBefore) {
+			return false
+		}
+		if !f.joinedAfter.IsZero() && joined.Before(f.joinedAfter) {
+			return false
+		}
+	}
+	if f.minRank >= 0 && f.ranks[member.User.ID] < f.minRank {
+		return false
+	}
+	return true
+}
+
+func (bc *BulkRoleCommand) runJob(session *discordgo.Session, guild *discordgo.Guild, channelUid string, progress *discordgo.Message, job *bulkRoleJob,
+	targets []*discordgo.Member, addRole *discordgo.Role, removeRole *discordgo.Role, action string) {
+
+	defer func() {
+		bc.jobs.Lock()
+		delete(bc.jobs.m, guild.ID)
+		bc.jobs.Unlock()
+	}()
+	lastProgress := time.Now()
+	cancelled := false
+	var lastErr error
+	for _, member := range targets {
+		job.Lock()
+		cancelled = job.cancelled
+		job.Unlock()
+		if cancelled {
+			break
+		}
+		var err error
+		if addRole != nil && !util.StrContains(member.Roles, addRole.ID, util.CaseSensitive) {
+			err = AddMemberRole(session, guild, member.User.ID, addRole)
+		}
+		if err == nil && removeRole != nil && util.StrContains(member.Roles, removeRole.ID, util.CaseSensitive) {
+			err = RemoveMemberRole(session, guild, member.User.ID, removeRole)
+		}
+		job.Lock()
+		job.done++
+		if err != nil {
+			log.Println("Error updating roles for member "+member.User.ID+" during bulk role update", err)
+			job.failed++
+			lastErr = err
+		}
+		job.Unlock()
+
+		if progress != nil && time.Since(lastProgress) > bulkRoleProgressInterval {
+			session.ChannelMessageEdit(channelUid, progress.ID, "Working on it: "+job.describe())
+			lastProgress = time.Now()
+		}
+		time.Sleep(bulkRoleRateLimit)
+	}
+
+	var message string
+	if cancelled {
+		message = "Cancelled the bulk role update to " + action + ". " + job.describe()
+	} else {
+		message = "Finished the bulk role update to " + action + "! " + job.describe()
+	}
+	if lastErr != nil {
+		message += " The last failure was: " + lastErr.Error()
+	}
+	if progress != nil {
+		session.ChannelMessageEdit(channelUid, progress.ID, message)
+	}
+	session.ChannelMessageSend(channelUid, message)
+}
+
+func (bc *BulkRoleCommand) cancelJob(pack *CommPackage) {
+	bc.jobs.Lock()
+	job, running := bc.jobs.m[pack.guild.ID]
+	bc.jobs.Unlock()
+	if !running {
+		pack.session.ChannelMessageSend(pack.channel.ID, "There isn't a bulk role update running in this server.")
+		return
+	}
+	job.Lock()
+	job.cancelled = true
+	job.Unlock()
+	pack.session.ChannelMessageSend(pack.channel.ID, "Cancelling the bulk role update...")
+}
+
+func (bc *BulkRoleCommand) printStatus(pack *CommPackage) {
+	bc.jobs.Lock()
+	job, running := bc.jobs.m[pack.guild.ID]
+	bc.jobs.Unlock()
+	if !running {
+		pack.session.ChannelMessageSend(pack.channel.ID, "There isn't a bulk role update running in this server.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, "Bulk role update in progress: "+job.describe())
+}
+
+func (job *bulkRoleJob) describe() string {
+	job.Lock()
+	defer job.Unlock()
+	description := strconv.Itoa(job.done) + "/" + strconv.Itoa(job.total) + " members processed"
+	if job.failed > 0 {
+		description += ", " + strconv.Itoa(job.failed) + " failed"
+	}
+	return description + "."
+}
+
+func describeBulkRoleAction(addRole *discordgo.Role, removeRole *discordgo.Role) string {
+	var parts []string
+	if addRole != nil {
+		parts = append(parts, "add `"+addRole.Name+"`")
+	}
+	if removeRole != nil {
+		parts = append(parts, "remove `"+removeRole.Name+"`")
+	}
+	return strings.Join(parts, " and ")
+}
+
+func (bc *BulkRoleCommand) GetPermLevel() db.Permission {
+	return db.PermMod
+}
+
+func (bc *BulkRoleCommand) GetCommandKeys() []string {
+	return []string{"BULKROLE"}
+}
+
+func (bc *BulkRoleCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s bulkrole [-all] [-has <role name>] [-joinedbefore <YYYY-MM-DD>] [-joinedafter <YYYY-MM-DD>] [-minrank <points>] "+
+		"[-add <role name>] [-remove <role name>] [-confirm]` - Master/Mod. Adds, removes or swaps roles for every matching member. Runs as a dry run "+
+		"unless `-confirm` is given. `%[1]s bulkrole -status` or `-cancel` to manage a running update.", commPrefix)
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestBulkRole_FilterMatches(t *testing.T) {
+	member := &discordgo.Member{
+		User:     &discordgo.User{ID: "1"},
+		Roles:    []string{"10", "11"},
+		JoinedAt: "2018-03-15T12:00:00.000000+00:00",
+	}
+	date := func(s string) time.Time {
+		d, _ := time.Parse(bulkRoleDateFormat, s)
+		return d
+	}
+	checks := []struct {
+		filter bulkRoleFilter
+		out    bool
+	}{
+		{bulkRoleFilter{all: true, minRank: -1}, true},
+		{bulkRoleFilter{hasRole: &discordgo.Role{ID: "11"}, minRank: -1}, true},
+		{bulkRoleFilter{hasRole: &discordgo.Role{ID: "12"}, minRank: -1}, false},
+		{bulkRoleFilter{joinedBefore: date("2018-04-01"), minRank: -1}, true},
+		{bulkRoleFilter{joinedBefore: date("2018-03-01"), minRank: -1}, false},
+		{bulkRoleFilter{joinedAfter: date("2018-03-01"), minRank: -1}, true},
+		{bulkRoleFilter{joinedAfter: date("2018-03-16"), minRank: -1}, false},
+		{bulkRoleFilter{minRank: 100, ranks: map[string]int{"1": 150}}, true},
+		{bulkRoleFilter{minRank: 100, ranks: map[string]int{"1": 50}}, false},
+		{bulkRoleFilter{minRank: 100, ranks: map[string]int{}}, false},
+		{bulkRoleFilter{hasRole: &discordgo.Role{ID: "10"}, joinedAfter: date("2018-03-16"), minRank: -1}, false},
+	}
+	for i, c := range checks {
+		if res := c.filter.matches(member); res != c.out {
+			t.Errorf("Incorrect match for check %d. Got: %v, expected: %v", i, res, c.out)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+const (
+	// How long moebot keeps a server's data after being removed, in case it gets invited back
+	serverPurgeGracePeriod = 30 * 24 * time.Hour
+	serverPurgeInterval    = time.Hour
+	// a guild moebot joined longer ago than this was already there, it just didn't have a server row yet
+	guildJoinWindow = 10 * time.Minute
+)
+
+/*
+Handles moebot being added to and removed from guilds. Servers moebot was removed from are purged after a grace period, unless moebot is
+invited back first
+*/
+type GuildLifecycleHandler struct {
+	ComPrefix string
+}
+
+func (gh *GuildLifecycleHandler) Setup(session *discordgo.Session) {
+	go gh.purgeServers()
+}
+
+func (gh *GuildLifecycleHandler) EventHandlers() []interface{} {
+	return []interface{}{gh.ready, gh.guildCreate, gh.guildDelete}
+}
+
+/*
+Catches any guilds moebot was removed from while it was offline
+*/
+func (gh *GuildLifecycleHandler) ready(session *discordgo.Session, ready *discordgo.Ready) {
+	active, err := db.ServerQueryActiveGuilds()
+	if err != nil {
+		return
+	}
+	present := make(map[string]bool)
+	for _, guild := range ready.Guilds {
+		present[guild.ID] = true
+	}
+	for _, guildUid := range active {
+		if !present[guildUid] {
+			log.Println("Moebot was removed from guild " + guildUid + " while offline, marking it as left")
+			db.ServerSetLeft(guildUid, true)
+		}
+	}
+}
+
+/*
+Called for every guild when moebot connects, as well as when it's added to a new one
+*/
+func (gh *GuildLifecycleHandler) guildCreate(session *discordgo.Session, guild *discordgo.GuildCreate) {
+	if guild.Unavailable {
+		return
+	}
+	if !db.AccessGuildAllowed(guild.ID) {
+		leaveGuild(session, guild.Guild)
+		return
+	}
+	leftAt, err := db.ServerQueryLeftAt(guild.ID)
+	if err == sql.ErrNoRows {
+		if _, err = db.ServerQueryOrInsert(guild.ID); err != nil {
+			return
+		}
+		if !guildJustJoined(guild.JoinedAt, time.Now()) {
+			// servers used to only be stored once someone talked, so guilds moebot has been in for a while don't get onboarded again
+			return
+		}
+		log.Println("Moebot was added to guild " + guild.ID + " (" + guild.Name + ")")
+		sendToGuild(session, guild.Guild, gh.onboardingMessage())
+		return
+	} else if err != nil || !leftAt.Valid {
+		// either an error, or we were already in this guild and just reconnected
+		return
+	}
+	if db.ServerSetLeft(guild.ID, false) != nil {
+		return
+	}
+	log.Println("Moebot was invited back to guild " + guild.ID + " (" + guild.Name + "), restored its data")
+	sendToGuild(session, guild.Guild, "Thanks for inviting me back! I've restored this server's previous settings. Use `"+gh.ComPrefix+
+		" server doctor` to check they still work.")
+}
+
+/*
+Checks if moebot joined a guild just now, rather than connecting to a guild it was already in. Guilds with no join time count as old
+*/
+func guildJustJoined(joinedAt discordgo.Timestamp, now time.Time) bool {
+	joined, err := joinedAt.Parse()
+	return err == nil && now.Sub(joined) < guildJoinWindow
+}
+
+func (gh *GuildLifecycleHandler) guildDelete(session *discordgo.Session, guild *discordgo.GuildDelete) {
+	if guild.Unavailable {
+		// discord is having an outage, we weren't actually removed
+		return
+	}
+	if db.ServerSetLeft(guild.ID, true) == nil {
+		log.Println("Moebot was removed from guild " + guild.ID + ", its data will be purged in " + serverPurgeGracePeriod.String())
+	}
+}
+
+func (gh *GuildLifecycleHandler) purgeServers() {
+	for {
+		servers, err := db.ServerQueryPurgeable(time.Now().Add(-serverPurgeGracePeriod))
+		if err == nil {
+			purged := 0
+			for _, server := range servers {
+				if db.ServerPurge(server) == nil {
+					purged++
+				}
+			}
+			if purged > 0 {
+				log.Println("Purged data for " + strconv.Itoa(purged) + " servers moebot was removed from")
+			}
+		}
+		time.Sleep(serverPurgeInterval)
+	}
+}
+
+func (gh *GuildLifecycleHandler) onboardingMessage() string {
+	return fmt.Sprintf("Hi, thanks for adding moebot! Here's how to get started:\n"+
+		"1. Make sure my role is above any role you want me to give out, and that it has Manage Roles.\n"+
+		"2. `%[1]s server BotChannel <channel ID>` so I can tell you when something goes wrong.\n"+
+		"3. `%[1]s permit <role name> -permission mod` to let your mods configure me.\n"+
+		"4. `%[1]s server WelcomeMessage <message>` and `%[1]s server WelcomeChannel <channel ID>` to greet new members.\n"+
+		"5. `%[1]s server StarterRole <role name>`, `%[1]s server BaseRole <role name>` and `%[1]s server RuleAgreement <message>` to "+
+		"have new members agree to the rules.\n"+
+		"Then use `%[1]s server doctor` to check everything's set up right, and `%[1]s help` to see everything else I can do.", gh.ComPrefix)
+}
+
+/*
+Sends a message to the first text channel moebot can talk in, or the guild owner if there isn't one
+*/
+func sendToGuild(session *discordgo.Session, guild *discordgo.Guild, message string) {
+	channels := make([]*discordgo.Channel, len(guild.Channels))
+	copy(channels, guild.Channels)
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Position < channels[j].Position
+	})
+	for _, c := range channels {
+		if c.Type != discordgo.ChannelTypeGuildText {
+			continue
+		}
+		permissions, err := session.State.UserChannelPermissions(session.State.User.ID, c.ID)
+		if err != nil || permissions&(discordgo.PermissionReadMessages|discordgo.PermissionSendMessages) !=
+			discordgo.PermissionReadMessages|discordgo.PermissionSendMessages {
+			continue
+		}
+		if _, err = session.ChannelMessageSend(c.ID, message); err == nil {
+			return
+		}
+	}
+	dmChannel, err := session.UserChannelCreate(guild.OwnerID)
+	if err != nil {
+		log.Println("Couldn't find anywhere to send a message for guild "+guild.ID, err)
+		return
+	}
+	session.ChannelMessageSend(dmChannel.ID, "(From "+guild.Name+") "+message)
+}
+
+/*
+Tells a guild moebot isn't available there and leaves it
+*/
+func leaveGuild(session *discordgo.Session, guild *discordgo.Guild) {
+	log.Println("Leaving guild " + guild.ID + " (" + guild.Name + "), it's blocked or not on the allowlist")
+	sendToGuild(session, guild, "Sorry, moebot isn't available in this server. Goodbye!")
+	if err := session.GuildLeave(guild.ID); err != nil {
+		log.Println("Error leaving guild "+guild.ID, err)
+	}
+}
+
+/*
+Finds every guild moebot is in that it shouldn't be, based on the blocklist and allowlist
+*/
+func disallowedGuilds(session *discordgo.Session) (guilds []*discordgo.Guild) {
+	session.State.RLock()
+	all := make([]*discordgo.Guild, len(session.State.Guilds))
+	copy(all, session.State.Guilds)
+	session.State.RUnlock()
+	for _, guild := range all {
+		if !db.AccessGuildAllowed(guild.ID) {
+			guilds = append(guilds, guild)
+		}
+	}
+	return
+}
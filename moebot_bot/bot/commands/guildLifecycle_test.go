@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestGuildLifecycle_GuildJustJoined(t *testing.T) {
+	now := time.Date(2018, 5, 4, 12, 0, 0, 0, time.UTC)
+	checks := []struct {
+		joinedAt discordgo.Timestamp
+		out      bool
+	}{
+		{"2018-05-04T11:59:30.123000+00:00", true},
+		{"2018-05-04T11:45:00+00:00", false},
+		{"2017-01-01T00:00:00+00:00", false},
+		{"", false},
+		{"yesterday", false},
+	}
+	for _, c := range checks {
+		if res := guildJustJoined(c.joinedAt, now); res != c.out {
+			t.Errorf("Incorrect join check for %q. Got: %t, expected: %t", c.joinedAt, res, c.out)
+		}
+	}
+}
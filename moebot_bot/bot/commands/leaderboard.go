@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+const (
+	leaderboardPageSize = 10
+	// only this many members are ever loaded, anyone further down just doesn't show up
+	leaderboardMaxEntries = 500
+	// how long a leaderboard is reused before it's loaded again
+	leaderboardCacheDuration = 5 * time.Minute
+)
+
+type leaderboardCacheEntry struct {
+	entries []db.LeaderboardEntry
+	loaded  time.Time
+}
+
+/*
+Shows who has the most points in a server, over all time or recently
+*/
+type LeaderboardCommand struct {
+	MasterId string
+	cache    struct {
+		sync.Mutex
+		m map[string]leaderboardCacheEntry
+	}
+}
+
+func NewLeaderboardCommand(masterId string) *LeaderboardCommand {
+	lc := &LeaderboardCommand{MasterId: masterId}
+	lc.cache.m = make(map[string]leaderboardCacheEntry)
+	return lc
+}
+
+func (lc *LeaderboardCommand) Execute(pack *CommPackage) {
+	window := db.LeaderboardAllTime
+	page := 1
+	for _, param := range pack.params {
+		if p, err := strconv.Atoi(param); err == nil && p > 0 {
+			page = p
+		} else if w := db.GetLeaderboardWindowFromString(param); w >= 0 {
+			window = w
+		} else {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I don't know what `"+param+"` means. Please provide a page number or one of: "+
+				db.OptionsForLeaderboardWindow)
+			return
+		}
+	}
+	server, err := db.ServerQueryOrInsert(pack.guild.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading server information. This is an issue with moebot not discord.")
+		return
+	}
+	entries, err := lc.loadLeaderboard(server, window)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading the leaderboard. This is an issue with moebot not discord.")
+		return
+	}
+	if len(entries) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Nobody has earned any points "+db.GetStringFromLeaderboardWindow(window)+" yet!")
+		return
+	}
+	pageEntries, pageCount := leaderboardPage(entries, page, leaderboardPageSize)
+	if page > pageCount {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, the leaderboard only has "+strconv.Itoa(pageCount)+" pages.")
+		return
+	}
+	var lines []string
+	for i, e := range pageEntries {
+		lines = append(lines, "`#"+strconv.Itoa((page-1)*leaderboardPageSize+i+1)+"` "+rankListName(e.UserUid)+" - "+
+			strconv.Itoa(e.Points)+" points")
+	}
+	footer := "Page " + strconv.Itoa(page) + "/" + strconv.Itoa(pageCount)
+	for i, e := range entries {
+		if e.UserUid == pack.message.Author.ID {
+			footer += ". You're #" + strconv.Itoa(i+1) + " with " + strconv.Itoa(e.Points) + " points"
+			break
+		}
+	}
+	pack.session.ChannelMessageSendEmbed(pack.channel.ID, &discordgo.MessageEmbed{
+		Title:       pack.guild.Name + " leaderboard, " + db.GetStringFromLeaderboardWindow(window),
+		Description: strings.Join(lines, "\n"),
+		Footer:      &discordgo.MessageEmbedFooter{Text: footer},
+	})
+}
+
+/*
+Gets a server's leaderboard, reusing the last one loaded if it's recent enough
+*/
+func (lc *LeaderboardCommand) loadLeaderboard(server db.Server, window db.LeaderboardWindow) ([]db.LeaderboardEntry, error) {
+	key := server.GuildUid + ":" + strconv.Itoa(int(window))
+	now := time.Now()
+	lc.cache.Lock()
+	cached, ok := lc.cache.m[key]
+	lc.cache.Unlock()
+	if ok && now.Sub(cached.loaded) < leaderboardCacheDuration {
+		return cached.entries, nil
+	}
+	loaded, err := db.LeaderboardQuery(server.Id, leaderboardWindowStart(window, now), leaderboardMaxEntries)
+	if err != nil {
+		return nil, err
+	}
+	var entries []db.LeaderboardEntry
+	for _, e := range loaded {
+		if !rankExcludesUser(e.UserUid, lc.MasterId) {
+			entries = append(entries, e)
+		}
+	}
+	lc.cache.Lock()
+	defer lc.cache.Unlock()
+	for k, e := range lc.cache.m {
+		if now.Sub(e.loaded) >= leaderboardCacheDuration {
+			delete(lc.cache.m, k)
+		}
+	}
+	lc.cache.m[key] = leaderboardCacheEntry{entries: entries, loaded: now}
+	return entries, nil
+}
+
+/*
+Gets when a leaderboard window started, in UTC. Weeks start on Monday. All time has no start, so it's the zero time
+*/
+func leaderboardWindowStart(window db.LeaderboardWindow, now time.Time) time.Time {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch window {
+	case db.LeaderboardMonth:
+		return today.AddDate(0, 0, 1-now.Day())
+	case db.LeaderboardWeek:
+		// Sunday is 0, so shift everything back a day to make Monday the start
+		return today.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+	default:
+		return time.Time{}
+	}
+}
+
+/*
+Gets one page of a leaderboard, along with how many pages there are. Pages start at 1
+*/
+func leaderboardPage(entries []db.LeaderboardEntry, page int, pageSize int) (pageEntries []db.LeaderboardEntry, pageCount int) {
+	pageCount = (len(entries) + pageSize - 1) / pageSize
+	if page < 1 || page > pageCount {
+		return nil, pageCount
+	}
+	end := page * pageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	return entries[(page-1)*pageSize : end], pageCount
+}
+
+func (lc *LeaderboardCommand) GetPermLevel() db.Permission {
+	return db.PermAll
+}
+
+func (lc *LeaderboardCommand) GetCommandKeys() []string {
+	return []string{"LEADERBOARD"}
+}
+
+func (lc *LeaderboardCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s leaderboard [%[2]s] [page]` - Shows who has the most points in this server, over all time or just this month or week.",
+		commPrefix, strings.Replace(db.OptionsForLeaderboardWindow, ", ", "|", -1))
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+func TestLeaderboard_WindowStart(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2018, time.May, 16, 15, 30, 0, 0, time.UTC)
+	checks := []struct {
+		window db.LeaderboardWindow
+		now    time.Time
+		out    time.Time
+	}{
+		{db.LeaderboardAllTime, now, time.Time{}},
+		{db.LeaderboardMonth, now, time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC)},
+		{db.LeaderboardWeek, now, time.Date(2018, time.May, 14, 0, 0, 0, 0, time.UTC)},
+		// Sunday still belongs to the week that started on Monday
+		{db.LeaderboardWeek, time.Date(2018, time.May, 20, 23, 0, 0, 0, time.UTC), time.Date(2018, time.May, 14, 0, 0, 0, 0, time.UTC)},
+		{db.LeaderboardWeek, time.Date(2018, time.May, 14, 0, 0, 0, 0, time.UTC), time.Date(2018, time.May, 14, 0, 0, 0, 0, time.UTC)},
+		{db.LeaderboardMonth, time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range checks {
+		if res := leaderboardWindowStart(c.window, c.now); !res.Equal(c.out) {
+			t.Errorf("Incorrect start for window %d at %v. Got: %v, expected: %v", c.window, c.now, res, c.out)
+		}
+	}
+}
+
+func TestLeaderboard_Page(t *testing.T) {
+	entries := make([]db.LeaderboardEntry, 25)
+	checks := []struct {
+		entries   []db.LeaderboardEntry
+		page      int
+		length    int
+		pageCount int
+	}{
+		{entries, 1, 10, 3},
+		{entries, 3, 5, 3},
+		{entries, 4, 0, 3},
+		{entries, 0, 0, 3},
+		{entries[:10], 1, 10, 1},
+		{nil, 1, 0, 0},
+	}
+	for _, c := range checks {
+		res, pageCount := leaderboardPage(c.entries, c.page, 10)
+		if len(res) != c.length || pageCount != c.pageCount {
+			t.Errorf("Incorrect page %d of %d entries. Got: %d entries and %d pages, expected: %d entries and %d pages", c.page, len(c.entries),
+				len(res), pageCount, c.length, c.pageCount)
+		}
+	}
+}
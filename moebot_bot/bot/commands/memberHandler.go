@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const leaverPurgeInterval = time.Hour
+
+/*
+Records members joining and leaving, sends goodbye messages and applies each server's policy for leaver data
+*/
+type MemberHandler struct {
+}
+
+func (mh *MemberHandler) Setup(session *discordgo.Session) {
+	go mh.purgeLeavers()
+}
+
+func (mh *MemberHandler) EventHandlers() []interface{} {
+	return []interface{}{mh.memberAdd, mh.memberRemove}
+}
+
+func (mh *MemberHandler) memberAdd(session *discordgo.Session, member *discordgo.GuildMemberAdd) {
+	if !db.AccessGuildAllowed(member.GuildID) {
+		return
+	}
+	server, err := db.ServerQueryOrInsert(member.GuildID)
+	if err != nil {
+		log.Println("Error getting server during member add", err)
+		return
+	}
+	db.MemberEventInsert(member.GuildID, member.User.ID, db.MemberEventJoin)
+	// always restore, in case the policy was changed while they were gone
+	db.MemberSetFrozen(member.GuildID, member.User.ID, false)
+
+	history, err := db.MemberEventQueryHistory(member.GuildID, member.User.ID)
+	if err == nil && history.Joins > 1 {
+		Notify(session, server, db.NoticeModeration, member.User.Mention()+" ("+member.User.Username+") rejoined the server. That's "+strconv.Itoa(history.Joins)+
+			" recorded joins, last left "+util.GetStringOrDefault(history.LastLeave)+" UTC.")
+	}
+}
+
+func (mh *MemberHandler) memberRemove(session *discordgo.Session, member *discordgo.GuildMemberRemove) {
+	if !db.AccessGuildAllowed(member.GuildID) {
+		return
+	}
+	server, err := db.ServerQueryOrInsert(member.GuildID)
+	if err != nil {
+		log.Println("Error getting server during member remove", err)
+		return
+	}
+	db.MemberEventInsert(member.GuildID, member.User.ID, db.MemberEventLeave)
+	if server.LeaverPolicy == db.LeaverPolicyFreeze || server.LeaverPolicy == db.LeaverPolicyPurge {
+		db.MemberSetFrozen(member.GuildID, member.User.ID, true)
+	}
+
+	if !server.Enabled || !server.GoodbyeMessage.Valid {
+		return
+	}
+	var channelUid string
+	if server.GoodbyeChannel.Valid {
+		channelUid = server.GoodbyeChannel.String
+	} else if server.WelcomeChannel.Valid {
+		channelUid = server.WelcomeChannel.String
+	} else {
+		// nowhere to say goodbye, and there's no point DMing someone who left
+		return
+	}
+	guild, err := moeDiscord.GetGuild(member.GuildID, session)
+	if err != nil {
+		log.Println("Error getting guild during member remove", err)
+		return
+	}
+	session.ChannelMessageSend(channelUid, RenderTemplate(server.GoodbyeMessage.String, member.User, guild))
+}
+
+/*
+Periodically deletes data for members who have been gone longer than their server allows
+*/
+func (mh *MemberHandler) purgeLeavers() {
+	for {
+		leavers, err := db.MemberEventQueryPurgeable()
+		if err == nil {
+			purged := 0
+			for _, leaver := range leavers {
+				if db.MemberPurge(leaver) == nil {
+					purged++
+				}
+			}
+			if purged > 0 {
+				log.Println("Purged data for " + strconv.Itoa(purged) + " members who left")
+			}
+		}
+		time.Sleep(leaverPurgeInterval)
+	}
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+type MemberHistoryCommand struct {
+}
+
+func (mc *MemberHistoryCommand) Execute(pack *CommPackage) {
+	if len(pack.message.Mentions) != 1 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please mention the member you want the history of.")
+		return
+	}
+	user := pack.message.Mentions[0]
+	history, err := db.MemberEventQueryHistory(pack.guild.ID, user.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue loading that member's history. This is an issue with moebot not discord.")
+		return
+	}
+	if history.Joins == 0 && history.Leaves == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "I haven't seen "+user.Username+" join or leave this server.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, user.Username+" has joined "+strconv.Itoa(history.Joins)+" time(s) and left "+
+		strconv.Itoa(history.Leaves)+" time(s). Last joined: "+util.GetStringOrDefault(history.LastJoin)+", last left: "+
+		util.GetStringOrDefault(history.LastLeave)+" (UTC).")
+}
+
+func (mc *MemberHistoryCommand) GetPermLevel() db.Permission {
+	return db.PermMod
+}
+
+func (mc *MemberHistoryCommand) GetCommandKeys() []string {
+	return []string{"MEMBERHISTORY"}
+}
+
+func (mc *MemberHistoryCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s memberhistory <@user>` - Master/Mod. Shows how many times a member has joined and left this server.", commPrefix)
+}
@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const (
+	// shown to mods when they configure a templated message
+	TemplateHelp = "Placeholders: `{user}` mentions the user, `{user.name}` their name, `{server}` the server name, `{memberCount}` the number of " +
+		"members, `{channel:name}` links a channel and `{role:name}` mentions a role."
+
+	DefaultRuleAgreementReply = "Welcome {user}! We hope you enjoy your stay in our Discord server!"
+)
+
+/*
+Values that can be substituted into a template
+*/
+type templateData struct {
+	user  *discordgo.User
+	guild *discordgo.Guild
+}
+
+/*
+Checks that a template only uses placeholders we know about and that any channels or roles it references exist in the guild
+*/
+func ValidateTemplate(template string, guild *discordgo.Guild) error {
+	return walkTemplate(template, func(key string) (string, error) {
+		if strings.HasPrefix(key, "channel:") {
+			if findChannelByName(guild.Channels, strings.TrimPrefix(key, "channel:")) == nil {
+				return "", errors.New("I couldn't find the channel `" + strings.TrimPrefix(key, "channel:") + "` in this server")
+			}
+		} else if strings.HasPrefix(key, "role:") {
+			if moeDiscord.FindRoleByName(guild.Roles, strings.TrimPrefix(key, "role:")) == nil {
+				return "", errors.New("I couldn't find the role `" + strings.TrimPrefix(key, "role:") + "` in this server")
+			}
+		} else if !isTemplateKey(key) {
+			return "", errors.New("`{" + key + "}` isn't a placeholder I know about")
+		}
+		return "", nil
+	}, nil)
+}
+
+/*
+Fills in every placeholder in a template. Templates are validated when they're saved, but channels and roles may have been removed since then
+so those fall back to plain text
+*/
+func RenderTemplate(template string, user *discordgo.User, guild *discordgo.Guild) string {
+	data := templateData{user: user, guild: guild}
+	var out bytes.Buffer
+	err := walkTemplate(template, data.lookup, &out)
+	if err != nil {
+		// should only happen with a template saved before validation existed, so just send it as is
+		log.Println("Error rendering template, sending it unchanged", err)
+		return template
+	}
+	return out.String()
+}
+
+func (d templateData) lookup(key string) (string, error) {
+	switch {
+	case key == "user":
+		return d.user.Mention(), nil
+	case key == "user.name":
+		return d.user.Username, nil
+	case key == "server":
+		return d.guild.Name, nil
+	case key == "memberCount":
+		return strconv.Itoa(d.guild.MemberCount), nil
+	case strings.HasPrefix(key, "channel:"):
+		name := strings.TrimPrefix(key, "channel:")
+		if channel := findChannelByName(d.guild.Channels, name); channel != nil {
+			return "<#" + channel.ID + ">", nil
+		}
+		return "#" + name, nil
+	case strings.HasPrefix(key, "role:"):
+		name := strings.TrimPrefix(key, "role:")
+		if role := moeDiscord.FindRoleByName(d.guild.Roles, name); role != nil {
+			return "<@&" + role.ID + ">", nil
+		}
+		return "@" + name, nil
+	}
+	return "", errors.New("`{" + key + "}` isn't a placeholder I know about")
+}
+
+func isTemplateKey(key string) bool {
+	return key == "user" || key == "user.name" || key == "server" || key == "memberCount"
+}
+
+/*
+Goes through a template calling lookup for every placeholder, and writing the result to out if it's given.
+`{{` and `}}` can be used for literal braces
+*/
+func walkTemplate(template string, lookup func(key string) (string, error), out *bytes.Buffer) error {
+	if out == nil {
+		out = &bytes.Buffer{}
+	}
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if (c == '{' || c == '}') && i+1 < len(template) && template[i+1] == c {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		if c == '}' {
+			return errors.New("there's a `}` without a matching `{`. Use `}}` for a literal brace")
+		}
+		if c != '{' {
+			out.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(template[i:], '}')
+		if end < 0 {
+			return errors.New("there's a `{` without a matching `}`. Use `{{` for a literal brace")
+		}
+		key := strings.TrimSpace(template[i+1 : i+end])
+		value, err := lookup(key)
+		if err != nil {
+			return err
+		}
+		out.WriteString(value)
+		i += end
+	}
+	return nil
+}
+
+func findChannelByName(channels []*discordgo.Channel, name string) *discordgo.Channel {
+	name = strings.TrimPrefix(name, "#")
+	for _, c := range channels {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+/*
+Sends the server's welcome message to the given channel, as an embed if the server has any embed settings
+*/
+func SendWelcomeMessage(session *discordgo.Session, channelUid string, server db.Server, user *discordgo.User, guild *discordgo.Guild) error {
+	text := RenderTemplate(server.WelcomeMessage.String, user, guild)
+	if !server.WelcomeTitle.Valid && !server.WelcomeColor.Valid && !server.WelcomeImage.Valid {
+		_, err := session.ChannelMessageSend(channelUid, text)
+		return err
+	}
+	embed := &discordgo.MessageEmbed{
+		Description: text,
+		Color:       int(server.WelcomeColor.Int64),
+	}
+	if server.WelcomeTitle.Valid {
+		embed.Title = RenderTemplate(server.WelcomeTitle.String, user, guild)
+	}
+	if server.WelcomeImage.Valid {
+		embed.Image = &discordgo.MessageEmbedImage{URL: server.WelcomeImage.String}
+	}
+	_, err := session.ChannelMessageSendEmbed(channelUid, embed)
+	return err
+}
+
+/*
+The reply sent when someone agrees to the rules, falling back to our default if the server hasn't set one
+*/
+func RenderRuleAgreementReply(server db.Server, user *discordgo.User, guild *discordgo.Guild) string {
+	if server.RuleAgreementReply.Valid {
+		return RenderTemplate(server.RuleAgreementReply.String, user, guild)
+	}
+	return RenderTemplate(DefaultRuleAgreementReply, user, guild)
+}
+
+/*
+Parses a color in the form #RRGGBB
+*/
+func parseTemplateColor(color string) (int64, error) {
+	color = strings.TrimPrefix(strings.TrimSpace(color), "#")
+	if len(color) != 6 {
+		return 0, errors.New("colors need to be in the form #RRGGBB")
+	}
+	value, err := strconv.ParseInt(color, 16, 64)
+	if err != nil {
+		return 0, errors.New("colors need to be in the form #RRGGBB")
+	}
+	return value, nil
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var templateGuild = &discordgo.Guild{
+	ID:          "1",
+	Name:        "Moe Club",
+	MemberCount: 42,
+	Channels:    []*discordgo.Channel{{ID: "20", Name: "rules"}},
+	Roles:       []*discordgo.Role{{ID: "30", Name: "Member"}},
+}
+
+func TestMessageTemplate_RenderTemplate(t *testing.T) {
+	user := &discordgo.User{ID: "5", Username: "moe"}
+	checks := []struct {
+		template string
+		out      string
+	}{
+		{"Hello!", "Hello!"},
+		{"Welcome {user} to {server}!", "Welcome <@5> to Moe Club!"},
+		{"{user.name} is member #{memberCount}", "moe is member #42"},
+		{"Read {channel:rules} to get {role:member}", "Read <#20> to get <@&30>"},
+		{"Read {channel:missing} for {role:Gone}", "Read #missing for @Gone"},
+		{"Literal {{braces}}", "Literal {braces}"},
+		{"{ user }", "<@5>"},
+		// invalid templates are sent as is
+		{"Broken {user", "Broken {user"},
+		{"{unknown}", "{unknown}"},
+	}
+	for _, c := range checks {
+		if res := RenderTemplate(c.template, user, templateGuild); res != c.out {
+			t.Errorf("Incorrect render for template: %s. Got: %s, expected: %s", c.template, res, c.out)
+		}
+	}
+}
+
+func TestMessageTemplate_ValidateTemplate(t *testing.T) {
+	checks := []struct {
+		template string
+		valid    bool
+	}{
+		{"Hello {user}, welcome to {server}", true},
+		{"{channel:#rules} {role:Member} {memberCount} {user.name}", true},
+		{"{{not a placeholder}}", true},
+		{"{channel:general}", false},
+		{"{role:Admin}", false},
+		{"{users}", false},
+		{"unclosed {user", false},
+		{"stray } brace", false},
+	}
+	for _, c := range checks {
+		if err := ValidateTemplate(c.template, templateGuild); (err == nil) != c.valid {
+			t.Errorf("Incorrect validation for template: %s. Got: %v, expected valid: %v", c.template, err, c.valid)
+		}
+	}
+}
+
+func TestMessageTemplate_ParseTemplateColor(t *testing.T) {
+	checks := []struct {
+		in    string
+		out   int64
+		valid bool
+	}{
+		{"#FF0000", 0xFF0000, true},
+		{"00ff7f", 0x00FF7F, true},
+		{"#FFF", 0, false},
+		{"#GGGGGG", 0, false},
+	}
+	for _, c := range checks {
+		res, err := parseTemplateColor(c.in)
+		if (err == nil) != c.valid || res != c.out {
+			t.Errorf("Incorrect color for input: %s. Got: %d (%v), expected: %d", c.in, res, err, c.out)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+/*
+Sends an operational notice to wherever the server routes the notice's category. Notices for a server only ever go to that server or its
+owner, never to moebot's own debug channel
+*/
+func Notify(session *discordgo.Session, server db.Server, category db.NoticeCategory, message string) {
+	route, err := db.NoticeRouteQuery(server.Id, category)
+	if err != nil {
+		return
+	}
+	var channelUid string
+	switch route.Target {
+	case db.NoticeTargetBotChannel:
+		if !server.BotChannel.Valid {
+			log.Println("No bot channel for server " + server.GuildUid + ", dropping notice: " + message)
+			return
+		}
+		channelUid = server.BotChannel.String
+	case db.NoticeTargetChannel:
+		channelUid = route.ChannelUid.String
+	case db.NoticeTargetOwner:
+		guild, err := moeDiscord.GetGuild(server.GuildUid, session)
+		if err != nil {
+			return
+		}
+		dmChannel, err := session.UserChannelCreate(guild.OwnerID)
+		if err != nil {
+			log.Println("Error creating DM channel with the owner of "+server.GuildUid+", dropping notice: "+message, err)
+			return
+		}
+		channelUid = dmChannel.ID
+		message = "(From " + guild.Name + ") " + message
+	default:
+		return
+	}
+	if _, err = session.ChannelMessageSend(channelUid, message); err != nil {
+		log.Println("Error sending notice for server "+server.GuildUid, err)
+	}
+}
+
+/*
+Checks if a notice would have somewhere to go. The only route that can't deliver is the BotChannel of a server that hasn't set one.
+Categories that are turned off count as delivered, since nobody is waiting on them
+*/
+func noticeDeliverable(server db.Server, category db.NoticeCategory) bool {
+	route, err := db.NoticeRouteQuery(server.Id, category)
+	if err != nil {
+		return false
+	}
+	return route.Target != db.NoticeTargetBotChannel || server.BotChannel.Valid
+}
@@ -31,6 +31,7 @@ func (pc *PermitCommand) Execute(pack *CommPackage) {
 	r := moeDiscord.FindRoleByName(pack.guild.Roles, roleName)
 	if r == nil {
 		pack.session.ChannelMessageSend(pack.message.ChannelID, "Please provide a role that exists in this server")
+		return
 	}
 	// we've got the role, add it to the db, updating if necessary
 	// but first grab the server (probably want to move this out to include in the commPackage
@@ -72,6 +73,11 @@ func (pc *PermitCommand) Execute(pack *CommPackage) {
 		return
 	}
 	pack.session.ChannelMessageSend(pack.channel.ID, "Edited role "+roleName+" successfully")
+	// permissions only need moebot to read the role, but warn anyways in case this role is also meant to be handed out
+	if err = CheckRoleManageable(pack.session, pack.guild, r); err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Note: "+err.Error()+" Permissions will still work, but I won't be able to "+
+			"add or remove this role for anyone.")
+	}
 }
 
 func (pc *PermitCommand) GetPermLevel() db.Permission {
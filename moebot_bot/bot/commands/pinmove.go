@@ -269,7 +269,7 @@ func (pc *PinMoveCommand) channelMovePinsUpdate(session *discordgo.Session, pins
 		shouldMoveMessage = true
 	}
 	if shouldMoveMessage {
-		moveMessage(session, newPinnedMessage, dbChannel.MoveChannelUid.String, dbChannel.DeletePin)
+		moveMessage(session, server, newPinnedMessage, dbChannel.MoveChannelUid.String, dbChannel.DeletePin)
 	}
 }
 
@@ -316,10 +316,7 @@ func (pc *PinMoveCommand) GetCommandHelp(commPrefix string) string {
 		"option will delete the message before moving.", commPrefix)
 }
 
-func moveMessage(session *discordgo.Session, message *discordgo.Message, destChannelUid string, deleteOldPin bool) {
-	if deleteOldPin {
-		session.ChannelMessageDelete(message.ChannelID, message.ID)
-	}
+func moveMessage(session *discordgo.Session, server db.Server, message *discordgo.Message, destChannelUid string, deleteOldPin bool) {
 	var files []*discordgo.File
 	for _, a := range message.Attachments {
 		func() {
@@ -342,8 +339,18 @@ func moveMessage(session *discordgo.Session, message *discordgo.Message, destCha
 	}
 	content := message.Author.Mention() + " posted the following message in <#" + message.ChannelID + ">:\n" + message.Content
 
-	session.ChannelMessageSendComplex(destChannelUid, &discordgo.MessageSend{
+	_, err := session.ChannelMessageSendComplex(destChannelUid, &discordgo.MessageSend{
 		Content: content,
 		Files:   files,
 	})
+	if err != nil {
+		log.Println("Error moving pinned message", err)
+		Notify(session, server, db.NoticePinMove, "I couldn't move a pin from <#"+message.ChannelID+"> to <#"+destChannelUid+">. Please check I can "+
+			"send messages and attach files there. The original message is still in <#"+message.ChannelID+">.")
+		return
+	}
+	// only delete once it's been moved, so a failed move doesn't lose the message
+	if deleteOldPin {
+		session.ChannelMessageDelete(message.ChannelID, message.ID)
+	}
 }
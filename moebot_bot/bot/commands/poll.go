@@ -19,12 +19,16 @@ func (pc *PollCommand) Execute(pack *CommPackage) {
 	pc.PollsHandler.openPoll(pack)
 }
 
+func (pc *PollCommand) Setup(session *discordgo.Session) {
+	pc.PollsHandler.Setup(session)
+}
+
 func (pc *PollCommand) EventHandlers() []interface{} {
-	return []interface{}{pc.pollReactionsAdd}
+	return []interface{}{pc.pollReactionsAdd, pc.PollsHandler.ballotDirectMessage}
 }
 
 func (pc *PollCommand) pollReactionsAdd(session *discordgo.Session, reactionAdd *discordgo.MessageReactionAdd) {
-	pc.PollsHandler.checkSingleVote(session, reactionAdd)
+	pc.PollsHandler.checkVote(session, reactionAdd)
 }
 
 func (pc *PollCommand) GetPermLevel() db.Permission {
@@ -36,5 +40,7 @@ func (pc *PollCommand) GetCommandKeys() []string {
 }
 
 func (pc *PollCommand) GetCommandHelp(commPrefix string) string {
-	return fmt.Sprintf("`%[1]s poll -options <option 1, option 2, option 3, ...> -title <poll title>` - Master/All/Mod set up a poll with the given options. Type `%[1]s poll -close <poll id> to close`", commPrefix)
+	return fmt.Sprintf("`%[1]s poll -options <option 1, option 2, option 3, ...> -title <poll title>` - Master/All/Mod set up a poll with the given options. "+
+		"Add `-duration <30m|2h|1d>` or `-closes <YYYY-MM-DD HH:MM>` (UTC) to close it automatically. Add `-multi [max choices]` to let members "+
+		"pick more than one option, or `-ranked` to have them rank the options by DM and find the winner by instant-runoff. Type `%[1]s poll -close <poll id> to close`", commPrefix)
 }
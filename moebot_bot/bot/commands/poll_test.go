@@ -0,0 +1,219 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/lib/pq"
+)
+
+func TestPoll_ParsePollDuration(t *testing.T) {
+	checks := []struct {
+		param string
+		out   time.Duration
+		ok    bool
+	}{
+		{"30m", 30 * time.Minute, true},
+		{"2h", 2 * time.Hour, true},
+		{"1d", 24 * time.Hour, true},
+		{"1d12h", 36 * time.Hour, true},
+		{"1D 12H", 36 * time.Hour, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"90d", 90 * 24 * time.Hour, true},
+		{"91d", 0, false},
+		{"30s", 0, false},
+		{"0d", 0, false},
+		{"-2h", 0, false},
+		{"d", 0, false},
+		{"soon", 0, false},
+	}
+	for _, c := range checks {
+		if res, ok := parsePollDuration(c.param); res != c.out || ok != c.ok {
+			t.Errorf("Incorrect duration for %s. Got: %s (%t), expected: %s (%t)", c.param, res, ok, c.out, c.ok)
+		}
+	}
+}
+
+func TestPoll_ParsePollCloseTime(t *testing.T) {
+	now := time.Date(2018, 5, 4, 12, 0, 0, 0, time.UTC)
+	checks := []struct {
+		param string
+		out   time.Time
+		ok    bool
+	}{
+		{"2018-05-04 18:30", time.Date(2018, 5, 4, 18, 30, 0, 0, time.UTC), true},
+		{" 2018-06-01 00:00 ", time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2018-05-04 12:00", time.Time{}, false},
+		{"2018-05-03 18:00", time.Time{}, false},
+		{"2019-05-04 18:00", time.Time{}, false},
+		{"2018-05-04", time.Time{}, false},
+		{"tomorrow", time.Time{}, false},
+	}
+	for _, c := range checks {
+		if res, ok := parsePollCloseTime(c.param, now); !res.Equal(c.out) || ok != c.ok {
+			t.Errorf("Incorrect close time for %s. Got: %s (%t), expected: %s (%t)", c.param, res, ok, c.out, c.ok)
+		}
+	}
+}
+
+func TestPoll_PollRemindTime(t *testing.T) {
+	opened := time.Date(2018, 5, 4, 12, 0, 0, 0, time.UTC)
+	checks := []struct {
+		duration time.Duration
+		out      time.Time
+	}{
+		{24 * time.Hour, opened.Add(23 * time.Hour)},
+		{2 * time.Hour, opened.Add(90 * time.Minute)},
+		{20 * time.Minute, opened.Add(15 * time.Minute)},
+		{2 * time.Minute, time.Time{}},
+	}
+	for _, c := range checks {
+		if res := pollRemindTime(opened, opened.Add(c.duration)); !res.Equal(c.out) {
+			t.Errorf("Incorrect reminder time for a %s poll. Got: %s, expected: %s", c.duration, res, c.out)
+		}
+	}
+}
+
+func TestPoll_PollTimeLeftString(t *testing.T) {
+	checks := []struct {
+		left time.Duration
+		out  string
+	}{
+		{time.Hour, "1 hour"},
+		{59*time.Minute + 50*time.Second, "1 hour"},
+		{15 * time.Minute, "15 minutes"},
+		{20 * time.Second, "1 minute"},
+		{50 * time.Hour, "2 days"},
+	}
+	for _, c := range checks {
+		if res := pollTimeLeftString(c.left); res != c.out {
+			t.Errorf("Incorrect time left for %s. Got: %s, expected: %s", c.left, res, c.out)
+		}
+	}
+}
+
+func TestPoll_ClosePollMessageOnDeadline(t *testing.T) {
+	poll := &db.Poll{
+		Title:    "Lunch",
+		Open:     true,
+		UserUid:  "123",
+		ClosesAt: pq.NullTime{Time: time.Date(2018, 5, 4, 12, 0, 0, 0, time.UTC), Valid: true},
+		Options: []*db.PollOption{
+			{ReactionName: "regional_indicator_a", Description: "Pizza", Votes: 3},
+			{ReactionName: "regional_indicator_b", Description: "Sushi", Votes: 1},
+		},
+	}
+	expected := "Time's up for <@123>'s poll **Lunch**!\nPoll winner:\n:regional_indicator_a:  Pizza\nWith 3 votes!"
+	if res := closePollMessage(poll, nil); res != expected {
+		t.Errorf("Incorrect deadline message. Got: %q, expected: %q", res, expected)
+	}
+}
+
+func testPollOptions() []*db.PollOption {
+	return []*db.PollOption{
+		{Id: 1, ReactionName: "regional_indicator_a", Description: "Pizza"},
+		{Id: 2, ReactionName: "regional_indicator_b", Description: "Sushi"},
+		{Id: 3, ReactionName: "regional_indicator_c", Description: "Tacos"},
+	}
+}
+
+func testPollBallots(rankings ...[]int) []*db.PollBallot {
+	var ballots []*db.PollBallot
+	for _, r := range rankings {
+		ballots = append(ballots, &db.PollBallot{OptionIds: r})
+	}
+	return ballots
+}
+
+func TestPoll_PollRunoff(t *testing.T) {
+	checks := []struct {
+		ballots []*db.PollBallot
+		winners []int
+		votes   int
+		rounds  int
+	}{
+		// a majority in the first round
+		{testPollBallots([]int{1}, []int{1, 2}, []int{2}), []int{1}, 2, 1},
+		// tacos go out and their second choices decide it
+		{testPollBallots([]int{1}, []int{1}, []int{2}, []int{2}, []int{3, 2}), []int{2}, 3, 2},
+		// sushi and tacos are tied for last and go out together, then ballots that only ranked them stop counting
+		{testPollBallots([]int{1}, []int{1}, []int{2}, []int{3}), []int{1}, 2, 2},
+		// a dead heat between everyone left
+		{testPollBallots([]int{1, 3}, []int{2, 3}), []int{1, 2}, 1, 2},
+		{testPollBallots(), nil, 0, 1},
+	}
+	for _, c := range checks {
+		rounds, winners, votes := pollRunoff(testPollOptions(), c.ballots)
+		var ids []int
+		for _, o := range winners {
+			ids = append(ids, o.Id)
+		}
+		if !reflect.DeepEqual(ids, c.winners) || votes != c.votes || len(rounds) != c.rounds {
+			t.Errorf("Incorrect runoff. Got: %v with %d votes in %d rounds, expected: %v with %d votes in %d rounds", ids, votes, len(rounds),
+				c.winners, c.votes, c.rounds)
+		}
+	}
+}
+
+func TestPoll_ParseRankedBallot(t *testing.T) {
+	checks := []struct {
+		content string
+		out     []int
+		ok      bool
+	}{
+		{"B A C", []int{2, 1, 3}, true},
+		{"c, a", []int{3, 1}, true},
+		{"b > c", []int{2, 3}, true},
+		{"a", []int{1}, true},
+		{"A A", nil, false},
+		{"A D", nil, false},
+		{"AB", nil, false},
+		{"pizza", nil, false},
+		{"  ", nil, false},
+	}
+	for _, c := range checks {
+		if res, ok := parseRankedBallot(c.content, testPollOptions()); !reflect.DeepEqual(res, c.out) || ok != c.ok {
+			t.Errorf("Incorrect ballot for %q. Got: %v (%t), expected: %v (%t)", c.content, res, ok, c.out, c.ok)
+		}
+	}
+}
+
+func TestPoll_ParsePollMaxChoices(t *testing.T) {
+	checks := []struct {
+		param string
+		out   int
+		ok    bool
+	}{
+		{"", 5, true},
+		{"2", 2, true},
+		{"5", 5, true},
+		{"1", 0, false},
+		{"6", 0, false},
+		{"two", 0, false},
+	}
+	for _, c := range checks {
+		if res, ok := parsePollMaxChoices(c.param, 5); res != c.out || ok != c.ok {
+			t.Errorf("Incorrect max choices for %q. Got: %d (%t), expected: %d (%t)", c.param, res, ok, c.out, c.ok)
+		}
+	}
+}
+
+func TestPoll_ClosePollMessageRanked(t *testing.T) {
+	poll := &db.Poll{
+		Title:   "Lunch",
+		Open:    true,
+		UserUid: "123",
+		Type:    db.PollRanked,
+		Options: testPollOptions(),
+		Ballots: testPollBallots([]int{1}, []int{1}, []int{2}, []int{2}, []int{3, 2}),
+	}
+	expected := "Time's up for <@123>'s poll **Lunch**!\n" +
+		"Round 1: :regional_indicator_a: 2, :regional_indicator_b: 2, :regional_indicator_c: 1 - out: :regional_indicator_c:\n" +
+		"Round 2: :regional_indicator_a: 2, :regional_indicator_b: 3\n" +
+		"Poll winner:\n:regional_indicator_b:  Sushi\nWith 3 of 5 votes in the final round!"
+	if res := closePollMessage(poll, nil); res != expected {
+		t.Errorf("Incorrect ranked message. Got: %q, expected: %q", res, expected)
+	}
+}
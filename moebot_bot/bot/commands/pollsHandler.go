@@ -5,20 +5,71 @@ import (
 	"log"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+	"github.com/lib/pq"
 
 	"github.com/camd67/moebot/moebot_bot/util"
 	"github.com/camd67/moebot/moebot_bot/util/db"
 )
 
+const (
+	// how often polls are checked for a deadline or reminder that's come up
+	pollSchedulerInterval = 30 * time.Second
+	pollMinDuration       = time.Minute
+	pollMaxDuration       = 90 * 24 * time.Hour
+	// reminders go out a quarter of the way before the deadline, but never more than this early
+	pollMaxReminderLead = time.Hour
+	// -closes takes a time in UTC
+	pollClosesLayout = "2006-01-02 15:04"
+	// members react with this on a ranked-choice poll to get a ballot by DM
+	pollBallotReaction = "📩"
+	// how long moebot waits for a ranking after sending a ballot
+	pollBallotExpiry = 30 * time.Minute
+	// only the last few runoff rounds are listed, so the results fit in a message
+	pollRunoffRoundsShown = 5
+)
+
+/*
+A ballot sent to a member that they haven't replied to yet
+*/
+type pendingBallot struct {
+	pollId       int
+	dmChannelUid string
+	sent         time.Time
+}
+
+/*
+One round of counting a ranked-choice poll. Each ballot counts for its favorite option that's still standing
+*/
+type pollRunoffRound struct {
+	standing []*db.PollOption
+	votes    map[int]int
+	total    int
+	// options with the fewest votes, which are out from the next round on
+	eliminated []*db.PollOption
+}
+
 type PollsHandler struct {
+	// guards pollsList, which the scheduler reads alongside commands and reactions
+	sync.Mutex
 	pollsList []*db.Poll
+	// guards whether the polls in pollsList are open, their reminders and their counted votes. Closing holds it the whole way through,
+	// so a poll isn't closed by a mod and its deadline together
+	closeLock sync.Mutex
+	// ballots waiting on a reply, keyed by the member's user id
+	ballots struct {
+		sync.Mutex
+		m map[string]pendingBallot
+	}
 }
 
 func NewPollsHandler() *PollsHandler {
 	h := &PollsHandler{}
+	h.ballots.m = make(map[string]pendingBallot)
 	h.loadFromDb()
 	return h
 }
@@ -28,9 +79,49 @@ func (handler *PollsHandler) loadFromDb() {
 	handler.pollsList = polls
 }
 
+/*
+Starts watching for polls that are due to close. Deadlines live in the database, so anything loaded from it is picked back up after
+a restart, and polls that came due while moebot was down close on the first check
+*/
+func (handler *PollsHandler) Setup(session *discordgo.Session) {
+	go handler.runScheduler(session)
+}
+
+func (handler *PollsHandler) runScheduler(session *discordgo.Session) {
+	for {
+		time.Sleep(pollSchedulerInterval)
+		now := time.Now()
+		handler.Lock()
+		polls := append([]*db.Poll(nil), handler.pollsList...)
+		handler.Unlock()
+		var closing, reminding []*db.Poll
+		handler.closeLock.Lock()
+		for _, p := range polls {
+			if !p.Open || !p.ClosesAt.Valid {
+				continue
+			}
+			if !now.Before(p.ClosesAt.Time) {
+				closing = append(closing, p)
+			} else if p.RemindAt.Valid && !now.Before(p.RemindAt.Time) {
+				reminding = append(reminding, p)
+			}
+		}
+		handler.closeLock.Unlock()
+		for _, p := range closing {
+			handler.closeOnDeadline(session, p)
+		}
+		for _, p := range reminding {
+			handler.remindPoll(session, p, now)
+		}
+	}
+}
+
 func (handler *PollsHandler) openPoll(pack *CommPackage) {
 	var options []string
 	var title string
+	var duration, closes string
+	var multi, ranked bool
+	var maxChoices string
 	for i := 0; i < len(pack.params); i++ {
 		if pack.params[i] == "-options" {
 			options = parseOptions(pack.params[i+1:])
@@ -38,6 +129,19 @@ func (handler *PollsHandler) openPoll(pack *CommPackage) {
 		if pack.params[i] == "-title" {
 			title = parseTitle(pack.params[i+1:])
 		}
+		if pack.params[i] == "-duration" {
+			duration = parseTitle(pack.params[i+1:])
+		}
+		if pack.params[i] == "-closes" {
+			closes = parseTitle(pack.params[i+1:])
+		}
+		if pack.params[i] == "-multi" {
+			multi = true
+			maxChoices = parseTitle(pack.params[i+1:])
+		}
+		if pack.params[i] == "-ranked" {
+			ranked = true
+		}
 	}
 	if len(options) <= 1 {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you must specify at least two options to create a poll.")
@@ -47,6 +151,44 @@ func (handler *PollsHandler) openPoll(pack *CommPackage) {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there can only be a maximum of 25 options per poll.")
 		return
 	}
+	pollType := db.PollSingle
+	choices := 1
+	if multi && ranked {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, a poll can be `-multi` or `-ranked`, but not both.")
+		return
+	} else if multi {
+		var ok bool
+		if choices, ok = parsePollMaxChoices(maxChoices, len(options)); !ok {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, `-multi` needs a number of choices between 2 and the number of options, or "+
+				"nothing to allow every option.")
+			return
+		}
+		pollType = db.PollMulti
+	} else if ranked {
+		pollType = db.PollRanked
+	}
+	now := time.Now().UTC()
+	var closesAt time.Time
+	if duration != "" && closes != "" {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, a poll can have a `-duration` or a `-closes` time, but not both.")
+		return
+	} else if duration != "" {
+		d, ok := parsePollDuration(duration)
+		if !ok {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I don't know how long `"+duration+"` is. Please give a duration between a minute "+
+				"and "+strconv.Itoa(int(pollMaxDuration.Hours()/24))+" days, like `30m`, `2h` or `1d12h`.")
+			return
+		}
+		closesAt = now.Add(d)
+	} else if closes != "" {
+		t, ok := parsePollCloseTime(closes, now)
+		if !ok {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, `"+closes+"` isn't a time I can close the poll at. Please give a UTC time in the "+
+				"future like `"+now.Add(24*time.Hour).Format(pollClosesLayout)+"`, up to "+strconv.Itoa(int(pollMaxDuration.Hours()/24))+" days away.")
+			return
+		}
+		closesAt = t
+	}
 	server, err := db.ServerQueryOrInsert(pack.guild.ID)
 	if err != nil {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was a problem creating the poll. Please try again.")
@@ -58,11 +200,19 @@ func (handler *PollsHandler) openPoll(pack *CommPackage) {
 		return
 	}
 	poll := &db.Poll{
-		Title:     title,
-		UserUid:   pack.message.Author.ID,
-		ChannelId: channel.Id,
-		Open:      true,
-		Options:   createPollOptions(options),
+		Title:      title,
+		UserUid:    pack.message.Author.ID,
+		ChannelId:  channel.Id,
+		Open:       true,
+		Options:    createPollOptions(options),
+		Type:       pollType,
+		MaxChoices: choices,
+	}
+	if !closesAt.IsZero() {
+		poll.ClosesAt = pq.NullTime{Time: closesAt, Valid: true}
+		if remindAt := pollRemindTime(now, closesAt); !remindAt.IsZero() {
+			poll.RemindAt = pq.NullTime{Time: remindAt, Valid: true}
+		}
 	}
 	err = db.PollAdd(poll)
 	if err != nil {
@@ -75,8 +225,15 @@ func (handler *PollsHandler) openPoll(pack *CommPackage) {
 		return
 	}
 	message, _ := pack.session.ChannelMessageSend(pack.channel.ID, openPollMessage(poll, pack.message.Author))
-	for _, o := range poll.Options {
-		err = pack.session.MessageReactionAdd(pack.channel.ID, message.ID, o.ReactionId)
+	reactions := []string{pollBallotReaction}
+	if poll.Type != db.PollRanked {
+		reactions = nil
+		for _, o := range poll.Options {
+			reactions = append(reactions, o.ReactionId)
+		}
+	}
+	for _, reaction := range reactions {
+		err = pack.session.MessageReactionAdd(pack.channel.ID, message.ID, reaction)
 		if err != nil {
 			log.Println("Cannot add reaction to poll message", err)
 		}
@@ -86,7 +243,9 @@ func (handler *PollsHandler) openPoll(pack *CommPackage) {
 	if err != nil {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was a problem updating the poll. Please delete and create it again.")
 	}
+	handler.Lock()
 	handler.pollsList = append(handler.pollsList, poll)
+	handler.Unlock()
 }
 
 func parseOptions(params []string) []string {
@@ -127,7 +286,9 @@ func (handler *PollsHandler) closePoll(pack *CommPackage) {
 			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was a problem retreiving the poll with the given ID")
 			return
 		}
+		handler.Lock()
 		handler.pollsList = append(handler.pollsList, poll)
+		handler.Unlock()
 	}
 	channel, err := db.ChannelQueryById(poll.ChannelId)
 	if err != nil {
@@ -138,16 +299,21 @@ func (handler *PollsHandler) closePoll(pack *CommPackage) {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you can't close a poll opened in another channel")
 		return
 	}
+	handler.closeLock.Lock()
+	defer handler.closeLock.Unlock()
 	if !poll.Open {
+		if poll.Type == db.PollRanked && poll.Ballots == nil {
+			// the runoff is counted again from the ballots to show the results
+			poll.Ballots, _ = db.PollBallotQuery(poll.Id)
+		}
 		pack.session.ChannelMessageSend(pack.channel.ID, closePollMessage(poll, pack.message.Author))
 		return
 	}
-	err = updatePollVotes(poll, pack.session)
+	err = countPollVotes(poll, pack.session)
 	if err != nil {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was a problem retrieving the votes count for the given Poll")
 		return
 	}
-	db.PollOptionUpdateVotes(poll)
 	err = db.PollClose(id)
 	if err != nil {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was a problem closing the poll.")
@@ -157,7 +323,55 @@ func (handler *PollsHandler) closePoll(pack *CommPackage) {
 	poll.Open = false
 }
 
+/*
+Closes a poll whose deadline has passed and posts the results in its channel
+*/
+func (handler *PollsHandler) closeOnDeadline(session *discordgo.Session, poll *db.Poll) {
+	handler.closeLock.Lock()
+	defer handler.closeLock.Unlock()
+	if !poll.Open {
+		// a mod got to it first
+		return
+	}
+	channel, err := db.ChannelQueryById(poll.ChannelId)
+	if err != nil {
+		return
+	}
+	// if the votes can't be counted the poll message is most likely gone, but it still needs closing so it isn't tried again
+	countErr := countPollVotes(poll, session)
+	if countErr != nil {
+		log.Println("Cannot count votes for poll "+strconv.Itoa(poll.Id)+" at its deadline", countErr)
+	}
+	if err = db.PollClose(poll.Id); err != nil {
+		return
+	}
+	if countErr != nil {
+		session.ChannelMessageSend(channel.ChannelUid, "Time's up for poll "+strconv.Itoa(poll.Id)+", but I couldn't count the votes. "+
+			"Was the poll message deleted?")
+	} else {
+		session.ChannelMessageSend(channel.ChannelUid, closePollMessage(poll, nil))
+	}
+	poll.Open = false
+}
+
+func (handler *PollsHandler) remindPoll(session *discordgo.Session, poll *db.Poll, now time.Time) {
+	// cleared first, a missed reminder is better than one sent over and over
+	if err := db.PollClearRemindAt(poll.Id); err != nil {
+		return
+	}
+	handler.closeLock.Lock()
+	poll.RemindAt.Valid = false
+	handler.closeLock.Unlock()
+	channel, err := db.ChannelQueryById(poll.ChannelId)
+	if err != nil {
+		return
+	}
+	session.ChannelMessageSend(channel.ChannelUid, pollReminderMessage(poll, now))
+}
+
 func (handler *PollsHandler) pollFromId(id int) *db.Poll {
+	handler.Lock()
+	defer handler.Unlock()
 	for _, p := range handler.pollsList {
 		if p.Id == id {
 			return p
@@ -166,31 +380,39 @@ func (handler *PollsHandler) pollFromId(id int) *db.Poll {
 	return nil
 }
 
-func (handler *PollsHandler) checkSingleVote(session *discordgo.Session, reactionAdd *discordgo.MessageReactionAdd) {
+func (handler *PollsHandler) checkVote(session *discordgo.Session, reactionAdd *discordgo.MessageReactionAdd) {
 	var err error
-	for _, p := range handler.pollsList {
+	handler.Lock()
+	polls := append([]*db.Poll(nil), handler.pollsList...)
+	handler.Unlock()
+	for _, p := range polls {
 		if p.MessageUid == reactionAdd.MessageID {
-			p.Options, err = db.PollOptionQuery(p.Id)
+			// votes are handled on a copy, so closing the poll can count the shared one without them getting in each other's way
+			handler.closeLock.Lock()
+			poll := *p
+			handler.closeLock.Unlock()
+			poll.Options, err = db.PollOptionQuery(poll.Id)
 			if err != nil {
 				log.Println("Cannot retrieve poll options informations", err)
 				return
 			}
-			//If the user is reacting to a poll, we check if he has already cast a vote and remove it
-			handler.handleSingleVote(session, p, reactionAdd)
+			switch poll.Type {
+			case db.PollMulti:
+				handler.handleMultiVote(session, &poll, reactionAdd)
+			case db.PollRanked:
+				handler.handleRankedVote(session, &poll, reactionAdd)
+			default:
+				//If the user is reacting to a poll, we check if he has already cast a vote and remove it
+				handler.handleSingleVote(session, &poll, reactionAdd)
+			}
 			return
 		}
 	}
 }
 
 func (handler *PollsHandler) handleSingleVote(session *discordgo.Session, poll *db.Poll, reactionAdd *discordgo.MessageReactionAdd) {
-	channel, err := db.ChannelQueryById(poll.ChannelId)
+	channel, message, err := loadPollMessage(session, poll)
 	if err != nil {
-		log.Println("Cannot retrieve poll channel informations", err)
-		return
-	}
-	message, err := session.ChannelMessage(channel.ChannelUid, poll.MessageUid)
-	if err != nil {
-		log.Println("Cannot retrieve poll message informations", err)
 		return
 	}
 	if message.Author.ID == reactionAdd.UserID {
@@ -216,6 +438,134 @@ func (handler *PollsHandler) handleSingleVote(session *discordgo.Session, poll *
 	}
 }
 
+/*
+Lets members pick up to the poll's number of choices, taking back any reaction that goes over
+*/
+func (handler *PollsHandler) handleMultiVote(session *discordgo.Session, poll *db.Poll, reactionAdd *discordgo.MessageReactionAdd) {
+	channel, message, err := loadPollMessage(session, poll)
+	if err != nil {
+		return
+	}
+	if message.Author.ID == reactionAdd.UserID || !reactionIsOption(poll.Options, reactionAdd.Emoji.Name) {
+		return
+	}
+	picked := 0
+	for _, r := range message.Reactions {
+		if r.Emoji.Name == reactionAdd.Emoji.Name || !reactionIsOption(poll.Options, r.Emoji.Name) {
+			continue
+		}
+		users, err := session.MessageReactions(channel.ChannelUid, poll.MessageUid, r.Emoji.Name, 100)
+		if err != nil {
+			log.Println("Cannot retrieve reaction informations", err)
+			return
+		}
+		for _, u := range users {
+			if u.ID == reactionAdd.UserID {
+				picked++
+				break
+			}
+		}
+	}
+	if picked >= poll.MaxChoices {
+		session.MessageReactionRemove(channel.ChannelUid, poll.MessageUid, reactionAdd.Emoji.Name, reactionAdd.UserID)
+	}
+}
+
+/*
+Sends a ballot by DM to anyone who reacts to a ranked-choice poll. Their reaction is taken back so they can react again for a new ballot
+*/
+func (handler *PollsHandler) handleRankedVote(session *discordgo.Session, poll *db.Poll, reactionAdd *discordgo.MessageReactionAdd) {
+	if reactionAdd.UserID == session.State.User.ID || reactionAdd.Emoji.Name != pollBallotReaction {
+		return
+	}
+	session.MessageReactionRemove(reactionAdd.ChannelID, reactionAdd.MessageID, reactionAdd.Emoji.Name, reactionAdd.UserID)
+	if !poll.Open {
+		return
+	}
+	dmChannel, err := session.UserChannelCreate(reactionAdd.UserID)
+	if err != nil {
+		log.Println("Error creating DM channel for poll ballot", err)
+		return
+	}
+	if _, err = session.ChannelMessageSend(dmChannel.ID, pollBallotMessage(poll)); err != nil {
+		// most likely they have DMs from the server turned off
+		return
+	}
+	handler.ballots.Lock()
+	defer handler.ballots.Unlock()
+	handler.ballots.m[reactionAdd.UserID] = pendingBallot{pollId: poll.Id, dmChannelUid: dmChannel.ID, sent: time.Now()}
+}
+
+/*
+Handles rankings typed back to moebot in a DM
+*/
+func (handler *PollsHandler) ballotDirectMessage(session *discordgo.Session, message *discordgo.MessageCreate) {
+	if message.Author.ID == session.State.User.ID || message.Author.Bot {
+		return
+	}
+	handler.ballots.Lock()
+	pending, ok := handler.ballots.m[message.Author.ID]
+	if ok && time.Since(pending.sent) > pollBallotExpiry {
+		delete(handler.ballots.m, message.Author.ID)
+		ok = false
+	}
+	handler.ballots.Unlock()
+	if !ok || pending.dmChannelUid != message.ChannelID {
+		// not someone we're waiting on
+		return
+	}
+	poll, err := db.PollQuery(pending.pollId)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, "Sorry, there was a problem loading the poll. This is an issue with moebot not discord.")
+		return
+	}
+	if !poll.Open {
+		handler.clearPendingBallot(message.Author.ID)
+		session.ChannelMessageSend(message.ChannelID, "Sorry, that poll has already closed.")
+		return
+	}
+	optionIds, ok := parseRankedBallot(message.Content, poll.Options)
+	if !ok {
+		session.ChannelMessageSend(message.ChannelID, "Sorry, I couldn't read that ranking. Please reply with the letters of the options, "+
+			"favorite first and each only once, like `B A C`.")
+		return
+	}
+	if err = db.PollBallotSet(poll.Id, &db.PollBallot{UserUid: message.Author.ID, OptionIds: optionIds}); err != nil {
+		session.ChannelMessageSend(message.ChannelID, "Sorry, there was a problem saving your ranking. This is an issue with moebot not discord.")
+		return
+	}
+	handler.clearPendingBallot(message.Author.ID)
+	var lines []string
+	for i, id := range optionIds {
+		for _, o := range poll.Options {
+			if o.Id == id {
+				lines = append(lines, strconv.Itoa(i+1)+". :"+o.ReactionName+":  "+o.Description)
+			}
+		}
+	}
+	session.ChannelMessageSend(message.ChannelID, "Thanks! Your ranking is in:\n"+strings.Join(lines, "\n"))
+}
+
+func (handler *PollsHandler) clearPendingBallot(userUid string) {
+	handler.ballots.Lock()
+	defer handler.ballots.Unlock()
+	delete(handler.ballots.m, userUid)
+}
+
+func loadPollMessage(session *discordgo.Session, poll *db.Poll) (*db.Channel, *discordgo.Message, error) {
+	channel, err := db.ChannelQueryById(poll.ChannelId)
+	if err != nil {
+		log.Println("Cannot retrieve poll channel informations", err)
+		return nil, nil, err
+	}
+	message, err := session.ChannelMessage(channel.ChannelUid, poll.MessageUid)
+	if err != nil {
+		log.Println("Cannot retrieve poll message informations", err)
+		return nil, nil, err
+	}
+	return channel, message, nil
+}
+
 func reactionIsOption(options []*db.PollOption, emojiID string) bool {
 	for _, o := range options {
 		if o.ReactionId == emojiID {
@@ -225,6 +575,34 @@ func reactionIsOption(options []*db.PollOption, emojiID string) bool {
 	return false
 }
 
+/*
+Reloads a poll's options, since polls loaded at startup don't have them, then counts and saves their votes
+*/
+func countPollVotes(poll *db.Poll, session *discordgo.Session) error {
+	options, err := db.PollOptionQuery(poll.Id)
+	if err != nil {
+		return err
+	}
+	poll.Options = options
+	if poll.Type == db.PollRanked {
+		if poll.Ballots, err = db.PollBallotQuery(poll.Id); err != nil {
+			return err
+		}
+		// options keep how many members ranked them first, the runoff is worked out from the ballots
+		for _, o := range poll.Options {
+			o.Votes = 0
+			for _, b := range poll.Ballots {
+				if len(b.OptionIds) > 0 && b.OptionIds[0] == o.Id {
+					o.Votes++
+				}
+			}
+		}
+	} else if err = updatePollVotes(poll, session); err != nil {
+		return err
+	}
+	return db.PollOptionUpdateVotes(poll)
+}
+
 func updatePollVotes(poll *db.Poll, session *discordgo.Session) error {
 	channel, err := db.ChannelQueryById(poll.ChannelId)
 	if err != nil {
@@ -253,14 +631,50 @@ func openPollMessage(poll *db.Poll, user *discordgo.User) string {
 	for _, o := range poll.Options {
 		message += ":" + o.ReactionName + ":  " + o.Description + "\n"
 	}
+	switch poll.Type {
+	case db.PollMulti:
+		message += "Pick up to " + strconv.Itoa(poll.MaxChoices) + " options!\n"
+	case db.PollRanked:
+		message += "React with " + pollBallotReaction + " to rank the options by DM!\n"
+	}
+	if poll.ClosesAt.Valid {
+		message += "Closes at " + poll.ClosesAt.Time.UTC().Format(pollClosesLayout) + " UTC\n"
+	}
 	message += "Poll ID: " + strconv.Itoa(poll.Id)
 	return message
 }
 
+func pollBallotMessage(poll *db.Poll) string {
+	message := "Here's your ballot for "
+	if poll.Title != "" {
+		message += "the poll **" + poll.Title + "**"
+	} else {
+		message += "poll " + strconv.Itoa(poll.Id)
+	}
+	message += ":\n"
+	for _, o := range poll.Options {
+		message += ":" + o.ReactionName + ":  " + o.Description + "\n"
+	}
+	return message + "Reply with the letters of the options you'd vote for, favorite first, like `B A C`. You don't have to rank every option. " +
+		"To change your ranking, react to the poll again before it closes."
+}
+
+func pollReminderMessage(poll *db.Poll, now time.Time) string {
+	message := "Only " + pollTimeLeftString(poll.ClosesAt.Time.Sub(now)) + " left to vote in "
+	if poll.Title != "" {
+		message += "the poll **" + poll.Title + "**!"
+	} else {
+		message += util.UserIdToMention(poll.UserUid) + "'s poll!"
+	}
+	return message + " Poll ID: " + strconv.Itoa(poll.Id)
+}
+
 func closePollMessage(poll *db.Poll, user *discordgo.User) string {
 	var message string
 	if poll.Open {
-		if user.ID == poll.UserUid {
+		if user == nil {
+			message = "Time's up for " + util.UserIdToMention(poll.UserUid) + "'s poll"
+		} else if user.ID == poll.UserUid {
 			message = user.Mention() + " closed their poll"
 		} else {
 			message = user.Mention() + " closed " + util.UserIdToMention(poll.UserUid) + "'s poll"
@@ -277,8 +691,11 @@ func closePollMessage(poll *db.Poll, user *discordgo.User) string {
 			message = "This poll is already closed!"
 		}
 	}
-	winners := pollWinners(poll)
-	if len(winners) == 0 || winners[0].Votes == 0 {
+	if poll.Type == db.PollRanked {
+		return message + pollRunoffMessage(poll)
+	}
+	winners, votes := pollWinners(poll)
+	if len(winners) == 0 || votes == 0 {
 		message += "There are no winners!"
 		return message
 	}
@@ -290,11 +707,59 @@ func closePollMessage(poll *db.Poll, user *discordgo.User) string {
 	for _, o := range winners {
 		message += ":" + o.ReactionName + ":  " + o.Description + "\n"
 	}
-	message += "With " + strconv.Itoa(winners[0].Votes) + " votes!"
+	message += "With " + strconv.Itoa(votes) + " votes!"
 	return message
 }
 
-func pollWinners(poll *db.Poll) []*db.PollOption {
+/*
+Lists how each round of a ranked-choice poll went, then who won
+*/
+func pollRunoffMessage(poll *db.Poll) string {
+	rounds, winners, votes := pollRunoff(poll.Options, poll.Ballots)
+	if len(winners) == 0 || votes == 0 {
+		return "There are no winners!"
+	}
+	var message string
+	shown := rounds
+	if len(rounds) > pollRunoffRoundsShown {
+		shown = rounds[len(rounds)-pollRunoffRoundsShown:]
+		message += "...\n"
+	}
+	for i, round := range shown {
+		var counts []string
+		for _, o := range round.standing {
+			counts = append(counts, ":"+o.ReactionName+": "+strconv.Itoa(round.votes[o.Id]))
+		}
+		message += "Round " + strconv.Itoa(len(rounds)-len(shown)+i+1) + ": " + strings.Join(counts, ", ")
+		for j, o := range round.eliminated {
+			if j == 0 {
+				message += " - out: "
+			} else {
+				message += ", "
+			}
+			message += ":" + o.ReactionName + ":"
+		}
+		message += "\n"
+	}
+	if len(winners) > 1 {
+		message += "Tied for first place:\n"
+	} else {
+		message += "Poll winner:\n"
+	}
+	for _, o := range winners {
+		message += ":" + o.ReactionName + ":  " + o.Description + "\n"
+	}
+	return message + "With " + strconv.Itoa(votes) + " of " + strconv.Itoa(rounds[len(rounds)-1].total) + " votes in the final round!"
+}
+
+/*
+Gets the options with the most votes, and how many votes that is. Ranked-choice polls go by their instant-runoff result instead
+*/
+func pollWinners(poll *db.Poll) ([]*db.PollOption, int) {
+	if poll.Type == db.PollRanked {
+		_, winners, votes := pollRunoff(poll.Options, poll.Ballots)
+		return winners, votes
+	}
 	var winningOptions []*db.PollOption
 	maxVotes := 0
 	for _, option := range poll.Options {
@@ -309,7 +774,189 @@ func pollWinners(poll *db.Poll) []*db.PollOption {
 		}
 	}
 
-	return winningOptions
+	return winningOptions, maxVotes
+}
+
+/*
+Finds the winner of a ranked-choice poll with instant-runoff. Every round each ballot counts for its favorite option still standing. An
+option with more than half of those votes wins, otherwise every option tied for the fewest votes is knocked out and it's counted again.
+If all the options left are tied, they all win
+*/
+func pollRunoff(options []*db.PollOption, ballots []*db.PollBallot) (rounds []pollRunoffRound, winners []*db.PollOption, votes int) {
+	standing := options
+	for len(standing) > 0 {
+		round := pollRunoffRound{standing: standing, votes: make(map[int]int)}
+		for _, b := range ballots {
+			for _, id := range b.OptionIds {
+				if pollOptionStanding(standing, id) {
+					round.votes[id]++
+					round.total++
+					break
+				}
+			}
+		}
+		if round.total == 0 {
+			rounds = append(rounds, round)
+			return rounds, nil, 0
+		}
+		most, fewest := 0, round.total
+		for _, o := range standing {
+			if round.votes[o.Id] > most {
+				most = round.votes[o.Id]
+			}
+			if round.votes[o.Id] < fewest {
+				fewest = round.votes[o.Id]
+			}
+		}
+		if most*2 > round.total || most == fewest {
+			rounds = append(rounds, round)
+			for _, o := range standing {
+				if round.votes[o.Id] == most {
+					winners = append(winners, o)
+				}
+			}
+			return rounds, winners, most
+		}
+		var next []*db.PollOption
+		for _, o := range standing {
+			if round.votes[o.Id] == fewest {
+				round.eliminated = append(round.eliminated, o)
+			} else {
+				next = append(next, o)
+			}
+		}
+		rounds = append(rounds, round)
+		standing = next
+	}
+	return rounds, nil, 0
+}
+
+func pollOptionStanding(standing []*db.PollOption, id int) bool {
+	for _, o := range standing {
+		if o.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Reads a ranking like "B A C" or "b, a, c" into option ids, favorite first. Each letter is an option in the order they're listed
+*/
+func parseRankedBallot(content string, options []*db.PollOption) ([]int, bool) {
+	letters := strings.FieldsFunc(strings.ToUpper(content), func(r rune) bool {
+		return r == ' ' || r == ',' || r == '>' || r == '\n'
+	})
+	if len(letters) == 0 {
+		return nil, false
+	}
+	var optionIds []int
+	for _, l := range letters {
+		if len(l) != 1 || l[0] < 'A' || int(l[0]-'A') >= len(options) {
+			return nil, false
+		}
+		id := options[l[0]-'A'].Id
+		for _, picked := range optionIds {
+			if picked == id {
+				return nil, false
+			}
+		}
+		optionIds = append(optionIds, id)
+	}
+	return optionIds, true
+}
+
+/*
+Reads how many options each member can pick in a multi-choice poll. Leaving it off lets them pick every option
+*/
+func parsePollMaxChoices(param string, optionCount int) (int, bool) {
+	if param == "" {
+		return optionCount, true
+	}
+	choices, err := strconv.Atoi(param)
+	if err != nil || choices < 2 || choices > optionCount {
+		return 0, false
+	}
+	return choices, true
+}
+
+/*
+Reads how long a poll stays open, like 30m, 2h or 1d12h. Days aren't something go durations know about, so they're taken off the front
+*/
+func parsePollDuration(param string) (time.Duration, bool) {
+	param = strings.ToLower(strings.Replace(param, " ", "", -1))
+	var duration time.Duration
+	if i := strings.Index(param, "d"); i >= 0 {
+		days, err := strconv.Atoi(param[:i])
+		if err != nil || days < 0 || days > int(pollMaxDuration/(24*time.Hour)) {
+			return 0, false
+		}
+		duration = time.Duration(days) * 24 * time.Hour
+		param = param[i+1:]
+	}
+	if param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil {
+			return 0, false
+		}
+		duration += d
+	}
+	if duration < pollMinDuration || duration > pollMaxDuration {
+		return 0, false
+	}
+	return duration, true
+}
+
+/*
+Reads a UTC time for a poll to close at, which has to be within the same limits as a duration
+*/
+func parsePollCloseTime(param string, now time.Time) (time.Time, bool) {
+	t, err := time.Parse(pollClosesLayout, strings.TrimSpace(param))
+	if err != nil {
+		return time.Time{}, false
+	}
+	if d := t.Sub(now); d < pollMinDuration || d > pollMaxDuration {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+/*
+Gets when to remind the channel a poll is about to close. Polls too short to be worth a reminder get the zero time
+*/
+func pollRemindTime(opened time.Time, closesAt time.Time) time.Time {
+	lead := closesAt.Sub(opened) / 4
+	if lead > pollMaxReminderLead {
+		lead = pollMaxReminderLead
+	}
+	if lead < time.Minute {
+		return time.Time{}
+	}
+	return closesAt.Add(-lead)
+}
+
+/*
+Rounds the time left on a poll to a readable amount, like "2 hours" or "15 minutes"
+*/
+func pollTimeLeftString(d time.Duration) string {
+	minutes := int((d + 30*time.Second) / time.Minute)
+	switch {
+	case minutes >= 24*60:
+		return pluralize(minutes/(24*60), "day")
+	case minutes >= 60:
+		return pluralize(minutes/60, "hour")
+	case minutes <= 1:
+		return "1 minute"
+	default:
+		return pluralize(minutes, "minute")
+	}
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.Itoa(n) + " " + unit + "s"
 }
 
 func createPollOptions(options []string) []*db.PollOption {
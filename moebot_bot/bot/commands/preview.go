@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+type PreviewCommand struct {
+	ComPrefix string
+}
+
+func (pc *PreviewCommand) Execute(pack *CommPackage) {
+	server, err := db.ServerQueryOrInsert(pack.guild.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading server information. This is an issue with moebot not discord.")
+		return
+	}
+	if len(pack.params) < 1 || strings.EqualFold(pack.params[0], "welcome") {
+		if !server.WelcomeMessage.Valid {
+			pack.session.ChannelMessageSend(pack.channel.ID, "This server doesn't have a welcome message. Set one with `"+pc.ComPrefix+
+				" server WelcomeMessage <message>`.")
+			return
+		}
+		err = SendWelcomeMessage(pack.session, pack.channel.ID, server, pack.message.Author, pack.guild)
+		if err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I couldn't send the welcome message preview. Make sure the embed image is a valid URL.")
+		}
+	} else if strings.EqualFold(pack.params[0], "rules") {
+		pack.session.ChannelMessageSend(pack.channel.ID, RenderRuleAgreementReply(server, pack.message.Author, pack.guild))
+	} else {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I can only preview `welcome` or `rules` messages.")
+	}
+}
+
+func (pc *PreviewCommand) GetPermLevel() db.Permission {
+	return db.PermMod
+}
+
+func (pc *PreviewCommand) GetCommandKeys() []string {
+	return []string{"PREVIEW"}
+}
+
+func (pc *PreviewCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s preview [welcome|rules]` - Master/Mod. Shows what the welcome message or rule agreement reply looks like for you.", commPrefix)
+}
@@ -7,12 +7,16 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/bwmarrin/discordgo"
 	"github.com/camd67/moebot/moebot_bot/bot/permissions"
 	"github.com/camd67/moebot/moebot_bot/util"
 
 	"github.com/camd67/moebot/moebot_bot/util/db"
 )
 
+// how many of the latest point adjustments are shown on a profile
+const profileAdjustmentCount = 3
+
 type ProfileCommand struct {
 	MasterId string
 }
@@ -24,13 +28,32 @@ func (pc *ProfileCommand) Execute(pack *CommPackage) {
 		return
 	}
 
+	// anyone can look up someone else's profile by mentioning them
+	user := pack.message.Author
+	member := pack.member
+	title := user.Mention()
+	if len(pack.message.Mentions) == 1 && pack.message.Mentions[0].ID != user.ID {
+		user = pack.message.Mentions[0]
+		var err error
+		member, err = pack.session.State.Member(pack.guild.ID, user.ID)
+		if err != nil {
+			member, err = pack.session.GuildMember(pack.guild.ID, user.ID)
+			if err != nil {
+				pack.session.ChannelMessageSend(pack.message.ChannelID, "Sorry, "+user.Username+" isn't a member of this server.")
+				return
+			}
+		}
+		// don't ping someone just because their profile was looked at
+		title = util.MakeStringBold(user.Username)
+	}
+
 	// technically we'll already have a user + server at this point, but may not have a usr. Still create if necessary
 	server, err := db.ServerQueryOrInsert(pack.guild.ID)
-	_, err = db.UserQueryOrInsert(pack.message.Author.ID)
-	usr, err := db.UserServerRankQuery(pack.message.Author.ID, pack.guild.ID)
+	_, err = db.UserQueryOrInsert(user.ID)
+	usr, err := db.UserServerRankQuery(user.ID, pack.guild.ID)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			pack.session.ChannelMessageSend(pack.message.ChannelID, "Sorry, there was an issue getting your information!")
+			pack.session.ChannelMessageSend(pack.message.ChannelID, "Sorry, there was an issue getting that information!")
 			return
 		} else {
 			// ErrNoRows. Overwrite the usr value, so we don't accidentally get an NPE later
@@ -38,18 +61,39 @@ func (pc *ProfileCommand) Execute(pack *CommPackage) {
 		}
 	}
 	var message bytes.Buffer
-	message.WriteString(pack.message.Author.Mention())
+	message.WriteString(title)
 	message.WriteString("'s profile:")
+	tiers, err := db.RankTierQueryServer(server.Id)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.message.ChannelID, "Sorry, there was an issue getting this server's rank tiers!")
+		return
+	}
 	message.WriteString("\nRank: ")
 	if usr != nil {
-		message.WriteString(convertRankToString(usr.Rank, server.VeteranRank))
+		message.WriteString(convertRankToString(usr.Rank, tiers))
+		message.WriteString("\nPoints: ")
+		message.WriteString(rankProgressString(usr.Rank, tiers))
+		adjustments, err := db.RankEventQueryAdjustments(server.Id, usr.UserId, profileAdjustmentCount)
+		if err == nil && len(adjustments) > 0 {
+			message.WriteString("\nRecent adjustments:")
+			for _, a := range adjustments {
+				actorName := "a mod"
+				if a.ActorUid.Valid {
+					if actor, err := pack.session.State.Member(pack.guild.ID, a.ActorUid.String); err == nil && actor.User != nil {
+						actorName = actor.User.Username
+					}
+				}
+				message.WriteString("\n")
+				message.WriteString(rankAdjustmentString(a, actorName))
+			}
+		}
 	} else {
 		message.WriteString("Unranked")
 	}
 	message.WriteString("\nPermission Level: ")
-	message.WriteString(util.MakeStringCode(pc.getPermissionLevel(pack)))
+	message.WriteString(util.MakeStringCode(pc.getPermissionLevel(pack, user.ID, member)))
 	message.WriteString("\nServer join date: ")
-	t, err := time.Parse(time.RFC3339Nano, pack.member.JoinedAt)
+	t, err := time.Parse(time.RFC3339Nano, member.JoinedAt)
 	if err != nil {
 		message.WriteString(util.MakeStringCode("Unknown"))
 	} else {
@@ -58,15 +102,15 @@ func (pc *ProfileCommand) Execute(pack *CommPackage) {
 	pack.session.ChannelMessageSend(pack.message.ChannelID, message.String())
 }
 
-func (pc *ProfileCommand) getPermissionLevel(pack *CommPackage) string {
+func (pc *ProfileCommand) getPermissionLevel(pack *CommPackage, userUid string, member *discordgo.Member) string {
 	// special checks for certain roles that aren't in the database
-	if pack.message.Author.ID == pc.MasterId {
+	if userUid == pc.MasterId {
 		return db.SprintPermission(db.PermMaster)
-	} else if permissions.IsGuildOwner(pack.guild, pack.message.Author.ID) {
+	} else if permissions.IsGuildOwner(pack.guild, userUid) {
 		return db.SprintPermission(db.PermGuildOwner)
 	}
 
-	perms := db.RoleQueryPermission(pack.member.Roles)
+	perms := db.RoleQueryPermission(member.Roles)
 	highestPerm := db.PermAll
 	// Find the highest permission level this user has
 	for _, userPerm := range perms {
@@ -77,39 +121,57 @@ func (pc *ProfileCommand) getPermissionLevel(pack *CommPackage) string {
 	return db.GetPermissionString(highestPerm)
 }
 
-func convertRankToString(rank int, serverMax sql.NullInt64) (rankString string) {
-	if !serverMax.Valid {
-		// no server max? just give back the rank itself
+/*
+Shows a server's rank ladder, with the tiers the user has passed crossed out and the one they're at in bold
+*/
+func convertRankToString(rank int, tiers []db.RankTier) (rankString string) {
+	if len(tiers) == 0 {
+		// no ladder? just give back the rank itself
 		return strconv.Itoa(rank)
 	}
-	// naming strategy: every 1% till 10%, then every 2% until 30%, then every 3% until 60% then every 4% until 100%, then every 100% forever
-	rankPrefixes := []string{"Newcomer", "Apprentice", "Rookie", "Regular", "Veteran"}
 	rankSeparator := " --> "
-	percent := float64(rank) / float64(serverMax.Int64) * 100.0
-	var rankPrefixIndex int
-	var rankSuffix int
-	if percent < 10 {
-		rankSuffix = int(percent / 2.0)
-		rankPrefixIndex = 0
-	} else if percent < 30 {
-		rankSuffix = int((percent - 10) / 4.0)
-		rankPrefixIndex = 1
-	} else if percent < 60 {
-		rankSuffix = int((percent - 30) / 6.0)
-		rankPrefixIndex = 2
-	} else if percent < 100 {
-		rankSuffix = int((percent - 60) / 8.0)
-		rankPrefixIndex = 3
-	} else {
-		rankSuffix = int((percent - 100) / 100)
-		rankPrefixIndex = 4
+	rankNames := make([]string, len(tiers))
+	currentIndex := -1
+	for i, tier := range tiers {
+		rankNames[i] = tier.Name
+		if rank >= tier.Threshold {
+			currentIndex = i
+		}
 	}
-	if rankSuffix != 0 {
-		rankPrefixes[rankPrefixIndex] = util.MakeStringBold(rankPrefixes[rankPrefixIndex] + " " + strconv.Itoa(rankSuffix))
-	} else {
-		rankPrefixes[rankPrefixIndex] = util.MakeStringBold(rankPrefixes[rankPrefixIndex])
+	if currentIndex >= 0 {
+		rankNames[currentIndex] = util.MakeStringBold(rankNames[currentIndex])
+	}
+	return convertToEmphasizedRankString(rankNames, currentIndex, rankSeparator)
+}
+
+/*
+Describes how far the user is from the next tier on the ladder
+*/
+func rankProgressString(rank int, tiers []db.RankTier) string {
+	_, next := currentRankTier(tiers, rank)
+	if next == nil {
+		if len(tiers) == 0 {
+			return strconv.Itoa(rank)
+		}
+		return strconv.Itoa(rank) + ", the highest tier!"
+	}
+	progress := rank * 100 / next.Threshold
+	if progress < 0 {
+		// mods can take someone below zero
+		progress = 0
+	}
+	return fmt.Sprintf("%d, %d more to reach %s (%d%%)", rank, next.Threshold-rank, next.Name, progress)
+}
+
+/*
+Describes a mod's change to someone's points, without pinging the mod
+*/
+func rankAdjustmentString(a db.RankAdjustment, actorName string) string {
+	points := strconv.Itoa(a.Points)
+	if a.Points > 0 {
+		points = "+" + points
 	}
-	return convertToEmphasizedRankString(rankPrefixes, rankPrefixIndex, rankSeparator)
+	return util.MakeStringCode(points) + " by " + actorName + " on " + a.CreatedAt.Format("2006-01-02") + ": " + a.Reason
 }
 
 /*
@@ -140,5 +202,5 @@ func (pc *ProfileCommand) GetCommandKeys() []string {
 }
 
 func (pc *ProfileCommand) GetCommandHelp(commPrefix string) string {
-	return fmt.Sprintf("`%[1]s profile` - Displays your server profile", commPrefix)
+	return fmt.Sprintf("`%[1]s profile [@user]` - Displays your server profile, or someone else's", commPrefix)
 }
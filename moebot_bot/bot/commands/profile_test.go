@@ -1,49 +1,76 @@
 package commands
 
 import (
-	"database/sql"
 	"testing"
+	"time"
+
+	"github.com/camd67/moebot/moebot_bot/util/db"
 )
 
+var testRankTiers = []db.RankTier{
+	{Name: "Newcomer", Threshold: 10},
+	{Name: "Regular", Threshold: 100},
+	{Name: "Veteran", Threshold: 500},
+}
+
 func TestProfileCommand_ConvertRankToString(t *testing.T) {
 	checks := []struct {
-		rank      int
-		serverMax sql.NullInt64
-		out       string
+		rank  int
+		tiers []db.RankTier
+		out   string
 	}{
-		// I don't like making this hard coded... but it works...
-		// Check each one 0 - 10
-		{0, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{1, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{2, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer 1** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{3, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer 1** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{4, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer 2** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{5, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer 2** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{6, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer 3** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{7, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer 3** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{8, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer 4** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		{9, sql.NullInt64{Int64: 100, Valid: true}, "**Newcomer 4** --> Apprentice --> Rookie --> Regular --> Veteran"},
-		// then check just every 1st character
-		{10, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> **Apprentice** --> Rookie --> Regular --> Veteran"},
-		{11, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> **Apprentice** --> Rookie --> Regular --> Veteran"},
-		// also check some funky numbers
-		{7, sql.NullInt64{Int64: 63, Valid: true}, "~~Newcomer~~ --> **Apprentice** --> Rookie --> Regular --> Veteran"},
-		{27, sql.NullInt64{Int64: 243, Valid: true}, "~~Newcomer~~ --> **Apprentice** --> Rookie --> Regular --> Veteran"},
-		{12, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> **Apprentice** --> Rookie --> Regular --> Veteran"},
-		{13, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> **Apprentice** --> Rookie --> Regular --> Veteran"},
-		{14, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> **Apprentice 1** --> Rookie --> Regular --> Veteran"},
-		{30, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> ~~Apprentice~~ --> **Rookie** --> Regular --> Veteran"},
-		{60, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> ~~Apprentice~~ --> ~~Rookie~~ --> **Regular** --> Veteran"},
-		{100, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> ~~Apprentice~~ --> ~~Rookie~~ --> ~~Regular~~ --> **Veteran**"},
-		{200, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> ~~Apprentice~~ --> ~~Rookie~~ --> ~~Regular~~ --> **Veteran 1**"},
-		{300, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> ~~Apprentice~~ --> ~~Rookie~~ --> ~~Regular~~ --> **Veteran 2**"},
+		// no ladder, just the points
+		{0, nil, "0"},
+		{250, nil, "250"},
+		{0, testRankTiers, "Newcomer --> Regular --> Veteran"},
+		{9, testRankTiers, "Newcomer --> Regular --> Veteran"},
+		{10, testRankTiers, "**Newcomer** --> Regular --> Veteran"},
+		{99, testRankTiers, "**Newcomer** --> Regular --> Veteran"},
+		{100, testRankTiers, "~~Newcomer~~ --> **Regular** --> Veteran"},
+		{500, testRankTiers, "~~Newcomer~~ --> ~~Regular~~ --> **Veteran**"},
 		// make sure the last rank keeps going
-		{1500, sql.NullInt64{Int64: 100, Valid: true}, "~~Newcomer~~ --> ~~Apprentice~~ --> ~~Rookie~~ --> ~~Regular~~ --> **Veteran 14**"},
+		{1500, testRankTiers, "~~Newcomer~~ --> ~~Regular~~ --> **Veteran**"},
 	}
 	for _, check := range checks {
-		message := convertRankToString(check.rank, check.serverMax)
+		message := convertRankToString(check.rank, check.tiers)
 		if message != check.out {
 			t.Errorf("Rank to string was incorrect, got: %s, want: %s.", message, check.out)
 		}
 	}
 }
+
+func TestProfileCommand_RankProgressString(t *testing.T) {
+	checks := []struct {
+		rank  int
+		tiers []db.RankTier
+		out   string
+	}{
+		{50, nil, "50"},
+		{0, testRankTiers, "0, 10 more to reach Newcomer (0%)"},
+		{-20, testRankTiers, "-20, 30 more to reach Newcomer (0%)"},
+		{50, testRankTiers, "50, 50 more to reach Regular (50%)"},
+		{499, testRankTiers, "499, 1 more to reach Veteran (99%)"},
+		{500, testRankTiers, "500, the highest tier!"},
+	}
+	for _, check := range checks {
+		if res := rankProgressString(check.rank, check.tiers); res != check.out {
+			t.Errorf("Rank progress was incorrect, got: %s, want: %s.", res, check.out)
+		}
+	}
+}
+
+func TestProfileCommand_RankAdjustmentString(t *testing.T) {
+	createdAt := time.Date(2018, 5, 4, 12, 0, 0, 0, time.UTC)
+	checks := []struct {
+		adjustment db.RankAdjustment
+		out        string
+	}{
+		{db.RankAdjustment{Points: 50, Reason: "won the art contest", CreatedAt: createdAt}, "`+50` by moe on 2018-05-04: won the art contest"},
+		{db.RankAdjustment{Points: -200, Reason: "point farming", CreatedAt: createdAt}, "`-200` by moe on 2018-05-04: point farming"},
+	}
+	for _, check := range checks {
+		if res := rankAdjustmentString(check.adjustment, "moe"); res != check.out {
+			t.Errorf("Rank adjustment was incorrect, got: %s, want: %s.", res, check.out)
+		}
+	}
+}
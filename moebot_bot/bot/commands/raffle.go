@@ -26,8 +26,7 @@ func (rc *RaffleCommand) Execute(pack *CommPackage) {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, the raffle has ended!")
 		return
 	}
-	// Salt
-	if pack.guild.ID != "93799773856862208" {
+	if !db.AccessListContains(db.AccessListRaffleGuild, pack.guild.ID) {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Raffles are not enabled in this server! Speak to Salt to get your server added to the raffle!")
 		return
 	}
@@ -0,0 +1,359 @@
+package commands
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/bot/permissions"
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const (
+	rankChartDefaultDays = 30
+	rankChartMaxDays     = 365
+)
+
+/*
+Lets mods correct members' points, for things like event prizes or point farming. Every change is recorded with who made it and why.
+Anyone can chart their points over time
+*/
+type RankCommand struct {
+	ComPrefix string
+	MasterId  string
+	Checker   permissions.PermissionChecker
+}
+
+func (rc *RankCommand) Execute(pack *CommPackage) {
+	if len(pack.params) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, rc.GetCommandHelp(rc.ComPrefix))
+		return
+	}
+	server, err := db.ServerQueryOrInsert(pack.guild.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading server information. This is an issue with moebot not discord.")
+		return
+	}
+	if strings.EqualFold(pack.params[0], "chart") {
+		rc.chart(pack, server)
+		return
+	}
+	// everything but charts changes points, which only mods can do
+	if !rc.Checker.HasModPerm(pack.message.Author.ID, pack.member.Roles, pack.guild) {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you don't have a high enough permission level to access this command.")
+		return
+	}
+	if len(pack.params) < 2 {
+		pack.session.ChannelMessageSend(pack.channel.ID, rc.GetCommandHelp(rc.ComPrefix))
+		return
+	}
+	switch strings.ToUpper(pack.params[0]) {
+	case "GIVE", "TAKE", "SET":
+		rc.adjust(pack, server)
+	case "RESET":
+		rc.reset(pack, server)
+	case "TRANSFER":
+		rc.transfer(pack, server)
+	default:
+		pack.session.ChannelMessageSend(pack.channel.ID, rc.GetCommandHelp(rc.ComPrefix))
+	}
+}
+
+func (rc *RankCommand) adjust(pack *CommPackage, server db.Server) {
+	action := strings.ToLower(pack.params[0])
+	if len(pack.params) < 4 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a user, a number of points and a reason. Example: `"+rc.ComPrefix+
+			" rank "+action+" @user 50 won the art contest`")
+		return
+	}
+	target, ok := rc.loadTarget(pack, pack.params[1])
+	if !ok {
+		return
+	}
+	points, err := strconv.Atoi(pack.params[2])
+	if err != nil || points < 0 || (points == 0 && action != "set") {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a number of points greater than 0")
+		return
+	}
+	reason, ok := rc.loadReason(pack, pack.params[3:])
+	if !ok {
+		return
+	}
+	if action == "take" {
+		points = -points
+	}
+	previous, u, err := db.UserServerRankAdjust(server.Id, target.Id, points, action == "set", pack.user.Id, reason)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error updating points. This is an issue with moebot not discord.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, rc.memberName(pack, target.UserUid)+" went from "+strconv.Itoa(previous)+" to "+
+		strconv.Itoa(u.Rank)+" points.")
+	rc.syncTier(pack, u, target.UserUid)
+}
+
+func (rc *RankCommand) reset(pack *CommPackage, server db.Server) {
+	if len(pack.params) < 3 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a user and a reason. Example: `"+rc.ComPrefix+" rank reset @user point farming`")
+		return
+	}
+	target, ok := rc.loadTarget(pack, pack.params[1])
+	if !ok {
+		return
+	}
+	reason, ok := rc.loadReason(pack, pack.params[2:])
+	if !ok {
+		return
+	}
+	previous, u, err := db.UserServerRankAdjust(server.Id, target.Id, 0, true, pack.user.Id, reason)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error resetting points. This is an issue with moebot not discord.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, "Reset "+rc.memberName(pack, target.UserUid)+"'s points, they had "+strconv.Itoa(previous)+".")
+	rc.syncTier(pack, u, target.UserUid)
+}
+
+func (rc *RankCommand) transfer(pack *CommPackage, server db.Server) {
+	if len(pack.params) < 5 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide who to take points from, who to give them to, a number of points and a "+
+			"reason. Example: `"+rc.ComPrefix+" rank transfer @old @new 500 moved to a new account`")
+		return
+	}
+	from, ok := rc.loadTarget(pack, pack.params[1])
+	if !ok {
+		return
+	}
+	to, ok := rc.loadTarget(pack, pack.params[2])
+	if !ok {
+		return
+	}
+	if from.Id == to.Id {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, points can't be transferred to the same user.")
+		return
+	}
+	points, err := strconv.Atoi(pack.params[3])
+	if err != nil || points < 1 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a number of points greater than 0")
+		return
+	}
+	reason, ok := rc.loadReason(pack, pack.params[4:])
+	if !ok {
+		return
+	}
+	fromRank, toRank, transferred, err := db.UserServerRankTransfer(server.Id, from.Id, to.Id, points, pack.user.Id, reason)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error transferring points. This is an issue with moebot not discord.")
+		return
+	}
+	if !transferred {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+rc.memberName(pack, from.UserUid)+" only has "+strconv.Itoa(fromRank.Rank)+" points.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, "Moved "+strconv.Itoa(points)+" points from "+rc.memberName(pack, from.UserUid)+" to "+
+		rc.memberName(pack, to.UserUid)+". They now have "+strconv.Itoa(fromRank.Rank)+" and "+strconv.Itoa(toRank.Rank)+" points.")
+	rc.syncTier(pack, fromRank, from.UserUid)
+	rc.syncTier(pack, toRank, to.UserUid)
+}
+
+/*
+Draws a member's points over the last however many days, with the server's tiers drawn in
+*/
+func (rc *RankCommand) chart(pack *CommPackage, server db.Server) {
+	userUid := pack.message.Author.ID
+	days := rankChartDefaultDays
+	for _, param := range pack.params[1:] {
+		if d, ok := parseRankChartDays(param); ok {
+			days = d
+		} else if uid, valid := util.ExtractUserIdFromString(param); valid {
+			userUid = uid
+		} else {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I don't know what `"+param+"` means. Please provide a user, or a number of days "+
+				"up to "+strconv.Itoa(rankChartMaxDays)+" like `30d`.")
+			return
+		}
+	}
+	usr, err := db.UserServerRankQuery(userUid, pack.guild.ID)
+	if err == sql.ErrNoRows {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+rc.memberName(pack, userUid)+" hasn't earned any points yet.")
+		return
+	} else if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading points. This is an issue with moebot not discord.")
+		return
+	}
+	tiers, err := db.RankTierQueryServer(server.Id)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading the rank tiers. This is an issue with moebot not discord.")
+		return
+	}
+	end := time.Now()
+	start := end.AddDate(0, 0, -days)
+	history, err := db.RankEventQueryDays(server.Id, usr.UserId, start)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading point history. This is an issue with moebot not discord.")
+		return
+	}
+	points := rankChartPoints(history, usr.Rank, start, end)
+	name := userUid
+	if member, err := moeDiscord.GetMember(userUid, pack.guild.ID, pack.session); err == nil && member != nil && member.User != nil {
+		name = member.User.Username
+	}
+	chart, err := util.MakeLineChart(name+"'s points, last "+strconv.Itoa(days)+" days", points, rankChartThresholds(tiers, points), start, end)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error drawing the chart. This is an issue with moebot not discord.")
+		return
+	}
+	pack.session.ChannelMessageSendComplex(pack.channel.ID, &discordgo.MessageSend{
+		File: &discordgo.File{
+			Name:        "rank.png",
+			ContentType: "image/png",
+			Reader:      bytes.NewReader(chart),
+		},
+	})
+}
+
+/*
+Reads a number of days like 30d, up to the most a chart can show
+*/
+func parseRankChartDays(param string) (days int, ok bool) {
+	if !strings.HasSuffix(strings.ToLower(param), "d") {
+		return 0, false
+	}
+	days, err := strconv.Atoi(param[:len(param)-1])
+	if err != nil || days < 1 || days > rankChartMaxDays {
+		return 0, false
+	}
+	return days, true
+}
+
+/*
+Turns daily point changes into a running total from start to end. The total at the start is worked out backwards from the member's
+current points, so history from before changes were recorded shows up as a flat line
+*/
+func rankChartPoints(history []db.RankEventDay, rank int, start time.Time, end time.Time) []util.ChartPoint {
+	total := rank
+	for _, d := range history {
+		total -= d.Points
+	}
+	points := []util.ChartPoint{{Time: start, Value: total}}
+	for _, d := range history {
+		total += d.Points
+		// the first day's changes may have started before the chart does
+		day := d.Day
+		if day.Before(start) {
+			day = start
+		}
+		points = append(points, util.ChartPoint{Time: day, Value: total})
+	}
+	return append(points, util.ChartPoint{Time: end, Value: rank})
+}
+
+/*
+Gets the tiers worth drawing on a chart, every tier the points reach plus the next one to aim for
+*/
+func rankChartThresholds(tiers []db.RankTier, points []util.ChartPoint) (thresholds []util.ChartThreshold) {
+	highest := 0
+	for _, p := range points {
+		if p.Value > highest {
+			highest = p.Value
+		}
+	}
+	for _, t := range tiers {
+		thresholds = append(thresholds, util.ChartThreshold{Name: t.Name, Value: t.Threshold})
+		if t.Threshold > highest {
+			break
+		}
+	}
+	return
+}
+
+/*
+Updates the tier a member has been promoted to after their points change. Anyone who dropped below a tier will be announced again when
+they get back to it, and anyone who was pushed past one is announced now
+*/
+func (rc *RankCommand) syncTier(pack *CommPackage, u db.UserServerRank, userUid string) {
+	tiers, err := db.RankTierQueryServer(u.ServerId)
+	if err != nil {
+		return
+	}
+	tierThreshold, reached := rankTierSync(tiers, u.Rank, u.TierThreshold)
+	if len(reached) > 0 {
+		// the promotion stays pending until it can be announced, rather than being used up with nobody told
+		server, err := db.ServerQueryOrInsert(pack.guild.ID)
+		if err != nil || !noticeDeliverable(server, db.NoticePromotion) {
+			return
+		}
+	}
+	if tierThreshold == u.TierThreshold || db.UserServerRankSetTier(u.Id, tierThreshold) != nil || len(reached) == 0 {
+		return
+	}
+	notifyRankPromotions(pack.session, []db.UserServerRankWrapper{{
+		UserUid:   userUid,
+		ServerUid: pack.guild.ID,
+		Rank:      u.Rank,
+		Tiers:     reached,
+	}}, rc.ComPrefix, rc.MasterId)
+}
+
+func (rc *RankCommand) loadTarget(pack *CommPackage, param string) (user db.UserProfile, ok bool) {
+	userUid, valid := util.ExtractUserIdFromString(param)
+	if !valid {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, `"+param+"` isn't a user. Please mention them or provide their ID.")
+		return
+	}
+	isMember, err := moeDiscord.IsGuildMember(userUid, pack.guild.ID, pack.session)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error checking if that user is in this server. This is an issue with moebot not discord.")
+		return
+	}
+	if !isMember {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+util.MakeStringCode(userUid)+" isn't a member of this server.")
+		return
+	}
+	user, err = db.UserQueryOrInsert(userUid)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading that user. This is an issue with moebot not discord.")
+		return
+	}
+	return user, true
+}
+
+func (rc *RankCommand) loadReason(pack *CommPackage, params []string) (reason string, ok bool) {
+	reason = strings.Join(params, " ")
+	if len(reason) > db.RankEventReasonMaxLength {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, reasons have a max length of: "+db.RankEventReasonMaxLengthString)
+		return
+	}
+	return reason, true
+}
+
+/*
+Gets a member's name without pinging them, falling back to their ID if they aren't in the server anymore
+*/
+func (rc *RankCommand) memberName(pack *CommPackage, userUid string) string {
+	if member, err := moeDiscord.GetMember(userUid, pack.guild.ID, pack.session); err == nil && member != nil && member.User != nil {
+		return util.MakeStringBold(member.User.Username)
+	}
+	return util.MakeStringCode(userUid)
+}
+
+func (rc *RankCommand) GetPermLevel() db.Permission {
+	return db.PermAll
+}
+
+func (rc *RankCommand) GetCommandKeys() []string {
+	return []string{"RANK"}
+}
+
+func (rc *RankCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s rank chart [@user] [days, like 30d]` - Draws a chart of your points over time, or someone else's. "+
+		"`%[1]s rank give|take|set <@user> <points> <reason>` - Master/Mod Changes a member's points. "+
+		"`%[1]s rank reset <@user> <reason>` takes all of them away and `%[1]s rank transfer <@from> <@to> <points> <reason>` moves them to "+
+		"someone else. Members can see recent changes on their profile.", commPrefix)
+}
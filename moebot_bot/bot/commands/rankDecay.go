@@ -0,0 +1,253 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const (
+	// Members decay once for every week they go without earning points
+	rankDecayPeriod   = 7 * 24 * time.Hour
+	rankDecayInterval = time.Hour
+)
+
+/*
+What decaying a single member does. Either their points drop, or they get warned that the next drop demotes them
+*/
+type rankDecayStep struct {
+	member        db.UserServerRankDecay
+	newRank       int
+	tierThreshold int
+	// Tiers the member loses, lowest first. Only set when the server demotes
+	lost []db.RankTier
+	// Whether this week only warns the member, since the decay would demote them
+	warnOnly bool
+}
+
+/*
+Lowers inactive members' points each week for servers that turn decay on, and shows mods what the next run would do
+*/
+type RankDecayCommand struct {
+	ComPrefix string
+	MasterId  string
+}
+
+func (dc *RankDecayCommand) Setup(session *discordgo.Session) {
+	go dc.decayServers(session)
+}
+
+func (dc *RankDecayCommand) Execute(pack *CommPackage) {
+	server, err := db.ServerQueryOrInsert(pack.guild.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading server information. This is an issue with moebot not discord.")
+		return
+	}
+	if !server.DecayPercent.Valid {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Rank decay is off for this server. Use `"+dc.ComPrefix+" server DecayPercent <percent>` "+
+			"to have inactive members lose points each week.")
+		return
+	}
+	steps, err := dc.planServer(server, time.Now())
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error checking for inactive members. This is an issue with moebot not discord.")
+		return
+	}
+	title := "Rank decay: " + strconv.Itoa(int(server.DecayPercent.Int64)) + "% per inactive week, down to " +
+		strconv.Itoa(int(server.DecayFloor.Int64)) + " points"
+	if server.DecayDemote {
+		title += ", with demotion"
+	}
+	if len(steps) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, title+". Nobody would decay if it ran now.")
+		return
+	}
+	var lines []string
+	for _, step := range steps {
+		lines = append(lines, rankListName(step.member.UserUid)+" "+rankDecayStepString(step))
+	}
+	pack.session.ChannelMessageSendEmbed(pack.channel.ID, &discordgo.MessageEmbed{
+		Title:       title,
+		Description: limitMessageLines("This is only a preview, nothing has changed yet. If decay ran now:", lines),
+	})
+}
+
+func (dc *RankDecayCommand) decayServers(session *discordgo.Session) {
+	for {
+		guildUids, err := db.ServerQueryDecayGuilds()
+		if err == nil {
+			for _, guildUid := range guildUids {
+				dc.decayServer(session, guildUid)
+			}
+		}
+		time.Sleep(rankDecayInterval)
+	}
+}
+
+func (dc *RankDecayCommand) decayServer(session *discordgo.Session, guildUid string) {
+	server, err := db.ServerQueryOrInsert(guildUid)
+	if err != nil {
+		return
+	}
+	guild, err := moeDiscord.GetGuild(guildUid, session)
+	if err != nil {
+		// can't take roles away or say who's being warned, wait until discord has the guild again
+		return
+	}
+	now := time.Now()
+	steps, err := dc.planServer(server, now)
+	if err != nil {
+		return
+	}
+	decayed := 0
+	for _, step := range steps {
+		if step.warnOnly {
+			if warned, err := db.UserServerRankSetDecayWarned(step.member.Id, now.Add(-rankDecayPeriod)); err == nil && warned {
+				dc.sendWarning(session, guild, step)
+			}
+			continue
+		}
+		applied, err := db.UserServerRankApplyDecay(step.member, server.Id, step.newRank, step.tierThreshold, now.Add(-rankDecayPeriod))
+		if err != nil || !applied {
+			continue
+		}
+		decayed++
+		for _, tier := range step.lost {
+			if !tier.RoleUid.Valid {
+				continue
+			}
+			role := moeDiscord.FindRoleById(guild.Roles, tier.RoleUid.String)
+			member, err := moeDiscord.GetMember(step.member.UserUid, guildUid, session)
+			if role == nil || err != nil || member == nil || !util.StrContains(member.Roles, role.ID, util.CaseSensitive) {
+				continue
+			}
+			if err = RemoveMemberRole(session, guild, step.member.UserUid, role); err != nil {
+				ReportRoleError(session, "", server, err)
+			}
+		}
+	}
+	if decayed > 0 {
+		log.Println("Decayed points for " + strconv.Itoa(decayed) + " inactive members in guild " + guildUid)
+	}
+}
+
+/*
+Works out what decay would do to every inactive member of a server right now
+*/
+func (dc *RankDecayCommand) planServer(server db.Server, now time.Time) (steps []rankDecayStep, err error) {
+	tiers, err := db.RankTierQueryServer(server.Id)
+	if err != nil {
+		return
+	}
+	members, err := db.UserServerRankQueryInactive(server.Id, int(server.DecayFloor.Int64), now.Add(-rankDecayPeriod))
+	if err != nil {
+		return
+	}
+	for _, m := range members {
+		if rankExcludesUser(m.UserUid, dc.MasterId) {
+			continue
+		}
+		step := planRankDecay(m, int(server.DecayPercent.Int64), int(server.DecayFloor.Int64), server.DecayDemote, tiers)
+		if step.warnOnly || step.newRank != m.Rank {
+			steps = append(steps, step)
+		}
+	}
+	return
+}
+
+func (dc *RankDecayCommand) sendWarning(session *discordgo.Session, guild *discordgo.Guild, step rankDecayStep) {
+	dmChannel, err := session.UserChannelCreate(step.member.UserUid)
+	if err != nil {
+		log.Println("Error creating DM channel for rank decay warning", err)
+		return
+	}
+	session.ChannelMessageSend(dmChannel.ID, "Hi! You haven't been active in "+guild.Name+" for a while. If you're still away next week you'll "+
+		"drop to "+strconv.Itoa(step.newRank)+" points and lose "+rankTierNames(step.lost)+". Come say hi to keep them!")
+}
+
+/*
+Works out a single member's decay. Members who'd drop below a tier they reached are warned first when the server demotes, and only
+demoted if they're still inactive a week later
+*/
+func planRankDecay(m db.UserServerRankDecay, percent int, floor int, demote bool, tiers []db.RankTier) rankDecayStep {
+	step := rankDecayStep{
+		member:        m,
+		newRank:       decayedRank(m.Rank, percent, floor),
+		tierThreshold: m.TierThreshold,
+	}
+	if !demote {
+		// they keep their tier, and won't be told they reached it again
+		return step
+	}
+	for _, t := range tiers {
+		if t.Threshold > step.newRank && t.Threshold <= m.TierThreshold {
+			step.lost = append(step.lost, t)
+		}
+	}
+	if len(step.lost) == 0 {
+		return step
+	}
+	if !m.DecayWarned {
+		step.warnOnly = true
+		return step
+	}
+	step.tierThreshold = 0
+	if current, _ := currentRankTier(tiers, step.newRank); current != nil {
+		step.tierThreshold = current.Threshold
+	}
+	return step
+}
+
+/*
+Takes a percent of some points away, always at least one point, without going below the floor
+*/
+func decayedRank(rank int, percent int, floor int) int {
+	if rank <= floor || percent <= 0 {
+		return rank
+	}
+	loss := (rank*percent + 99) / 100
+	if rank-loss < floor {
+		return floor
+	}
+	return rank - loss
+}
+
+func rankDecayStepString(step rankDecayStep) string {
+	if step.warnOnly {
+		return "would be warned before dropping from " + strconv.Itoa(step.member.Rank) + " to " + strconv.Itoa(step.newRank) + " points and losing " +
+			rankTierNames(step.lost)
+	}
+	message := "would drop from " + strconv.Itoa(step.member.Rank) + " to " + strconv.Itoa(step.newRank) + " points"
+	if len(step.lost) > 0 {
+		message += " and lose " + rankTierNames(step.lost)
+	}
+	return message
+}
+
+func rankTierNames(tiers []db.RankTier) string {
+	var names []string
+	for _, t := range tiers {
+		names = append(names, "`"+t.Name+"`")
+	}
+	return strings.Join(names, ", ")
+}
+
+func (dc *RankDecayCommand) GetPermLevel() db.Permission {
+	return db.PermMod
+}
+
+func (dc *RankDecayCommand) GetCommandKeys() []string {
+	return []string{"DECAY"}
+}
+
+func (dc *RankDecayCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s decay` - Master/Mod Shows which inactive members would lose points, or be demoted, the next time rank decay runs. "+
+		"Decay is set up with `%[1]s server DecayPercent`, `DecayFloor` and `DecayDemote`.", commPrefix)
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+func TestRankDecay_DecayedRank(t *testing.T) {
+	checks := []struct {
+		rank    int
+		percent int
+		floor   int
+		out     int
+	}{
+		{100, 10, 0, 90},
+		{105, 10, 0, 94},
+		{5, 10, 0, 4},
+		{0, 10, 0, 0},
+		{100, 10, 95, 95},
+		{90, 10, 100, 90},
+		{100, 100, 20, 20},
+		{100, 0, 0, 100},
+	}
+	for _, c := range checks {
+		if res := decayedRank(c.rank, c.percent, c.floor); res != c.out {
+			t.Errorf("Incorrect decay for %d at %d%% with a floor of %d. Got: %d, expected: %d", c.rank, c.percent, c.floor, res, c.out)
+		}
+	}
+}
+
+func TestRankDecay_PlanRankDecay(t *testing.T) {
+	checks := []struct {
+		member        db.UserServerRankDecay
+		demote        bool
+		newRank       int
+		tierThreshold int
+		lost          []string
+		warnOnly      bool
+	}{
+		{db.UserServerRankDecay{Rank: 520, TierThreshold: 500}, true, 468, 100, []string{"Veteran"}, true},
+		{db.UserServerRankDecay{Rank: 520, TierThreshold: 500, DecayWarned: true}, true, 468, 100, []string{"Veteran"}, false},
+		{db.UserServerRankDecay{Rank: 520, TierThreshold: 500}, false, 468, 500, nil, false},
+		{db.UserServerRankDecay{Rank: 450, TierThreshold: 100}, true, 405, 100, nil, false},
+		{db.UserServerRankDecay{Rank: 105, TierThreshold: 500, DecayWarned: true}, true, 94, 10, []string{"Regular", "Veteran"}, false},
+		{db.UserServerRankDecay{Rank: 10, TierThreshold: 10, DecayWarned: true}, true, 9, 0, []string{"Newcomer"}, false},
+	}
+	for _, c := range checks {
+		step := planRankDecay(c.member, 10, 0, c.demote, testRankTiers)
+		var lost []string
+		for _, tier := range step.lost {
+			lost = append(lost, tier.Name)
+		}
+		if c.warnOnly != step.warnOnly || !reflect.DeepEqual(lost, c.lost) || (!c.warnOnly && (step.newRank != c.newRank || step.tierThreshold != c.tierThreshold)) {
+			t.Errorf("Incorrect decay plan for %+v. Got: %d points at tier %d losing %v (warn %t), expected: %d points at tier %d losing %v (warn %t)",
+				c.member, step.newRank, step.tierThreshold, lost, step.warnOnly, c.newRank, c.tierThreshold, c.lost, c.warnOnly)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+func TestRank_ParseRankChartDays(t *testing.T) {
+	checks := []struct {
+		param string
+		days  int
+		ok    bool
+	}{
+		{"30d", 30, true},
+		{"7D", 7, true},
+		{"365d", 365, true},
+		{"366d", 0, false},
+		{"0d", 0, false},
+		{"30", 0, false},
+		{"d", 0, false},
+		{"<@1234>", 0, false},
+	}
+	for _, c := range checks {
+		if days, ok := parseRankChartDays(c.param); days != c.days || ok != c.ok {
+			t.Errorf("Incorrect days for %s. Got: %d %v, expected: %d %v", c.param, days, ok, c.days, c.ok)
+		}
+	}
+}
+
+func TestRank_RankChartPoints(t *testing.T) {
+	start := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	end := time.Date(2018, 5, 10, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return time.Date(2018, 5, d, 0, 0, 0, 0, time.UTC)
+	}
+	change := func(d int, points int) db.RankEventDay {
+		return db.RankEventDay{Day: day(d), Points: points}
+	}
+	point := func(t time.Time, value int) util.ChartPoint {
+		return util.ChartPoint{Time: t, Value: value}
+	}
+	checks := []struct {
+		history []db.RankEventDay
+		rank    int
+		out     []util.ChartPoint
+	}{
+		{nil, 50, []util.ChartPoint{point(start, 50), point(end, 50)}},
+		{[]db.RankEventDay{change(3, 20), change(5, -5)}, 100, []util.ChartPoint{point(start, 85), point(day(3), 105), point(day(5), 100), point(end, 100)}},
+		{[]db.RankEventDay{change(1, 10)}, 10, []util.ChartPoint{point(start, 0), point(start, 10), point(end, 10)}},
+	}
+	for _, c := range checks {
+		if res := rankChartPoints(c.history, c.rank, start, end); !reflect.DeepEqual(res, c.out) {
+			t.Errorf("Incorrect chart points for %v. Got: %v, expected: %v", c.history, res, c.out)
+		}
+	}
+}
+
+func TestRank_RankChartThresholds(t *testing.T) {
+	checks := []struct {
+		highest int
+		out     []string
+	}{
+		{5, []string{"Newcomer"}},
+		{10, []string{"Newcomer", "Regular"}},
+		{150, []string{"Newcomer", "Regular", "Veteran"}},
+		{600, []string{"Newcomer", "Regular", "Veteran"}},
+	}
+	for _, c := range checks {
+		var names []string
+		for _, threshold := range rankChartThresholds(testRankTiers, []util.ChartPoint{{Value: 0}, {Value: c.highest}}) {
+			names = append(names, threshold.Name)
+		}
+		if !reflect.DeepEqual(names, c.out) {
+			t.Errorf("Incorrect thresholds for %d points. Got: %v, expected: %v", c.highest, names, c.out)
+		}
+	}
+}
@@ -2,11 +2,11 @@ package commands
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"database/sql"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/camd67/moebot/moebot_bot/bot/permissions"
@@ -18,6 +18,7 @@ import (
 type RoleCommand struct {
 	ComPrefix   string
 	PermChecker permissions.PermissionChecker
+	CodeSigner  *RoleCodeSigner
 }
 
 func (rc *RoleCommand) Execute(pack *CommPackage) {
@@ -26,54 +27,42 @@ func (rc *RoleCommand) Execute(pack *CommPackage) {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading server information!")
 		return
 	}
-	var vetRole *discordgo.Role
-	if server.VeteranRole.Valid {
-		vetRole = moeDiscord.FindRoleById(pack.guild.Roles, server.VeteranRole.String)
+	tiers, err := db.RankTierQueryServer(server.Id)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading the rank tiers. This is an issue with moebot not discord.")
+		return
 	}
 	if len(pack.params) == 0 {
-		printAllRoles(server, vetRole, pack)
+		printAllRoles(server, pack)
 	} else {
 		var role *discordgo.Role
 		var roleGroup db.RoleGroup
 		var dbRole db.Role
 		var confirmCodes []string
-		// TODO: convert this to use the actual veteran name
-		if strings.EqualFold(pack.params[0], "veteran") {
-			// before anything, if the server doesn't have a rank or role bail out
-			if !server.VeteranRank.Valid || !server.VeteranRole.Valid {
-				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, this server isn't setup to handle veteran role yet! Contact the server admins.")
-				return
-			}
-
-			// make some placeholder veteran role tables
+		if tier := db.RankTierFindName(tiers, pack.params[0]); tier != nil && tier.RoleUid.Valid {
+			// make some placeholder role tables for the tier's role
 			roleGroup = db.RoleGroup{
-				Name: "Veteran",
+				Name: tier.Name,
 				Type: db.GroupTypeExclusive,
 			}
 			dbRole = db.Role{
-				RoleUid: server.VeteranRole.String,
+				RoleUid: tier.RoleUid.String,
 				Trigger: sql.NullString{
-					String: "veteran",
+					String: tier.Name,
 					Valid:  true,
 				},
 			}
 			usr, err := db.UserServerRankQuery(pack.message.Author.ID, pack.guild.ID)
-			var pointCountMessage string
-			if usr != nil {
-				pointCountMessage = fmt.Sprintf("%.2f%% of the way to veteran", float64(usr.Rank)/float64(server.VeteranRank.Int64)*100)
-			} else {
-				pointCountMessage = "Unranked"
-			}
-			if err != nil {
-				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you don't have enough veteran points yet! You're currently: "+pointCountMessage)
-				return
-			}
-			if int64(usr.Rank) >= server.VeteranRank.Int64 {
-				role = vetRole
-			} else {
-				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you don't have enough veteran points yet! You're currently: "+pointCountMessage)
+			if err != nil || usr.Rank < tier.Threshold {
+				pointCountMessage := "Unranked"
+				if err == nil {
+					pointCountMessage = fmt.Sprintf("%d/%d points", usr.Rank, tier.Threshold)
+				}
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you don't have enough points for "+tier.Name+" yet! You're currently: "+
+					pointCountMessage)
 				return
 			}
+			role = moeDiscord.FindRoleById(pack.guild.Roles, tier.RoleUid.String)
 		} else {
 			// load up the trigger to see if it exists, stripping out anything prefixed with - (our security text)
 			var roleNameBuf bytes.Buffer
@@ -110,30 +99,45 @@ func (rc *RoleCommand) Execute(pack *CommPackage) {
 				return
 			}
 		}
+		if role == nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue finding that role in this server. It may have been deleted.")
+			return
+		}
+		// check before asking for any confirmation so users don't go through it for a role we can't give them
+		if err = CheckRoleManageable(pack.session, pack.guild, role); err != nil {
+			ReportRoleError(pack.session, pack.channel.ID, server, err)
+			return
+		}
 		// process the role to see if it has a confirmation message, then decide if we need to bail out or continue to the role update phase
 		if !rc.processRoleConfirmation(dbRole, role, pack, confirmCodes) {
 			return
 		}
 
-		rc.updateUserRoles(pack, role, roleGroup)
+		rc.updateUserRoles(pack, server, role, roleGroup)
 	}
 }
 
 /*
 Actually go through and update the roles for this user based on the given role and role group
 */
-func (rc *RoleCommand) updateUserRoles(pack *CommPackage, role *discordgo.Role, group db.RoleGroup) {
+func (rc *RoleCommand) updateUserRoles(pack *CommPackage, server db.Server, role *discordgo.Role, group db.RoleGroup) {
 	if util.StrContains(pack.member.Roles, role.ID, util.CaseSensitive) {
 		if group.Type == db.GroupTypeExclusiveNoRemove {
 			pack.session.ChannelMessageSend(pack.channel.ID, "You've already got that role! You can change roles but can't remove them in the `"+
 				group.Name+"` group.")
 		} else {
-			pack.session.GuildMemberRoleRemove(pack.guild.ID, pack.message.Author.ID, role.ID)
+			if err := RemoveMemberRole(pack.session, pack.guild, pack.message.Author.ID, role); err != nil {
+				ReportRoleError(pack.session, pack.channel.ID, server, err)
+				return
+			}
 			pack.session.ChannelMessageSend(pack.channel.ID, "Removed role "+role.Name+" for "+pack.message.Author.Mention())
 		}
 	} else {
 		if group.Type == db.GroupTypeAny {
-			pack.session.GuildMemberRoleAdd(pack.guild.ID, pack.message.Author.ID, role.ID)
+			if err := AddMemberRole(pack.session, pack.guild, pack.message.Author.ID, role); err != nil {
+				ReportRoleError(pack.session, pack.channel.ID, server, err)
+				return
+			}
 			pack.session.ChannelMessageSend(pack.channel.ID, "Added role "+role.Name+" for "+pack.message.Author.Mention())
 		} else {
 			// This case needs to check to see if the user has any other roles from this group, since they may not be allowed to add more
@@ -145,7 +149,10 @@ func (rc *RoleCommand) updateUserRoles(pack *CommPackage, role *discordgo.Role,
 				return
 			}
 			// we'll always be adding a role here
-			pack.session.GuildMemberRoleAdd(pack.guild.ID, pack.message.Author.ID, role.ID)
+			if err := AddMemberRole(pack.session, pack.guild, pack.message.Author.ID, role); err != nil {
+				ReportRoleError(pack.session, pack.channel.ID, server, err)
+				return
+			}
 			var message bytes.Buffer
 			message.WriteString("Added role `")
 			message.WriteString(role.Name)
@@ -153,10 +160,18 @@ func (rc *RoleCommand) updateUserRoles(pack *CommPackage, role *discordgo.Role,
 			message.WriteString(pack.message.Author.Mention())
 			// we should only find one other role, but just in case
 			foundOtherRole := false
+			var failedRemovals []error
 			for _, dbGroupRole := range fullGroupRoles {
 				if util.StrContains(pack.member.Roles, dbGroupRole.RoleUid, util.CaseSensitive) {
 					roleToRemove := moeDiscord.FindRoleById(pack.guild.Roles, dbGroupRole.RoleUid)
+					if roleToRemove == nil {
+						continue
+					}
 					// The user already has this role, remove it and tell them
+					if err := RemoveMemberRole(pack.session, pack.guild, pack.message.Author.ID, roleToRemove); err != nil {
+						failedRemovals = append(failedRemovals, err)
+						continue
+					}
 					if !foundOtherRole {
 						message.WriteString("\nAlso removed:")
 						foundOtherRole = true
@@ -164,10 +179,12 @@ func (rc *RoleCommand) updateUserRoles(pack *CommPackage, role *discordgo.Role,
 					message.WriteString(" `")
 					message.WriteString(roleToRemove.Name)
 					message.WriteString("`")
-					pack.session.GuildMemberRoleRemove(pack.guild.ID, pack.message.Author.ID, dbGroupRole.RoleUid)
 				}
 			}
 			pack.session.ChannelMessageSend(pack.channel.ID, message.String())
+			for _, err := range failedRemovals {
+				ReportRoleError(pack.session, pack.channel.ID, server, err)
+			}
 		}
 	}
 }
@@ -191,28 +208,55 @@ func (rc *RoleCommand) processRoleConfirmation(dbRole db.Role, roleToAdd *discor
 		pack.session.ChannelMessageDelete(pack.channel.ID, pack.message.ID)
 
 		// Optionally check for a security answer, since we can have just a confirmation code and no security
-		if dbRole.ConfirmationSecurityAnswer.Valid && dbRole.ConfirmationSecurityAnswer.String != "" {
+		hasSecurity := dbRole.ConfirmationSecurityAnswer.Valid && dbRole.ConfirmationSecurityAnswer.String != ""
+		if hasSecurity {
 			if len(confirmCodes) != 2 {
 				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you need to insert a confirmation code and security answer to access "+
 					"this role. Use `"+rc.ComPrefix+" "+dbRole.Trigger.String+"` to receive a DM containing detailed instructions.")
 				return false
 			}
-			if !util.StrContains(confirmCodes, dbRole.ConfirmationSecurityAnswer.String, util.CaseSensitive) ||
-				!util.StrContains(confirmCodes, "-"+rc.getRoleCode(roleToAdd.ID, pack.message.Author.ID), util.CaseSensitive) {
+			if !util.StrContains(confirmCodes, dbRole.ConfirmationSecurityAnswer.String, util.CaseSensitive) {
 				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you need to insert the correct confirmation code to access this role.")
 				return false
 			}
-		} else {
-			if len(confirmCodes) != 1 {
-				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you need to insert a confirmation code to access this role. Use `"+
-					rc.ComPrefix+" "+dbRole.Trigger.String+"` to receive a DM containing detailed instructions.")
-				return false
+		} else if len(confirmCodes) != 1 {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you need to insert a confirmation code to access this role. Use `"+
+				rc.ComPrefix+" "+dbRole.Trigger.String+"` to receive a DM containing detailed instructions.")
+			return false
+		}
+		var confirmCode string
+		codeErr := errRoleCodeInvalid
+		for _, code := range confirmCodes {
+			if hasSecurity && code == dbRole.ConfirmationSecurityAnswer.String {
+				continue
 			}
-			if !util.StrContains(confirmCodes, "-"+rc.getRoleCode(roleToAdd.ID, pack.message.Author.ID), util.CaseSensitive) {
-				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you need to insert the correct confirmation code to access this role.")
-				return false
+			confirmCode = strings.TrimPrefix(code, "-")
+			codeErr = rc.CodeSigner.VerifyCode(confirmCode, roleToAdd.ID, pack.message.Author.ID, time.Now())
+			if codeErr == nil {
+				break
 			}
 		}
+		if codeErr == errRoleCodeExpired {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, that confirmation code has expired. Use `"+rc.ComPrefix+" "+
+				dbRole.Trigger.String+"` to receive a new one.")
+			return false
+		} else if codeErr != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you need to insert the correct confirmation code to access this role.")
+			return false
+		}
+		firstUse, err := db.RoleCodeUse(strings.ToLower(confirmCode), pack.message.Author.ID, roleToAdd.ID)
+		if err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue checking your confirmation code. This is an issue with moebot "+
+				"and not discord.")
+			return false
+		}
+		if !firstUse {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, that confirmation code has already been used. Use `"+rc.ComPrefix+" "+
+				dbRole.Trigger.String+"` to receive a new one.")
+			return false
+		}
+		// used codes only need to be kept around until they would have expired anyways
+		db.RoleCodeDeleteBefore(time.Now().Add(-rc.CodeSigner.getExpiry() - roleCodeClockSkew))
 	}
 	return true
 }
@@ -222,17 +266,12 @@ func (rc *RoleCommand) sendConfirmationMessage(session *discordgo.Session, chann
 		// could log error creating user channel, but seems like it'll clutter the logs for a valid scenario..
 		return err
 	}
-	message := role.ConfirmationMessage.String + "\nYour confirmation code: `-" + rc.getRoleCode(role.RoleUid, user.ID) + "`"
+	message := role.ConfirmationMessage.String + "\nYour confirmation code: `-" + rc.CodeSigner.NewCode(role.RoleUid, user.ID, time.Now()) + "`" +
+		"\nThis code can only be used once and expires in " + rc.CodeSigner.getExpiry().String() + "."
 	_, err = session.ChannelMessageSend(userChannel.ID, message)
 	return err
 }
 
-func (rc *RoleCommand) getRoleCode(roleUID, userUID string) string {
-	hash := sha256.New()
-	hash.Write([]byte(roleUID + userUID))
-	return string(fmt.Sprintf("%x", hash.Sum(nil))[0:6])
-}
-
 func (rc *RoleCommand) GetPermLevel() db.Permission {
 	return db.PermAll
 }
@@ -244,7 +283,7 @@ func (rc *RoleCommand) GetCommandKeys() []string {
 func (rc *RoleCommand) GetCommandHelp(commPrefix string) string {
 	return fmt.Sprintf("`%[1]s role <role name>` - Changes your role to one of the approved roles. `%[1]s role` to list all the roles", commPrefix)
 }
-func printAllRoles(server db.Server, vetRole *discordgo.Role, pack *CommPackage) {
+func printAllRoles(server db.Server, pack *CommPackage) {
 	triggersByGroup := make(map[string][]string)
 	// go find all the roles for this server
 	roles, err := db.RoleQueryServer(server)
@@ -258,10 +297,15 @@ func printAllRoles(server db.Server, vetRole *discordgo.Role, pack *CommPackage)
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue fetching the roles for this server. This is an issue with moebot!")
 		return
 	}
-	if vetRole != nil {
-		// triggers = append(triggers, vetRole.Name)
-		// TODO: this should be the name of the role, but role is restricted to one word right now...
-		triggersByGroup["veteran"] = append(triggersByGroup["veteran"], "veteran")
+	tiers, err := db.RankTierQueryServer(server.Id)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue fetching the rank tiers for this server. This is an issue with moebot!")
+		return
+	}
+	for _, tier := range tiers {
+		if tier.RoleUid.Valid {
+			triggersByGroup["rank"] = append(triggersByGroup["rank"], tier.Name)
+		}
 	}
 	for _, role := range roles {
 		if !role.Trigger.Valid {
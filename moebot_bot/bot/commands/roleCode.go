@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	roleCodeNonceLength = 4 // hex characters
+	roleCodeMacLength   = 10
+	// the issue time is stored in base 36 seconds, and everything after it is a fixed length
+	roleCodeSuffixLength = roleCodeNonceLength + roleCodeMacLength
+	// a bit of leeway for codes that look like they were issued slightly in the future
+	roleCodeClockSkew = time.Minute
+
+	DefaultRoleCodeExpiry = 15 * time.Minute
+)
+
+var (
+	errRoleCodeInvalid = errors.New("invalid role confirmation code")
+	errRoleCodeExpired = errors.New("expired role confirmation code")
+)
+
+/*
+Issues and verifies role confirmation codes. Codes are signed with a secret so they can't be worked out from the role and user IDs alone,
+and carry the time they were issued so they expire.
+
+To rotate the secret move the current secret to PreviousSecret and set a new Secret. Codes signed with the previous secret keep working until
+they expire, after which PreviousSecret can be removed.
+*/
+type RoleCodeSigner struct {
+	Secret         string
+	PreviousSecret string
+	Expiry         time.Duration
+}
+
+/*
+Creates a new code for the given role and user. Every call gives back a different code
+*/
+func (s *RoleCodeSigner) NewCode(roleUid string, userUid string, now time.Time) string {
+	nonceBytes := make([]byte, roleCodeNonceLength/2)
+	rand.Read(nonceBytes)
+	issued := strconv.FormatInt(now.Unix(), 36)
+	nonce := hex.EncodeToString(nonceBytes)
+	return issued + nonce + signRoleCode(s.Secret, roleUid, userUid, issued, nonce)
+}
+
+/*
+Checks that the given code was issued by this signer for the given role and user, and that it hasn't expired
+*/
+func (s *RoleCodeSigner) VerifyCode(code string, roleUid string, userUid string, now time.Time) error {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) <= roleCodeSuffixLength {
+		return errRoleCodeInvalid
+	}
+	issued := code[:len(code)-roleCodeSuffixLength]
+	nonce := code[len(code)-roleCodeSuffixLength : len(code)-roleCodeMacLength]
+	mac := code[len(code)-roleCodeMacLength:]
+	issuedSeconds, err := strconv.ParseInt(issued, 36, 64)
+	if err != nil {
+		return errRoleCodeInvalid
+	}
+
+	validMac := false
+	for _, secret := range []string{s.Secret, s.PreviousSecret} {
+		if secret != "" && hmac.Equal([]byte(mac), []byte(signRoleCode(secret, roleUid, userUid, issued, nonce))) {
+			validMac = true
+			break
+		}
+	}
+	if !validMac {
+		return errRoleCodeInvalid
+	}
+
+	issuedTime := time.Unix(issuedSeconds, 0)
+	if issuedTime.After(now.Add(roleCodeClockSkew)) || now.Sub(issuedTime) > s.getExpiry() {
+		return errRoleCodeExpired
+	}
+	return nil
+}
+
+func (s *RoleCodeSigner) getExpiry() time.Duration {
+	if s.Expiry <= 0 {
+		return DefaultRoleCodeExpiry
+	}
+	return s.Expiry
+}
+
+func signRoleCode(secret string, roleUid string, userUid string, issued string, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(roleUid + ":" + userUid + ":" + issued + ":" + nonce))
+	return hex.EncodeToString(mac.Sum(nil))[:roleCodeMacLength]
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoleCodeSigner_VerifyCode(t *testing.T) {
+	signer := &RoleCodeSigner{Secret: "secret", Expiry: 10 * time.Minute}
+	rotated := &RoleCodeSigner{Secret: "new secret", PreviousSecret: "secret", Expiry: 10 * time.Minute}
+	otherSecret := &RoleCodeSigner{Secret: "other secret", Expiry: 10 * time.Minute}
+	issued := time.Unix(1500000000, 0)
+	code := signer.NewCode("role", "user", issued)
+
+	if signer.NewCode("role", "user", issued) == code {
+		t.Errorf("Two codes issued at the same time should be different, both were: %s", code)
+	}
+	checks := []struct {
+		signer  *RoleCodeSigner
+		code    string
+		roleUid string
+		userUid string
+		now     time.Time
+		out     error
+	}{
+		{signer, code, "role", "user", issued, nil},
+		{signer, code, "role", "user", issued.Add(9 * time.Minute), nil},
+		// rotated secrets should still accept old codes
+		{rotated, code, "role", "user", issued.Add(time.Minute), nil},
+		{signer, code, "role", "user", issued.Add(11 * time.Minute), errRoleCodeExpired},
+		{signer, code, "role", "user", issued.Add(-5 * time.Minute), errRoleCodeExpired},
+		{signer, code, "role", "other user", issued, errRoleCodeInvalid},
+		{signer, code, "other role", "user", issued, errRoleCodeInvalid},
+		{otherSecret, code, "role", "user", issued, errRoleCodeInvalid},
+		{signer, code[:len(code)-1] + "z", "role", "user", issued, errRoleCodeInvalid},
+		{signer, "abc123", "role", "user", issued, errRoleCodeInvalid},
+		{signer, "", "role", "user", issued, errRoleCodeInvalid},
+	}
+	for _, check := range checks {
+		err := check.signer.VerifyCode(check.code, check.roleUid, check.userUid, check.now)
+		if err != check.out {
+			t.Errorf("Role code verification was incorrect for %s, got: %v, want: %v.", check.code, err, check.out)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const (
+	roleConfigFileName = "roleconfig.json"
+	// anything bigger than this is definitely not a role config
+	roleConfigMaxFileSize = 256 * 1024
+)
+
+type RoleConfigCommand struct {
+	ComPrefix string
+}
+
+/*
+The exported form of a server's role setup. Roles are referenced by their discord name so a config can be moved between servers
+*/
+type roleConfig struct {
+	Groups []roleConfigGroup `json:"groups"`
+}
+
+type roleConfigGroup struct {
+	Name  string           `json:"name"`
+	Type  string           `json:"type"`
+	Roles []roleConfigRole `json:"roles"`
+}
+
+type roleConfigRole struct {
+	Name                string `json:"name"`
+	Trigger             string `json:"trigger,omitempty"`
+	Permission          string `json:"permission"`
+	ConfirmationMessage string `json:"confirmationMessage,omitempty"`
+	SecurityAnswer      string `json:"securityAnswer,omitempty"`
+}
+
+func (rc *RoleConfigCommand) Execute(pack *CommPackage) {
+	if len(pack.params) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide either `export` or `import`. `"+rc.ComPrefix+" help` for more information.")
+		return
+	}
+	server, err := db.ServerQueryOrInsert(pack.guild.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error fetching this server. This is an error with moebot not discord!")
+		return
+	}
+	if strings.EqualFold(pack.params[0], "export") {
+		rc.exportConfig(pack, server)
+	} else if strings.EqualFold(pack.params[0], "import") {
+		shouldApply := len(pack.params) > 1 && strings.EqualFold(pack.params[1], "-apply")
+		rc.importConfig(pack, server, shouldApply)
+	} else {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I don't recognize that option. Please provide either `export` or `import`.")
+	}
+}
+
+func (rc *RoleConfigCommand) exportConfig(pack *CommPackage, server db.Server) {
+	config, missingRoles, err := buildRoleConfig(server, pack.guild.Roles)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue fetching the roles for this server. This is an issue with moebot!")
+		return
+	}
+	configJson, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		log.Println("Error serializing role config", err)
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue exporting the roles for this server. This is an issue with moebot!")
+		return
+	}
+	content := "Role configuration for this server. Edit it and send it back with `" + rc.ComPrefix + " roleconfig import` to apply changes."
+	if len(missingRoles) > 0 {
+		content += "\nSkipped " + strconv.Itoa(len(missingRoles)) + " role(s) that no longer exist in discord."
+	}
+	pack.session.ChannelMessageSendComplex(pack.channel.ID, &discordgo.MessageSend{
+		Content: content,
+		File: &discordgo.File{
+			Name:        roleConfigFileName,
+			ContentType: "application/json",
+			Reader:      bytes.NewReader(configJson),
+		},
+	})
+}
+
+func (rc *RoleConfigCommand) importConfig(pack *CommPackage, server db.Server, shouldApply bool) {
+	if len(pack.message.Attachments) != 1 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please attach exactly one role config file to your message.")
+		return
+	}
+	incoming, err := downloadRoleConfig(pack.message.Attachments[0])
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I couldn't read that file. Please make sure it's a role config from `"+
+			rc.ComPrefix+" roleconfig export`.")
+		return
+	}
+	if problems := validateRoleConfig(incoming, pack.guild.Roles); len(problems) > 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("That config can't be imported:", problems))
+		return
+	}
+	current, missingRoles, err := buildRoleConfig(server, pack.guild.Roles)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue fetching the roles for this server. This is an issue with moebot!")
+		return
+	}
+	changes := diffRoleConfig(current, incoming)
+	for _, roleUid := range missingRoles {
+		changes = append(changes, "- role with ID `"+roleUid+"` (no longer exists in discord)")
+	}
+	if len(changes) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "That config matches this server's current roles, nothing to change!")
+		return
+	}
+	if !shouldApply {
+		pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("Importing this config would make the following changes:", changes)+
+			"\nRun `"+rc.ComPrefix+" roleconfig import -apply` with the same file attached to apply them.")
+		return
+	}
+	err = applyRoleConfig(server, incoming, pack.guild.Roles)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an issue applying that config. No changes were made.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, "Successfully imported the role config! Applied "+strconv.Itoa(len(changes))+" change(s).")
+}
+
+/*
+Builds a role config from the database for the given server. Any roles that no longer exist in discord are returned by ID
+*/
+func buildRoleConfig(server db.Server, guildRoles []*discordgo.Role) (config roleConfig, missingRoles []string, err error) {
+	groups, err := db.RoleGroupQueryServer(server)
+	if err != nil {
+		return
+	}
+	roles, err := db.RoleQueryServer(server)
+	if err != nil {
+		return
+	}
+	config.Groups = []roleConfigGroup{}
+	for _, group := range groups {
+		exportGroup := roleConfigGroup{
+			Name:  group.Name,
+			Type:  db.GetShortStringFromGroupType(group.Type),
+			Roles: []roleConfigRole{},
+		}
+		for _, role := range roles {
+			if role.GroupId != group.Id {
+				continue
+			}
+			discordRole := moeDiscord.FindRoleById(guildRoles, role.RoleUid)
+			if discordRole == nil {
+				missingRoles = append(missingRoles, role.RoleUid)
+				continue
+			}
+			exportGroup.Roles = append(exportGroup.Roles, roleConfigRole{
+				Name:                discordRole.Name,
+				Trigger:             role.Trigger.String,
+				Permission:          db.SprintPermission(role.Permission),
+				ConfirmationMessage: role.ConfirmationMessage.String,
+				SecurityAnswer:      role.ConfirmationSecurityAnswer.String,
+			})
+		}
+		config.Groups = append(config.Groups, exportGroup)
+	}
+	return
+}
+
+func downloadRoleConfig(attachment *discordgo.MessageAttachment) (config roleConfig, err error) {
+	if attachment.Size > roleConfigMaxFileSize {
+		return config, fmt.Errorf("role config too large: %d bytes", attachment.Size)
+	}
+	response, err := http.Get(attachment.URL)
+	if err != nil {
+		log.Println("Error downloading role config attachment", err)
+		return
+	}
+	defer response.Body.Close()
+	b, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		log.Println("Error reading from role config attachment", err)
+		return
+	}
+	err = json.Unmarshal(b, &config)
+	return
+}
+
+/*
+Checks an incoming role config against the guild it's being imported to. Returns a list of everything wrong with it
+*/
+func validateRoleConfig(config roleConfig, guildRoles []*discordgo.Role) (problems []string) {
+	seenGroups := make(map[string]bool)
+	seenRoles := make(map[string]bool)
+	for _, group := range config.Groups {
+		if group.Name == "" || len(group.Name) > db.RoleGroupMaxNameLength {
+			problems = append(problems, "Group names must be between 1 and "+db.RoleGroupMaxNameLengthString+" characters")
+		}
+		if seenGroups[group.Name] {
+			problems = append(problems, "Group `"+group.Name+"` is listed more than once")
+		}
+		seenGroups[group.Name] = true
+		if db.GetGroupTypeFromString(group.Type) < 0 {
+			problems = append(problems, "Group `"+group.Name+"` has an invalid type. Valid types: "+db.OptionsForGroupType)
+		}
+		for _, role := range group.Roles {
+			if moeDiscord.FindRoleByName(guildRoles, role.Name) == nil {
+				problems = append(problems, "Role `"+role.Name+"` doesn't exist in this server")
+			}
+			if seenRoles[strings.ToUpper(role.Name)] {
+				problems = append(problems, "Role `"+role.Name+"` is listed more than once")
+			}
+			seenRoles[strings.ToUpper(role.Name)] = true
+			if len(role.Trigger) > db.RoleMaxTriggerLength {
+				problems = append(problems, "Role `"+role.Name+"` has a trigger longer than "+db.RoleMaxTriggerLengthString+" characters")
+			}
+			if role.Permission != "" && !db.IsAssignablePermissionLevel(db.GetPermissionFromString(role.Permission)) {
+				problems = append(problems, "Role `"+role.Name+"` has an invalid permission. Valid permissions: "+db.GetAssignableRoles())
+			}
+			if len(role.ConfirmationMessage) > db.MaxMessageLength || len(role.SecurityAnswer) > db.MaxMessageLength {
+				problems = append(problems, "Role `"+role.Name+"` has a confirmation message or security answer longer than "+
+					db.MaxMessageLengthString+" characters")
+			}
+		}
+	}
+	return
+}
+
+/*
+Describes every change needed to go from the current config to the incoming one, one change per line
+*/
+func diffRoleConfig(current roleConfig, incoming roleConfig) (changes []string) {
+	currentGroups := make(map[string]roleConfigGroup)
+	currentRoles := make(map[string]roleConfigRole)
+	currentRoleGroups := make(map[string]string)
+	for _, group := range current.Groups {
+		currentGroups[group.Name] = group
+		for _, role := range group.Roles {
+			currentRoles[strings.ToUpper(role.Name)] = role
+			currentRoleGroups[strings.ToUpper(role.Name)] = group.Name
+		}
+	}
+	incomingGroups := make(map[string]bool)
+	incomingRoles := make(map[string]bool)
+	for _, group := range incoming.Groups {
+		incomingGroups[group.Name] = true
+		groupType := db.GetShortStringFromGroupType(db.GetGroupTypeFromString(group.Type))
+		if oldGroup, ok := currentGroups[group.Name]; !ok {
+			changes = append(changes, "+ group `"+group.Name+"` ("+groupType+")")
+		} else if oldGroup.Type != groupType {
+			changes = append(changes, "~ group `"+group.Name+"` type "+oldGroup.Type+" -> "+groupType)
+		}
+		for _, role := range group.Roles {
+			key := strings.ToUpper(role.Name)
+			incomingRoles[key] = true
+			oldRole, ok := currentRoles[key]
+			if !ok {
+				changes = append(changes, "+ role `"+role.Name+"` in group `"+group.Name+"`")
+				continue
+			}
+			var roleChanges []string
+			if currentRoleGroups[key] != group.Name {
+				roleChanges = append(roleChanges, "group `"+currentRoleGroups[key]+"` -> `"+group.Name+"`")
+			}
+			if oldRole.Trigger != role.Trigger {
+				roleChanges = append(roleChanges, "trigger `"+oldRole.Trigger+"` -> `"+role.Trigger+"`")
+			}
+			if oldRole.Permission != sprintImportPermission(role.Permission) {
+				roleChanges = append(roleChanges, "permission "+oldRole.Permission+" -> "+sprintImportPermission(role.Permission))
+			}
+			if oldRole.ConfirmationMessage != role.ConfirmationMessage {
+				roleChanges = append(roleChanges, "confirmation message")
+			}
+			if oldRole.SecurityAnswer != role.SecurityAnswer {
+				roleChanges = append(roleChanges, "security answer")
+			}
+			if len(roleChanges) > 0 {
+				changes = append(changes, "~ role `"+role.Name+"`: "+strings.Join(roleChanges, ", "))
+			}
+		}
+	}
+	for _, group := range current.Groups {
+		for _, role := range group.Roles {
+			if !incomingRoles[strings.ToUpper(role.Name)] {
+				changes = append(changes, "- role `"+role.Name+"`")
+			}
+		}
+		if !incomingGroups[group.Name] {
+			changes = append(changes, "- group `"+group.Name+"`")
+		}
+	}
+	return
+}
+
+/*
+Replaces the server's role setup with the given config inside a single transaction. Nothing is changed if any step fails
+*/
+func applyRoleConfig(server db.Server, config roleConfig, guildRoles []*discordgo.Role) (err error) {
+	groups, err := db.RoleGroupQueryServer(server)
+	if err != nil {
+		return
+	}
+	roles, err := db.RoleQueryServer(server)
+	if err != nil {
+		return
+	}
+	tx := db.OpenTransaction()
+	if tx == nil {
+		return errors.New("unable to open a transaction for the role config import")
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	keptGroups := make(map[string]bool)
+	keptRoles := make(map[string]bool)
+	for _, group := range config.Groups {
+		keptGroups[group.Name] = true
+		groupId, err := db.RoleGroupInsertOrUpdateTx(tx, db.RoleGroup{
+			Name: group.Name,
+			Type: db.GetGroupTypeFromString(group.Type),
+		}, server)
+		if err != nil {
+			return err
+		}
+		for _, role := range group.Roles {
+			discordRole := moeDiscord.FindRoleByName(guildRoles, role.Name)
+			keptRoles[discordRole.ID] = true
+			dbRole := db.Role{
+				ServerId:   server.Id,
+				GroupId:    groupId,
+				RoleUid:    discordRole.ID,
+				Permission: db.GetPermissionFromString(sprintImportPermission(role.Permission)),
+			}
+			// empty strings are stored as nulls, which is what the other commands expect for "not set"
+			if role.Trigger != "" {
+				dbRole.Trigger.Scan(role.Trigger)
+			}
+			if role.ConfirmationMessage != "" {
+				dbRole.ConfirmationMessage.Scan(role.ConfirmationMessage)
+			}
+			if role.SecurityAnswer != "" {
+				securityAnswer := role.SecurityAnswer
+				if !strings.HasPrefix(securityAnswer, "-") {
+					securityAnswer = "-" + securityAnswer
+				}
+				dbRole.ConfirmationSecurityAnswer.Scan(securityAnswer)
+			}
+			if err = db.RoleInsertOrUpdateTx(tx, dbRole); err != nil {
+				return err
+			}
+		}
+	}
+	for _, role := range roles {
+		if !keptRoles[role.RoleUid] {
+			if err = db.RoleDeleteTx(tx, role.RoleUid, server.Id); err != nil {
+				return
+			}
+		}
+	}
+	for _, group := range groups {
+		if !keptGroups[group.Name] {
+			if err = db.RoleGroupDeleteTx(tx, group.Id); err != nil {
+				return
+			}
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Println("Error committing role config import", err)
+	}
+	return
+}
+
+/*
+Permissions are optional in an imported config, missing ones are treated as All
+*/
+func sprintImportPermission(permission string) string {
+	if permission == "" {
+		return db.SprintPermission(db.PermAll)
+	}
+	return db.SprintPermission(db.GetPermissionFromString(permission))
+}
+
+/*
+Joins the given lines under a header, dropping any lines that would push the message past discord's limits
+*/
+func limitMessageLines(header string, lines []string) string {
+	var message bytes.Buffer
+	message.WriteString(header)
+	for i, line := range lines {
+		if message.Len()+len(line) > db.MaxMessageLength-50 {
+			message.WriteString("\n...and " + strconv.Itoa(len(lines)-i) + " more")
+			break
+		}
+		message.WriteString("\n")
+		message.WriteString(line)
+	}
+	return message.String()
+}
+
+func (rc *RoleConfigCommand) GetPermLevel() db.Permission {
+	return db.PermMod
+}
+
+func (rc *RoleConfigCommand) GetCommandKeys() []string {
+	return []string{"ROLECONFIG"}
+}
+
+func (rc *RoleConfigCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s roleconfig export` - Master/Mod. Exports all groups and roles for this server as a JSON file. "+
+		"`%[1]s roleconfig import [-apply]` with the file attached previews the changes, or applies them with `-apply`.", commPrefix)
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoleConfig_DiffRoleConfig(t *testing.T) {
+	current := roleConfig{Groups: []roleConfigGroup{
+		{Name: "Teams", Type: "EXC", Roles: []roleConfigRole{
+			{Name: "Red", Trigger: "red", Permission: "All"},
+			{Name: "Blue", Trigger: "blue", Permission: "All"},
+		}},
+		{Name: "Old", Type: "ANY", Roles: []roleConfigRole{
+			{Name: "Legacy", Trigger: "legacy", Permission: "All"},
+		}},
+	}}
+	checks := []struct {
+		incoming roleConfig
+		out      []string
+	}{
+		// same config, no changes
+		{current, nil},
+		{roleConfig{Groups: []roleConfigGroup{
+			{Name: "Teams", Type: "ENR", Roles: []roleConfigRole{
+				{Name: "red", Trigger: "red"},
+				{Name: "Blue", Trigger: "bleu", Permission: "mod"},
+				{Name: "Green", Trigger: "green"},
+			}},
+			{Name: "Old", Type: "ANY", Roles: []roleConfigRole{}},
+		}}, []string{
+			"~ group `Teams` type EXC -> ENR",
+			"~ role `Blue`: trigger `blue` -> `bleu`, permission All -> Mod",
+			"+ role `Green` in group `Teams`",
+			"- role `Legacy`",
+		}},
+		{roleConfig{Groups: []roleConfigGroup{
+			{Name: "Colors", Type: "any", Roles: []roleConfigRole{
+				{Name: "Red", Trigger: "red", Permission: "All"},
+			}},
+		}}, []string{
+			"+ group `Colors` (ANY)",
+			"~ role `Red`: group `Teams` -> `Colors`",
+			"- role `Blue`",
+			"- group `Teams`",
+			"- role `Legacy`",
+			"- group `Old`",
+		}},
+	}
+	for _, check := range checks {
+		changes := diffRoleConfig(current, check.incoming)
+		if !reflect.DeepEqual(changes, check.out) {
+			t.Errorf("Role config diff was incorrect, got: %q, want: %q.", changes, check.out)
+		}
+	}
+}
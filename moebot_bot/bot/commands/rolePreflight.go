@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+/*
+Returned when moebot can't add or remove a role, either because a preflight check failed or discord refused the change
+*/
+type RoleManageError struct {
+	RoleName string
+	Reason   string
+}
+
+func (e *RoleManageError) Error() string {
+	return "I can't manage the role `" + e.RoleName + "` because " + e.Reason
+}
+
+/*
+Checks that moebot has Manage Roles in the guild and that its highest role sits above the given role, which discord requires before
+moebot can add or remove it
+*/
+func CheckRoleManageable(session *discordgo.Session, guild *discordgo.Guild, role *discordgo.Role) error {
+	botMember, err := moeDiscord.GetMember(session.State.User.ID, guild.ID, session)
+	if err != nil || botMember == nil {
+		log.Println("Error getting moebot's member during role preflight", err)
+		return &RoleManageError{RoleName: role.Name, Reason: "I couldn't look up my own roles in this server. Please try again later."}
+	}
+	return checkRoleManageable(guild, botMember, role)
+}
+
+func checkRoleManageable(guild *discordgo.Guild, botMember *discordgo.Member, role *discordgo.Role) error {
+	if role.Managed {
+		return &RoleManageError{RoleName: role.Name, Reason: "it's managed by an integration and can't be assigned by anyone."}
+	}
+	if guild.OwnerID == botMember.User.ID {
+		return nil
+	}
+	var permissions int
+	highestPosition := -1
+	var highestName string
+	for _, guildRole := range guild.Roles {
+		// the @everyone role shares its ID with the guild and applies to every member
+		if guildRole.ID != guild.ID && !util.StrContains(botMember.Roles, guildRole.ID, util.CaseSensitive) {
+			continue
+		}
+		permissions |= guildRole.Permissions
+		if guildRole.Position > highestPosition {
+			highestPosition = guildRole.Position
+			highestName = guildRole.Name
+		}
+	}
+	if permissions&(discordgo.PermissionManageRoles|discordgo.PermissionAdministrator) == 0 {
+		return &RoleManageError{RoleName: role.Name, Reason: "I don't have the Manage Roles permission. Please give one of my roles that permission."}
+	}
+	if role.Position >= highestPosition {
+		return &RoleManageError{RoleName: role.Name, Reason: "my highest role `" + highestName + "` is not above it. Please move one of my roles above `" +
+			role.Name + "` in the server's role settings."}
+	}
+	return nil
+}
+
+/*
+Adds a role to a member after making sure moebot is able to
+*/
+func AddMemberRole(session *discordgo.Session, guild *discordgo.Guild, userUid string, role *discordgo.Role) error {
+	if err := CheckRoleManageable(session, guild, role); err != nil {
+		return err
+	}
+	return describeRoleRestError(role, session.GuildMemberRoleAdd(guild.ID, userUid, role.ID))
+}
+
+/*
+Removes a role from a member after making sure moebot is able to
+*/
+func RemoveMemberRole(session *discordgo.Session, guild *discordgo.Guild, userUid string, role *discordgo.Role) error {
+	if err := CheckRoleManageable(session, guild, role); err != nil {
+		return err
+	}
+	return describeRoleRestError(role, session.GuildMemberRoleRemove(guild.ID, userUid, role.ID))
+}
+
+func describeRoleRestError(role *discordgo.Role, err error) error {
+	if err == nil {
+		return nil
+	}
+	log.Println("Error updating role "+role.ID, err)
+	if restErr, ok := err.(*discordgo.RESTError); ok && restErr.Response != nil && restErr.Response.StatusCode == 403 {
+		return &RoleManageError{RoleName: role.Name, Reason: "discord says I'm missing permissions. Please check my roles are above it and have Manage Roles."}
+	}
+	return &RoleManageError{RoleName: role.Name, Reason: "discord returned an error. Please try again later."}
+}
+
+/*
+Tells both the channel the action happened in and the server's admins that a role change failed. channelUid can be empty when
+there's no channel the action happened in
+*/
+func ReportRoleError(session *discordgo.Session, channelUid string, server db.Server, err error) {
+	message := "Sorry, " + err.Error()
+	category := db.NoticeConfig
+	if _, ok := err.(*RoleManageError); !ok {
+		message = "Sorry, there was an issue updating roles. " + err.Error()
+		category = db.NoticeFailure
+	}
+	if channelUid != "" {
+		session.ChannelMessageSend(channelUid, message)
+	}
+	if !server.BotChannel.Valid || server.BotChannel.String != channelUid {
+		Notify(session, server, category, "A role change failed: "+message)
+	}
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRolePreflight_CheckRoleManageable(t *testing.T) {
+	guild := &discordgo.Guild{
+		ID:      "1",
+		OwnerID: "99",
+		Roles: []*discordgo.Role{
+			{ID: "1", Name: "@everyone", Position: 0},
+			{ID: "10", Name: "Member", Position: 1},
+			{ID: "11", Name: "Bot", Position: 3, Permissions: discordgo.PermissionManageRoles},
+			{ID: "12", Name: "Admin", Position: 5, Permissions: discordgo.PermissionAdministrator},
+			{ID: "13", Name: "Mod", Position: 4},
+			{ID: "14", Name: "Integration", Position: 2, Managed: true},
+		},
+	}
+	botMember := func(roles ...string) *discordgo.Member {
+		return &discordgo.Member{User: &discordgo.User{ID: "50"}, Roles: roles}
+	}
+	checks := []struct {
+		member *discordgo.Member
+		role   string
+		ok     bool
+	}{
+		{botMember("11"), "10", true},
+		// roles at or above the bot's highest role can't be managed
+		{botMember("11"), "11", false},
+		{botMember("11"), "13", false},
+		// no manage roles permission
+		{botMember("10"), "1", false},
+		{botMember(), "10", false},
+		// administrator counts as manage roles
+		{botMember("12"), "13", true},
+		// managed roles can never be assigned
+		{botMember("12"), "14", false},
+		// the owner can manage anything
+		{&discordgo.Member{User: &discordgo.User{ID: "99"}}, "12", true},
+	}
+	for i, c := range checks {
+		var role *discordgo.Role
+		for _, r := range guild.Roles {
+			if r.ID == c.role {
+				role = r
+			}
+		}
+		err := checkRoleManageable(guild, c.member, role)
+		if (err == nil) != c.ok {
+			t.Errorf("Incorrect preflight result for check %d. Got: %v, expected ok: %v", i, err, c.ok)
+		}
+	}
+}
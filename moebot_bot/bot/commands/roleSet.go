@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/camd67/moebot/moebot_bot/util/db"
 	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
 )
@@ -31,17 +30,17 @@ func (rc *RoleSetCommand) Execute(pack *CommPackage) {
 
 	if !hasDelete && !hasRole && !hasTrigger && !hasConfirm && !hasSecurity && !hasGroup {
 		// empty command (or just really bad one)
-		var vetRole *discordgo.Role
-		if server.VeteranRole.Valid {
-			vetRole = moeDiscord.FindRoleById(pack.guild.Roles, server.VeteranRole.String)
-		}
 		if len(pack.params) == 0 {
-			printAllRoles(server, vetRole, pack)
+			printAllRoles(server, pack)
 		}
 	} else if hasDelete {
-		role := moeDiscord.FindRoleByName(pack.guild.Roles, deleteName)
+		// roles deleted from discord can't be found by name anymore, so allow their ID too
+		roleUid := deleteName
+		if role := moeDiscord.FindRoleByName(pack.guild.Roles, deleteName); role != nil {
+			roleUid = role.ID
+		}
 		// we don't really care about the role itself here, just if we got a row back or not (could use a row count check but oh well)
-		_, err := db.RoleQueryRoleUid(role.ID, server.Id)
+		_, err := db.RoleQueryRoleUid(roleUid, server.Id)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				pack.session.ChannelMessageSend(pack.channel.ID, "It doesn't look like that's a role you can delete! Please provide a role that was "+
@@ -51,7 +50,7 @@ func (rc *RoleSetCommand) Execute(pack *CommPackage) {
 			}
 			return
 		}
-		err = db.RoleDelete(role.ID, pack.guild.ID)
+		err = db.RoleDelete(roleUid, pack.guild.ID)
 		if err != nil {
 			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error deleting that role. This is an error with moebot not discord!")
 			return
@@ -72,6 +71,10 @@ func (rc *RoleSetCommand) Execute(pack *CommPackage) {
 			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, it doesn't seem like that role exists on this server.")
 			return
 		}
+		if err := CheckRoleManageable(pack.session, pack.guild, r); err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+err.Error()+" The role was not updated.")
+			return
+		}
 		// first check if we've already got this one
 		oldRole, err := db.RoleQueryRoleUid(r.ID, server.Id)
 		var typeString string
@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+/*
+Keeps the role table and server role settings in line with the roles that actually exist in discord
+*/
+type RoleSyncHandler struct {
+	// role names as we last saw them, used to tell when a role was renamed. Role IDs are unique across guilds
+	roleNames struct {
+		sync.RWMutex
+		m map[string]string
+	}
+}
+
+func NewRoleSyncHandler() *RoleSyncHandler {
+	result := &RoleSyncHandler{}
+	result.roleNames.m = make(map[string]string)
+	return result
+}
+
+func (rh *RoleSyncHandler) Setup(session *discordgo.Session) {
+	go rh.reconcileGuilds(session)
+}
+
+func (rh *RoleSyncHandler) EventHandlers() []interface{} {
+	return []interface{}{rh.roleDelete, rh.roleUpdate}
+}
+
+func (rh *RoleSyncHandler) roleDelete(session *discordgo.Session, roleDelete *discordgo.GuildRoleDelete) {
+	if !db.AccessGuildAllowed(roleDelete.GuildID) {
+		return
+	}
+	server, err := db.ServerQueryOrInsert(roleDelete.GuildID)
+	if err != nil {
+		log.Println("Error getting server during role delete", err)
+		return
+	}
+	rh.handleDeletedRole(session, &server, roleDelete.RoleID)
+}
+
+func (rh *RoleSyncHandler) roleUpdate(session *discordgo.Session, roleUpdate *discordgo.GuildRoleUpdate) {
+	if roleUpdate.Role == nil {
+		return
+	}
+	rh.roleNames.Lock()
+	oldName, known := rh.roleNames.m[roleUpdate.Role.ID]
+	rh.roleNames.m[roleUpdate.Role.ID] = roleUpdate.Role.Name
+	rh.roleNames.Unlock()
+	if !known || oldName == roleUpdate.Role.Name {
+		// either something other than the name changed or we've never seen this role before
+		return
+	}
+	if !db.AccessGuildAllowed(roleUpdate.GuildID) {
+		return
+	}
+
+	server, err := db.ServerQueryOrInsert(roleUpdate.GuildID)
+	if err != nil {
+		log.Println("Error getting server during role update", err)
+		return
+	}
+	usages := roleUsages(server, roleUpdate.Role.ID)
+	if len(usages) == 0 {
+		return
+	}
+	Notify(session, server, db.NoticeConfig, "The role `"+oldName+"` was renamed to `"+roleUpdate.Role.Name+"`. It's still used for: "+
+		strings.Join(usages, ", ")+". You may want to update its trigger with the roleset command.")
+}
+
+/*
+Goes over every guild moebot is in and removes anything referencing roles that were deleted while moebot wasn't watching
+*/
+func (rh *RoleSyncHandler) reconcileGuilds(session *discordgo.Session) {
+	afterId := ""
+	for {
+		guilds, err := session.UserGuilds(100, "", afterId)
+		if err != nil {
+			log.Println("Error loading guilds for role reconciliation", err)
+			return
+		}
+		for _, guild := range guilds {
+			if !db.AccessGuildAllowed(guild.ID) {
+				continue
+			}
+			rh.reconcileGuild(session, guild.ID)
+		}
+		if len(guilds) < 100 {
+			break
+		}
+		afterId = guilds[len(guilds)-1].ID
+	}
+	log.Println("Finished reconciling roles for all guilds")
+}
+
+func (rh *RoleSyncHandler) reconcileGuild(session *discordgo.Session, guildUid string) {
+	roles, err := session.GuildRoles(guildUid)
+	if err != nil {
+		log.Println("Error loading roles for guild "+guildUid+" during reconciliation", err)
+		return
+	}
+	server, err := db.ServerQueryOrInsert(guildUid)
+	if err != nil {
+		log.Println("Error getting server during reconciliation", err)
+		return
+	}
+	existingRoles := make(map[string]bool)
+	rh.roleNames.Lock()
+	for _, role := range roles {
+		existingRoles[role.ID] = true
+		rh.roleNames.m[role.ID] = role.Name
+	}
+	rh.roleNames.Unlock()
+
+	var missingRoles []string
+	dbRoles, err := db.RoleQueryServer(server)
+	if err != nil {
+		return
+	}
+	for _, dbRole := range dbRoles {
+		if !existingRoles[strings.TrimSpace(dbRole.RoleUid)] {
+			missingRoles = append(missingRoles, dbRole.RoleUid)
+		}
+	}
+	for _, serverRole := range []sql.NullString{server.StarterRole, server.BaseRole} {
+		if serverRole.Valid && !existingRoles[serverRole.String] {
+			missingRoles = append(missingRoles, serverRole.String)
+		}
+	}
+	tiers, err := db.RankTierQueryServer(server.Id)
+	if err != nil {
+		return
+	}
+	for _, tier := range tiers {
+		if tier.RoleUid.Valid && !existingRoles[tier.RoleUid.String] {
+			missingRoles = append(missingRoles, tier.RoleUid.String)
+		}
+	}
+	for _, roleUid := range missingRoles {
+		rh.handleDeletedRole(session, &server, roleUid)
+	}
+}
+
+/*
+Removes every reference to the given role from the database and lets the server know what was removed
+*/
+func (rh *RoleSyncHandler) handleDeletedRole(session *discordgo.Session, server *db.Server, roleUid string) {
+	rh.roleNames.Lock()
+	roleName, known := rh.roleNames.m[roleUid]
+	delete(rh.roleNames.m, roleUid)
+	rh.roleNames.Unlock()
+	if !known {
+		roleName = "with ID " + roleUid
+	} else {
+		roleName = "`" + roleName + "`"
+	}
+
+	usages := roleUsages(*server, roleUid)
+	if len(usages) == 0 {
+		return
+	}
+	if _, err := db.RoleQueryRoleUid(roleUid, server.Id); err == nil {
+		if err = db.RoleDelete(roleUid, server.GuildUid); err != nil {
+			Notify(session, *server, db.NoticeFailure, "The role "+roleName+" was deleted, but I couldn't remove it from my settings. Please remove it with the roleset command.")
+			return
+		}
+	}
+	if db.RankTierClearRole(server.Id, roleUid) != nil {
+		Notify(session, *server, db.NoticeFailure, "The role "+roleName+" was deleted, but I couldn't remove it from the rank tiers. Please remove it with "+
+			"the tier command.")
+		return
+	}
+	serverChanged := false
+	for _, serverRole := range []*sql.NullString{&server.StarterRole, &server.BaseRole} {
+		if serverRole.Valid && serverRole.String == roleUid {
+			serverRole.Scan(nil)
+			serverChanged = true
+		}
+	}
+	if serverChanged {
+		if err := db.ServerFullUpdate(*server, "", "role "+roleUid+" deleted from discord"); err != nil {
+			return
+		}
+	}
+	log.Println("Removed deleted role " + roleUid + " from server " + server.GuildUid)
+	Notify(session, *server, db.NoticeConfig, "The role "+roleName+" was deleted from discord, so I've removed it from: "+strings.Join(usages, ", ")+".")
+}
+
+/*
+Describes everywhere the given role is used in moebot's settings for a server
+*/
+func roleUsages(server db.Server, roleUid string) (usages []string) {
+	dbRole, err := db.RoleQueryRoleUid(roleUid, server.Id)
+	if err == nil {
+		if dbRole.Trigger.Valid {
+			usages = append(usages, "role trigger `"+dbRole.Trigger.String+"`")
+		} else {
+			usages = append(usages, "role permissions")
+		}
+	}
+	if tiers, err := db.RankTierQueryServer(server.Id); err == nil {
+		for _, tier := range tiers {
+			if tier.RoleUid.Valid && tier.RoleUid.String == roleUid {
+				usages = append(usages, "rank tier `"+tier.Name+"`")
+			}
+		}
+	}
+	if server.StarterRole.Valid && server.StarterRole.String == roleUid {
+		usages = append(usages, "StarterRole")
+	}
+	if server.BaseRole.Valid && server.BaseRole.String == roleUid {
+		usages = append(usages, "BaseRole")
+	}
+	return
+}
@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const (
+	// reaction members add to the rule message to agree to the rules
+	RuleAgreementEmoji = "✅"
+
+	verifyTimeoutInterval = 15 * time.Minute
+)
+
+/*
+Lets members agree to the rules by reacting to a message, and deals with members who never agree
+*/
+type RuleAgreementHandler struct {
+	ComPrefix string
+}
+
+func (rh *RuleAgreementHandler) Setup(session *discordgo.Session) {
+	go rh.checkTimeouts(session)
+}
+
+func (rh *RuleAgreementHandler) EventHandlers() []interface{} {
+	return []interface{}{rh.reactionAdd}
+}
+
+func (rh *RuleAgreementHandler) reactionAdd(session *discordgo.Session, reactionAdd *discordgo.MessageReactionAdd) {
+	if reactionAdd.Emoji.Name != RuleAgreementEmoji || reactionAdd.UserID == session.State.User.ID {
+		return
+	}
+	channel, err := moeDiscord.GetChannel(reactionAdd.ChannelID, session)
+	if err != nil {
+		return
+	}
+	server, err := db.ServerQueryOrInsert(channel.GuildID)
+	if err != nil || !server.Enabled || !server.RuleMessage.Valid || server.RuleMessage.String != reactionAdd.MessageID {
+		return
+	}
+	if server.VerifyMode != db.VerifyModeRules {
+		// reacting would skip the captcha
+		return
+	}
+	guild, err := moeDiscord.GetGuild(channel.GuildID, session)
+	if err != nil {
+		return
+	}
+	member, err := moeDiscord.GetMember(reactionAdd.UserID, guild.ID, session)
+	if err != nil || member == nil {
+		return
+	}
+	if !server.StarterRole.Valid || !util.StrContains(member.Roles, server.StarterRole.String, util.CaseSensitive) {
+		// already agreed, or there's nothing to swap
+		return
+	}
+	if err = VerifyMember(session, guild, server, member.User.ID); err != nil {
+		ReportRoleError(session, "", server, err)
+		return
+	}
+	log.Println("Updated user <" + member.User.Username + "> after reacting to the rules")
+}
+
+/*
+Swaps the server's starter role for its base role once a member has agreed to the rules
+*/
+func VerifyMember(session *discordgo.Session, guild *discordgo.Guild, server db.Server, userUid string) error {
+	var starterRole, baseRole *discordgo.Role
+	if server.StarterRole.Valid {
+		starterRole = moeDiscord.FindRoleById(guild.Roles, server.StarterRole.String)
+	}
+	if server.BaseRole.Valid {
+		baseRole = moeDiscord.FindRoleById(guild.Roles, server.BaseRole.String)
+	}
+	if starterRole == nil || baseRole == nil {
+		return errors.New("this server's starter or base role is missing, so I can't let anyone agree to the rules")
+	}
+	if err := AddMemberRole(session, guild, userUid, baseRole); err != nil {
+		return err
+	}
+	if err := RemoveMemberRole(session, guild, userUid, starterRole); err != nil {
+		return err
+	}
+	db.VerifyReminderDelete(guild.ID, userUid)
+	return nil
+}
+
+/*
+Checks if a message counts as agreeing to the rules, ignoring case and anything that isn't a letter
+*/
+func MatchesRuleAgreement(message string, agreement string) bool {
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(strings.ToUpper(util.MakeAlphaOnly(s))), " ")
+	}
+	normalizedAgreement := normalize(agreement)
+	return normalizedAgreement != "" && strings.HasPrefix(normalize(message), normalizedAgreement)
+}
+
+func (rh *RuleAgreementHandler) checkTimeouts(session *discordgo.Session) {
+	for {
+		time.Sleep(verifyTimeoutInterval)
+		session.State.RLock()
+		guilds := make([]*discordgo.Guild, len(session.State.Guilds))
+		copy(guilds, session.State.Guilds)
+		session.State.RUnlock()
+		for _, guild := range guilds {
+			if !db.AccessGuildAllowed(guild.ID) {
+				continue
+			}
+			server, err := db.ServerQueryOrInsert(guild.ID)
+			if err != nil || !server.Enabled || !server.VerifyTimeout.Valid || !server.StarterRole.Valid {
+				continue
+			}
+			rh.checkGuildTimeouts(session, guild, server)
+		}
+	}
+}
+
+func (rh *RuleAgreementHandler) checkGuildTimeouts(session *discordgo.Session, guild *discordgo.Guild, server db.Server) {
+	members, err := moeDiscord.GetAllMembers(guild.ID, session)
+	if err != nil {
+		log.Println("Error loading members for verify timeout in guild "+guild.ID, err)
+		return
+	}
+	cutoff := time.Now().Add(-time.Duration(server.VerifyTimeout.Int64) * time.Hour)
+	var kicked, failed int
+	for _, member := range members {
+		if member.User.Bot || !util.StrContains(member.Roles, server.StarterRole.String, util.CaseSensitive) {
+			continue
+		}
+		joined, err := time.Parse(time.RFC3339Nano, member.JoinedAt)
+		if err != nil || joined.After(cutoff) {
+			continue
+		}
+		if server.VerifyTimeoutAction == db.VerifyTimeoutKick {
+			err = session.GuildMemberDeleteWithReason(guild.ID, member.User.ID, "Didn't agree to the rules within "+
+				strconv.Itoa(int(server.VerifyTimeout.Int64))+" hours")
+			if err != nil {
+				log.Println("Error kicking unverified member", err)
+				failed++
+				continue
+			}
+			db.VerifyReminderDelete(guild.ID, member.User.ID)
+			kicked++
+		} else {
+			firstReminder, err := db.VerifyReminderInsert(guild.ID, member.User.ID)
+			if err != nil || !firstReminder {
+				continue
+			}
+			rh.sendReminder(session, guild, server, member.User)
+		}
+	}
+	if kicked > 0 {
+		Notify(session, server, db.NoticeModeration, "Kicked "+strconv.Itoa(kicked)+" member(s) who didn't agree to the rules within "+
+			strconv.Itoa(int(server.VerifyTimeout.Int64))+" hours.")
+	}
+	if failed > 0 {
+		Notify(session, server, db.NoticeConfig, "I couldn't kick "+strconv.Itoa(failed)+" member(s) who didn't agree to the rules in time. "+
+			"Please make sure I have the Kick Members permission and my roles are above theirs.")
+	}
+}
+
+func (rh *RuleAgreementHandler) sendReminder(session *discordgo.Session, guild *discordgo.Guild, server db.Server, user *discordgo.User) {
+	dmChannel, err := session.UserChannelCreate(user.ID)
+	if err != nil {
+		return
+	}
+	var how []string
+	if server.VerifyMode == db.VerifyModeCaptcha {
+		how = append(how, "solve the captcha I sent you, or type `"+rh.ComPrefix+" verify` in the server for a new one")
+	} else if server.RuleMessage.Valid {
+		how = append(how, "react with "+RuleAgreementEmoji+" on the rules message in <#"+server.RuleMessageChannel.String+">")
+	}
+	if server.RuleAgreement.Valid && server.VerifyMode == db.VerifyModeRules {
+		how = append(how, "type the rule agreement from the rules")
+	}
+	message := "Hi " + user.Username + "! You haven't agreed to the rules in " + guild.Name + " yet."
+	if len(how) > 0 {
+		message += " To get full access, " + strings.Join(how, " or ") + "."
+	}
+	session.ChannelMessageSend(dmChannel.ID, message)
+}
@@ -0,0 +1,26 @@
+package commands
+
+import "testing"
+
+func TestRuleAgreement_MatchesRuleAgreement(t *testing.T) {
+	checks := []struct {
+		message   string
+		agreement string
+		out       bool
+	}{
+		{"I agree", "I agree", true},
+		{"i AGREE!!", "I agree", true},
+		{"I agree to the rules", "I agree", true},
+		{"I  agree.", "I agree", true},
+		{"I agree", "I agree!", true},
+		{"  I, agree", "i agree", true},
+		{"I disagree", "I agree", false},
+		{"agree", "I agree", false},
+		{"anything", "!!!", false},
+	}
+	for _, c := range checks {
+		if res := MatchesRuleAgreement(c.message, c.agreement); res != c.out {
+			t.Errorf("Incorrect match for message: %s, agreement: %s. Got: %v, expected: %v", c.message, c.agreement, res, c.out)
+		}
+	}
+}
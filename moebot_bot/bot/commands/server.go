@@ -3,6 +3,7 @@ package commands
 import (
 	"database/sql"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -13,8 +14,23 @@ import (
 )
 
 const serverPossibleCommands = "Possible configs: {WelcomeMessage -> string; max length " + db.MaxMessageLengthString + "} " +
-	"{WelcomeChannel -> ChannelId} {VeteranRank -> number} {VeteranRole -> full role name} {BotChannel -> channel ID} {RuleAgreement -> string; max length " +
-	db.MaxMessageLengthString + "} {StarterRole -> full role name} {BaseRole -> full role name} {Enabled -> true/false}"
+	"{WelcomeChannel -> ChannelId} {BotChannel -> channel ID} {RuleAgreement -> string; max length " +
+	db.MaxMessageLengthString + "} {StarterRole -> full role name} {BaseRole -> full role name} {Enabled -> true/false} " +
+	"{RuleAgreementReply -> string; max length " + db.MaxMessageLengthString + "} {WelcomeTitle -> string} {WelcomeColor -> #RRGGBB} " +
+	"{WelcomeImage -> image URL} {GoodbyeMessage -> string; max length " + db.MaxMessageLengthString + "} {GoodbyeChannel -> channel ID} " +
+	"{LeaverPolicy -> " + db.OptionsForLeaverPolicy + "} {LeaverPurgeDays -> number} {RuleMessage -> channel ID message ID} " +
+	"{VerifyTimeout -> hours} {VerifyTimeoutAction -> " + db.OptionsForVerifyTimeoutAction + "} {VerifyMode -> " + db.OptionsForVerifyMode + "} " +
+	"{VeteranMessagePoints -> number} {VeteranReactionPoints -> number} {VeteranMessageCooldown -> seconds} {VeteranReactionCooldown -> seconds} " +
+	"{VeteranIgnoredPrefixes -> space separated prefixes} {VeteranMinLength -> characters} {VeteranDailyCap -> points} " +
+	"{VeteranVoicePoints -> points per minute} {VeteranVoiceDailyCap -> points} " +
+	"{VeteranChannel -> channel ID multiplier/exclude/default} {DecayPercent -> percent per inactive week} {DecayFloor -> points} " +
+	"{DecayDemote -> true/false}. " +
+	"Use `history`, `diff <version> <version>` or `rollback <version>` to see and undo changes, and `doctor` to check the whole setup. " +
+	"Use `notice <" + db.OptionsForNoticeCategory + "> <" + db.OptionsForNoticeTarget + ">` to choose where my notices go. " +
+	"Rank tiers and their roles are set with the `tier` command."
+
+// how many versions to show in the server history
+const serverHistoryLimit = 20
 
 type ServerCommand struct {
 	ComPrefix string
@@ -33,6 +49,24 @@ func (sc *ServerCommand) Execute(pack *CommPackage) {
 		return
 	}
 
+	switch strings.ToUpper(pack.params[0]) {
+	case "HISTORY":
+		sc.history(pack, s)
+		return
+	case "DIFF":
+		sc.diff(pack, s)
+		return
+	case "ROLLBACK":
+		sc.rollback(pack, s)
+		return
+	case "DOCTOR":
+		sc.doctor(pack, s)
+		return
+	case "NOTICE":
+		sc.notice(pack, s)
+		return
+	}
+
 	// where to start looking for params to this function
 	configKeyIndex := 0
 	// If they asked for a clear, pass that in when processing the config key
@@ -51,7 +85,11 @@ func (sc *ServerCommand) Execute(pack *CommPackage) {
 		configValue = strings.Join(pack.params[configKeyIndex+1:], " ")
 	}
 	if sc.processServerConfigKey(configKey, configValue, pack, &s, shouldClear) {
-		err = db.ServerFullUpdate(s)
+		change := configKey
+		if shouldClear {
+			change = "-clear " + configKey
+		}
+		err = db.ServerFullUpdate(s, pack.message.Author.ID, change)
 		if err != nil {
 			pack.session.ChannelMessageSend(pack.message.ChannelID, "Sorry, there was an error updating the server table. Your change was probably not applied.")
 			return
@@ -64,24 +102,7 @@ func (sc *ServerCommand) processServerConfigKey(configKey string, configValue st
 	// todo: This function is starting to become a little cumbersome... Some has been refactored but more can be done
 	// We only have a help command if we got an empty config value and it's not a clear command
 	isHelp := configValue == "" && !shouldClear
-	if configKey == "VETERANRANK" {
-		if isHelp {
-			pack.session.ChannelMessageSend(pack.channel.ID, "VeteranRank: "+strconv.Itoa(int(util.GetInt64OrDefault(s.VeteranRank))))
-		} else if shouldClear {
-			s.VeteranRank.Scan(nil)
-		} else {
-			rank, err := strconv.Atoi(configValue)
-			if err != nil || rank < 0 {
-				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a positive number for the veteran rank")
-				return false
-			}
-			s.VeteranRank.Scan(int64(rank))
-		}
-	} else if configKey == "VETERANROLE" {
-		if !sc.defaultServerRoleSet(pack, configValue, &s.VeteranRole, isHelp, "VeteranRole", shouldClear) {
-			return
-		}
-	} else if configKey == "BOTCHANNEL" {
+	if configKey == "BOTCHANNEL" {
 		if isHelp {
 			pack.session.ChannelMessageSend(pack.channel.ID, "BotChannel: "+util.GetStringOrDefault(s.BotChannel))
 		} else if shouldClear {
@@ -96,7 +117,7 @@ func (sc *ServerCommand) processServerConfigKey(configKey string, configValue st
 		}
 	} else if configKey == "WELCOMEMESSAGE" {
 		if isHelp {
-			pack.session.ChannelMessageSend(pack.channel.ID, "WelcomeMessage:"+util.GetStringOrDefault(s.WelcomeMessage))
+			pack.session.ChannelMessageSend(pack.channel.ID, "WelcomeMessage: "+util.GetStringOrDefault(s.WelcomeMessage)+"\n"+TemplateHelp)
 		} else if shouldClear {
 			s.WelcomeMessage.Scan(nil)
 		} else {
@@ -108,6 +129,9 @@ func (sc *ServerCommand) processServerConfigKey(configKey string, configValue st
 				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, you can't use moebot's prefix in your welcome message.")
 				return false
 			}
+			if !sc.validateTemplate(pack, configValue) {
+				return false
+			}
 			s.WelcomeMessage.Scan(configValue)
 		}
 	} else if configKey == "WELCOMECHANNEL" {
@@ -139,6 +163,199 @@ func (sc *ServerCommand) processServerConfigKey(configKey string, configValue st
 			}
 			s.RuleAgreement.Scan(configValue)
 		}
+	} else if configKey == "RULEAGREEMENTREPLY" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "RuleAgreementReply: "+util.GetStringOrDefault(s.RuleAgreementReply)+"\n"+TemplateHelp)
+		} else if shouldClear {
+			s.RuleAgreementReply.Scan(nil)
+		} else {
+			if len(configValue) > db.MaxMessageLength {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, this property has a max length of: "+db.MaxMessageLengthString)
+				return false
+			}
+			if !sc.validateTemplate(pack, configValue) {
+				return false
+			}
+			s.RuleAgreementReply.Scan(configValue)
+		}
+	} else if configKey == "WELCOMETITLE" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "WelcomeTitle: "+util.GetStringOrDefault(s.WelcomeTitle)+"\n"+TemplateHelp)
+		} else if shouldClear {
+			s.WelcomeTitle.Scan(nil)
+		} else {
+			if len(configValue) > db.WelcomeTitleMaxLength {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, this property has a max length of: "+strconv.Itoa(db.WelcomeTitleMaxLength))
+				return false
+			}
+			if !sc.validateTemplate(pack, configValue) {
+				return false
+			}
+			s.WelcomeTitle.Scan(configValue)
+		}
+	} else if configKey == "WELCOMECOLOR" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "WelcomeColor: "+fmt.Sprintf("#%06X", util.GetInt64OrDefault(s.WelcomeColor)))
+		} else if shouldClear {
+			s.WelcomeColor.Scan(nil)
+		} else {
+			color, err := parseTemplateColor(configValue)
+			if err != nil {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+err.Error())
+				return false
+			}
+			s.WelcomeColor.Scan(color)
+		}
+	} else if configKey == "WELCOMEIMAGE" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "WelcomeImage: "+util.GetStringOrDefault(s.WelcomeImage))
+		} else if shouldClear {
+			s.WelcomeImage.Scan(nil)
+		} else {
+			if len(configValue) > db.WelcomeImageMaxLength || !(strings.HasPrefix(configValue, "https://") || strings.HasPrefix(configValue, "http://")) {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide an http or https image URL under "+strconv.Itoa(db.WelcomeImageMaxLength)+
+					" characters")
+				return false
+			}
+			s.WelcomeImage.Scan(configValue)
+		}
+	} else if configKey == "GOODBYEMESSAGE" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "GoodbyeMessage: "+util.GetStringOrDefault(s.GoodbyeMessage)+"\n"+TemplateHelp)
+		} else if shouldClear {
+			s.GoodbyeMessage.Scan(nil)
+		} else {
+			if len(configValue) > db.MaxMessageLength {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, this property has a max length of: "+db.MaxMessageLengthString)
+				return false
+			}
+			if !sc.validateTemplate(pack, configValue) {
+				return false
+			}
+			s.GoodbyeMessage.Scan(configValue)
+		}
+	} else if configKey == "GOODBYECHANNEL" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "GoodbyeChannel: "+util.GetStringOrDefault(s.GoodbyeChannel))
+		} else if shouldClear {
+			s.GoodbyeChannel.Scan(nil)
+		} else {
+			c, err := moeDiscord.GetChannel(configValue, pack.session)
+			if err != nil || c.Type != discordgo.ChannelTypeGuildText || c.GuildID != pack.guild.ID {
+				pack.session.ChannelMessageSend(pack.message.ChannelID, "Please provide a valid text channel ID")
+				return false
+			}
+			s.GoodbyeChannel.Scan(c.ID)
+		}
+	} else if configKey == "LEAVERPOLICY" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "LeaverPolicy: "+db.GetStringFromLeaverPolicy(s.LeaverPolicy)+". Options: "+
+				db.OptionsForLeaverPolicy)
+		} else if shouldClear {
+			s.LeaverPolicy = db.LeaverPolicyKeep
+		} else {
+			policy := db.GetLeaverPolicyFromString(configValue)
+			if policy < 0 {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide one of: "+db.OptionsForLeaverPolicy)
+				return false
+			}
+			if policy == db.LeaverPolicyPurge && !s.LeaverPurgeDays.Valid {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please set LeaverPurgeDays before using the purge policy")
+				return false
+			}
+			s.LeaverPolicy = policy
+		}
+	} else if configKey == "LEAVERPURGEDAYS" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "LeaverPurgeDays: "+strconv.Itoa(int(util.GetInt64OrDefault(s.LeaverPurgeDays))))
+		} else if shouldClear {
+			if s.LeaverPolicy == db.LeaverPolicyPurge {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please change LeaverPolicy from purge before clearing LeaverPurgeDays")
+				return false
+			}
+			s.LeaverPurgeDays.Scan(nil)
+		} else {
+			days, err := strconv.Atoi(configValue)
+			if err != nil || days < 1 {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a number of days greater than 0")
+				return false
+			}
+			s.LeaverPurgeDays.Scan(int64(days))
+		}
+	} else if configKey == "RULEMESSAGE" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "RuleMessage: "+util.GetStringOrDefault(s.RuleMessage)+" in channel "+
+				util.GetStringOrDefault(s.RuleMessageChannel)+". Members react with "+RuleAgreementEmoji+" to agree to the rules.")
+		} else if shouldClear {
+			s.RuleMessage.Scan(nil)
+			s.RuleMessageChannel.Scan(nil)
+		} else {
+			ids := strings.Fields(configValue)
+			if len(ids) != 2 {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide the channel ID followed by the message ID of the rules message")
+				return false
+			}
+			c, err := moeDiscord.GetChannel(ids[0], pack.session)
+			if err != nil || c.Type != discordgo.ChannelTypeGuildText || c.GuildID != pack.guild.ID {
+				pack.session.ChannelMessageSend(pack.message.ChannelID, "Please provide a valid text channel ID")
+				return false
+			}
+			if _, err = pack.session.ChannelMessage(c.ID, ids[1]); err != nil {
+				pack.session.ChannelMessageSend(pack.message.ChannelID, "Sorry, I couldn't find that message in that channel")
+				return false
+			}
+			if err = pack.session.MessageReactionAdd(c.ID, ids[1], RuleAgreementEmoji); err != nil {
+				pack.session.ChannelMessageSend(pack.message.ChannelID, "Sorry, I couldn't react to that message. Please make sure I can add reactions "+
+					"in that channel")
+				return false
+			}
+			s.RuleMessageChannel.Scan(c.ID)
+			s.RuleMessage.Scan(ids[1])
+		}
+	} else if configKey == "VERIFYTIMEOUT" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "VerifyTimeout: "+strconv.Itoa(int(util.GetInt64OrDefault(s.VerifyTimeout)))+" hours")
+		} else if shouldClear {
+			s.VerifyTimeout.Scan(nil)
+		} else {
+			hours, err := strconv.Atoi(configValue)
+			if err != nil || hours < 1 {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a number of hours greater than 0")
+				return false
+			}
+			s.VerifyTimeout.Scan(int64(hours))
+		}
+	} else if configKey == "VERIFYTIMEOUTACTION" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "VerifyTimeoutAction: "+db.GetStringFromVerifyTimeoutAction(s.VerifyTimeoutAction)+
+				". Options: "+db.OptionsForVerifyTimeoutAction)
+		} else if shouldClear {
+			s.VerifyTimeoutAction = db.VerifyTimeoutRemind
+		} else {
+			action := db.GetVerifyTimeoutActionFromString(configValue)
+			if action < 0 {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide one of: "+db.OptionsForVerifyTimeoutAction)
+				return false
+			}
+			s.VerifyTimeoutAction = action
+		}
+	} else if configKey == "VERIFYMODE" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "VerifyMode: "+db.GetStringFromVerifyMode(s.VerifyMode)+". Options: "+db.OptionsForVerifyMode)
+		} else if shouldClear {
+			s.VerifyMode = db.VerifyModeRules
+		} else {
+			mode := db.GetVerifyModeFromString(configValue)
+			if mode < 0 {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide one of: "+db.OptionsForVerifyMode)
+				return false
+			}
+			if mode == db.VerifyModeCaptcha && (!s.StarterRole.Valid || !s.BaseRole.Valid) {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please set a StarterRole and BaseRole before using captcha verification")
+				return false
+			}
+			s.VerifyMode = mode
+		}
 	} else if configKey == "BASEROLE" {
 		if !sc.defaultServerRoleSet(pack, configValue, &s.BaseRole, isHelp, "BaseRole", shouldClear) {
 			return
@@ -147,6 +364,87 @@ func (sc *ServerCommand) processServerConfigKey(configKey string, configValue st
 		if !sc.defaultServerRoleSet(pack, configValue, &s.StarterRole, isHelp, "StarterRole", shouldClear) {
 			return
 		}
+	} else if configKey == "VETERANMESSAGEPOINTS" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.VeteranMessagePoints, isHelp, "VeteranMessagePoints", shouldClear, defaultMessagePoints, 0, "points") {
+			return
+		}
+	} else if configKey == "VETERANREACTIONPOINTS" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.VeteranReactionPoints, isHelp, "VeteranReactionPoints", shouldClear, defaultReactionPoints, 0, "points") {
+			return
+		}
+	} else if configKey == "VETERANMESSAGECOOLDOWN" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.VeteranMessageCooldown, isHelp, "VeteranMessageCooldown", shouldClear,
+			int(defaultMessageCooldown.Seconds()), 0, "seconds") {
+			return
+		}
+	} else if configKey == "VETERANREACTIONCOOLDOWN" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.VeteranReactionCooldown, isHelp, "VeteranReactionCooldown", shouldClear,
+			int(defaultReactionCooldown.Seconds()), 0, "seconds") {
+			return
+		}
+	} else if configKey == "VETERANMINLENGTH" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.VeteranMinLength, isHelp, "VeteranMinLength", shouldClear, 0, 0, "characters") {
+			return
+		}
+	} else if configKey == "VETERANDAILYCAP" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.VeteranDailyCap, isHelp, "VeteranDailyCap", shouldClear, 0, 1, "points") {
+			return
+		}
+	} else if configKey == "VETERANVOICEPOINTS" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.VeteranVoicePoints, isHelp, "VeteranVoicePoints", shouldClear, defaultVoicePoints, 0,
+			"points per minute") {
+			return
+		}
+	} else if configKey == "VETERANVOICEDAILYCAP" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.VeteranVoiceDailyCap, isHelp, "VeteranVoiceDailyCap", shouldClear, 0, 1, "points") {
+			return
+		}
+	} else if configKey == "VETERANIGNOREDPREFIXES" {
+		if isHelp {
+			prefixes := defaultIgnoredPrefixes + " (default)"
+			if s.VeteranIgnoredPrefixes.Valid {
+				prefixes = s.VeteranIgnoredPrefixes.String
+			}
+			pack.session.ChannelMessageSend(pack.channel.ID, "VeteranIgnoredPrefixes: "+prefixes+". Messages starting with any of these, or `"+
+				sc.ComPrefix+"`, don't earn veteran points.")
+		} else if shouldClear {
+			s.VeteranIgnoredPrefixes.Scan(nil)
+		} else {
+			if len(configValue) > db.VeteranIgnoredPrefixesMaxLength {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, this property has a max length of: "+
+					strconv.Itoa(db.VeteranIgnoredPrefixesMaxLength))
+				return false
+			}
+			s.VeteranIgnoredPrefixes.Scan(strings.Join(strings.Fields(configValue), " "))
+		}
+	} else if configKey == "VETERANCHANNEL" {
+		return sc.veteranChannelSet(pack, configValue, s, isHelp, shouldClear)
+	} else if configKey == "DECAYPERCENT" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.DecayPercent, isHelp, "DecayPercent", shouldClear, 0, 1, "percent") {
+			return
+		}
+		if s.DecayPercent.Int64 > 100 {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a percent from 1 to 100")
+			return false
+		}
+	} else if configKey == "DECAYFLOOR" {
+		if !sc.defaultServerNumberSet(pack, configValue, &s.DecayFloor, isHelp, "DecayFloor", shouldClear, 0, 0, "points") {
+			return
+		}
+	} else if configKey == "DECAYDEMOTE" {
+		if isHelp {
+			pack.session.ChannelMessageSend(pack.channel.ID, "DecayDemote: "+strconv.FormatBool(s.DecayDemote)+". When true, members who decay "+
+				"below a tier they reached lose it and its role, after a warning.")
+		} else if shouldClear {
+			s.DecayDemote = false
+		} else {
+			newBool, err := strconv.ParseBool(configValue)
+			if err != nil {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I don't recognize that as a boolean. Please provide either true/false.")
+				return
+			}
+			s.DecayDemote = newBool
+		}
 	} else if configKey == "ENABLED" {
 		if isHelp {
 			pack.session.ChannelMessageSend(pack.channel.ID, "Enabled: "+strconv.FormatBool(s.Enabled))
@@ -182,11 +480,294 @@ func (sc *ServerCommand) defaultServerRoleSet(pack *CommPackage, configValue str
 			pack.session.ChannelMessageSend(pack.message.ChannelID, "Please provide a valid role and make sure it's the full role name")
 			return false
 		}
+		if err := CheckRoleManageable(pack.session, pack.guild, role); err != nil {
+			pack.session.ChannelMessageSend(pack.message.ChannelID, "Sorry, "+err.Error()+" "+name+" was not updated.")
+			return false
+		}
 		toSet.Scan(role.ID)
 	}
 	return true
 }
 
+/*
+Shows or sets a number that falls back to a default when it isn't set
+*/
+func (sc *ServerCommand) defaultServerNumberSet(pack *CommPackage, configValue string, toSet *sql.NullInt64, isHelp bool, name string,
+	shouldClear bool, defaultValue int, min int, unit string) (shouldReturn bool) {
+
+	if isHelp {
+		current := strconv.Itoa(defaultValue) + " " + unit + " (default)"
+		if toSet.Valid {
+			current = strconv.Itoa(int(toSet.Int64)) + " " + unit
+		} else if defaultValue == 0 {
+			current = "not set"
+		}
+		pack.session.ChannelMessageSend(pack.channel.ID, name+": "+current)
+		return false
+	} else if shouldClear {
+		toSet.Scan(nil)
+	} else {
+		value, err := strconv.Atoi(configValue)
+		if err != nil || value < min {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a number of "+unit+" that's at least "+strconv.Itoa(min))
+			return false
+		}
+		toSet.Scan(int64(value))
+	}
+	return true
+}
+
+/*
+Changes the veteran point multiplier of a single channel, or clears every channel's multiplier
+*/
+func (sc *ServerCommand) veteranChannelSet(pack *CommPackage, configValue string, s *db.Server, isHelp bool, shouldClear bool) bool {
+	if shouldClear {
+		s.VeteranChannels.Scan(nil)
+		return true
+	}
+	channels, _ := parseVeteranChannels(s.VeteranChannels.String)
+	if isHelp {
+		var lines []string
+		for _, entry := range strings.Fields(formatVeteranChannels(channels)) {
+			split := strings.Split(entry, ":")
+			if split[1] == "0" {
+				lines = append(lines, "<#"+split[0]+">: excluded")
+			} else {
+				lines = append(lines, "<#"+split[0]+">: x"+split[1])
+			}
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "Every channel earns normal points.")
+		}
+		pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("VeteranChannel: use `"+sc.ComPrefix+
+			" server VeteranChannel <channel ID> <multiplier|exclude|default>` to change a channel.", lines))
+		return false
+	}
+	params := strings.Fields(configValue)
+	if len(params) != 2 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a channel ID followed by a multiplier, `exclude` or `default`")
+		return false
+	}
+	if strings.EqualFold(params[1], "default") {
+		// no need to look the channel up, it may have been deleted since it was set
+		if _, ok := channels[params[0]]; !ok {
+			pack.session.ChannelMessageSend(pack.channel.ID, "That channel already earns normal points.")
+			return false
+		}
+		delete(channels, params[0])
+	} else {
+		c, err := moeDiscord.GetChannel(params[0], pack.session)
+		if err != nil || c.GuildID != pack.guild.ID {
+			pack.session.ChannelMessageSend(pack.message.ChannelID, "Please provide a valid channel ID")
+			return false
+		}
+		var multiplier float64
+		if !strings.EqualFold(params[1], "exclude") {
+			multiplier, err = strconv.ParseFloat(params[1], 64)
+			if err != nil || multiplier < 0 || multiplier > maxChannelMultiplier {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a multiplier from 0 to "+strconv.Itoa(maxChannelMultiplier))
+				return false
+			}
+		}
+		channels[c.ID] = multiplier
+	}
+	formatted := formatVeteranChannels(channels)
+	if len(formatted) > db.MaxMessageLength {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there are too many channels with multipliers. Please set some back to default first.")
+		return false
+	}
+	if formatted == "" {
+		s.VeteranChannels.Scan(nil)
+	} else {
+		s.VeteranChannels.Scan(formatted)
+	}
+	return true
+}
+
+/*
+Checks a templated message, letting the user know what's wrong with it if it's invalid
+*/
+func (sc *ServerCommand) validateTemplate(pack *CommPackage, template string) bool {
+	if err := ValidateTemplate(template, pack.guild); err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+err.Error()+". Nothing was updated.\n"+TemplateHelp)
+		return false
+	}
+	return true
+}
+
+/*
+Shows or changes where each category of notices gets sent
+*/
+func (sc *ServerCommand) notice(pack *CommPackage, s db.Server) {
+	if len(pack.params) < 3 {
+		routes, err := db.NoticeRouteQueryServer(s.Id)
+		if err != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading this server's notices. This is an issue with moebot not discord.")
+			return
+		}
+		var lines []string
+		for _, r := range routes {
+			lines = append(lines, db.GetStringFromNoticeCategory(r.Category)+": "+db.GetStringFromNoticeRoute(r))
+		}
+		pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("Notices are sent to:", lines)+"\nUse `"+sc.ComPrefix+
+			" server notice <"+db.OptionsForNoticeCategory+"> <"+db.OptionsForNoticeTarget+">` to change them.")
+		return
+	}
+	category := db.GetNoticeCategoryFromString(pack.params[1])
+	if category < 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a valid notice category. One of: "+db.OptionsForNoticeCategory)
+		return
+	}
+	route := db.NoticeRoute{ServerId: s.Id, Category: category, Target: db.GetNoticeTargetFromString(pack.params[2])}
+	if route.Target < 0 || (route.Target == db.NoticeTargetChannel) != (len(pack.params) == 4) || len(pack.params) > 4 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a valid place for notices. One of: "+db.OptionsForNoticeTarget)
+		return
+	}
+	if route.Target == db.NoticeTargetChannel {
+		c, err := moeDiscord.GetChannel(pack.params[3], pack.session)
+		if err != nil || c.Type != discordgo.ChannelTypeGuildText || c.GuildID != pack.guild.ID {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a valid text channel ID")
+			return
+		}
+		route.ChannelUid.Scan(c.ID)
+	}
+	if db.NoticeRouteSet(route) != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error updating this server's notices. Your change was probably not applied.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, "Sending "+db.GetStringFromNoticeCategory(category)+" notices to: "+db.GetStringFromNoticeRoute(route))
+}
+
+/*
+Lists the most recent versions of the server configuration, with who changed what
+*/
+func (sc *ServerCommand) history(pack *CommPackage, s db.Server) {
+	versions, err := db.ServerVersionQueryAll(s.Id, serverHistoryLimit)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading the server history. This is an issue with moebot not discord.")
+		return
+	}
+	if len(versions) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "This server's configuration hasn't been changed yet.")
+		return
+	}
+	var lines []string
+	for _, v := range versions {
+		actor := "moebot"
+		if v.ActorUid.Valid {
+			actor = "<@" + v.ActorUid.String + ">"
+		}
+		lines = append(lines, "`v"+strconv.Itoa(v.Version)+"` "+v.CreatedAt.UTC().Format("2006-01-02 15:04")+" UTC by "+actor+": "+v.Change)
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("Configuration history, newest first:", lines))
+}
+
+/*
+Shows every setting that differs between two versions
+*/
+func (sc *ServerCommand) diff(pack *CommPackage, s db.Server) {
+	if len(pack.params) != 3 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide two versions to compare. Example: `"+sc.ComPrefix+" server diff 3 5`")
+		return
+	}
+	var versions [2]db.ServerVersion
+	for i, param := range pack.params[1:] {
+		v, ok := sc.loadVersion(pack, s, param)
+		if !ok {
+			return
+		}
+		versions[i] = v
+	}
+	changes := diffServerSnapshots(versions[0].Snapshot, versions[1].Snapshot)
+	header := "Changes from v" + strconv.Itoa(versions[0].Version) + " to v" + strconv.Itoa(versions[1].Version) + ":"
+	if len(changes) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, header+" none, they're the same configuration.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines(header, changes))
+}
+
+/*
+Puts the configuration back to how it was at the given version
+*/
+func (sc *ServerCommand) rollback(pack *CommPackage, s db.Server) {
+	if len(pack.params) != 2 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a version to roll back to. Example: `"+sc.ComPrefix+" server rollback 3`")
+		return
+	}
+	target, ok := sc.loadVersion(pack, s, pack.params[1])
+	if !ok {
+		return
+	}
+	_, err := db.ServerRollback(s.Id, target.Version, pack.message.Author.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error rolling back the configuration. Nothing was changed.")
+		return
+	}
+	changes := diffServerSnapshots(s, target.Snapshot)
+	pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("Rolled back to v"+strconv.Itoa(target.Version)+". Changed settings:", changes))
+}
+
+func (sc *ServerCommand) loadVersion(pack *CommPackage, s db.Server, param string) (v db.ServerVersion, ok bool) {
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(param), "v"))
+	if err != nil || version < 1 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a valid version number. Use `"+sc.ComPrefix+" server history` to see them.")
+		return
+	}
+	v, err = db.ServerVersionQuery(s.Id, version)
+	if err == sql.ErrNoRows {
+		pack.session.ChannelMessageSend(pack.channel.ID, "There's no version "+strconv.Itoa(version)+" of this server's configuration.")
+		return
+	} else if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading that version. This is an issue with moebot not discord.")
+		return
+	}
+	return v, true
+}
+
+/*
+Lists every setting that's different between two configurations, as "Setting: old -> new"
+*/
+func diffServerSnapshots(from db.Server, to db.Server) (changes []string) {
+	fromValue := reflect.ValueOf(from)
+	toValue := reflect.ValueOf(to)
+	for i := 0; i < fromValue.NumField(); i++ {
+		name := fromValue.Type().Field(i).Name
+		if name == "Id" || name == "GuildUid" {
+			continue
+		}
+		oldSetting := formatServerSetting(fromValue.Field(i).Interface())
+		newSetting := formatServerSetting(toValue.Field(i).Interface())
+		if oldSetting != newSetting {
+			changes = append(changes, name+": "+oldSetting+" -> "+newSetting)
+		}
+	}
+	return
+}
+
+func formatServerSetting(setting interface{}) string {
+	switch v := setting.(type) {
+	case sql.NullString:
+		if !v.Valid {
+			return "(none)"
+		}
+		return strconv.Quote(v.String)
+	case sql.NullInt64:
+		if !v.Valid {
+			return "(none)"
+		}
+		return strconv.FormatInt(v.Int64, 10)
+	case db.LeaverPolicy:
+		return db.GetStringFromLeaverPolicy(v)
+	case db.VerifyTimeoutAction:
+		return db.GetStringFromVerifyTimeoutAction(v)
+	case db.VerifyMode:
+		return db.GetStringFromVerifyMode(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 func (sc *ServerCommand) GetPermLevel() db.Permission {
 	return db.PermMod
 }
@@ -196,5 +777,7 @@ func (sc *ServerCommand) GetCommandKeys() []string {
 }
 
 func (sc *ServerCommand) GetCommandHelp(commPrefix string) string {
-	return fmt.Sprintf("`%[1]s server <config setting> <value>` - Master/Mod Changes a config setting on the server to a given value. `%[1]s server` to list configs.", commPrefix)
+	return fmt.Sprintf("`%[1]s server <config setting> <value>` - Master/Mod Changes a config setting on the server to a given value. `%[1]s server` to list configs. "+
+		"`%[1]s server history`, `%[1]s server diff <v1> <v2>` and `%[1]s server rollback <version>` to review or undo changes. "+
+		"`%[1]s server doctor` checks the setup for problems.", commPrefix)
 }
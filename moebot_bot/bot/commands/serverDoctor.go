@@ -0,0 +1,361 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+/*
+Something wrong with a server's setup, along with how to fix it
+*/
+type doctorProblem struct {
+	Problem string
+	Fix     string
+}
+
+/*
+Checks a server's whole setup against what discord currently has, for the `server doctor` command
+*/
+type serverDoctor struct {
+	session   *discordgo.Session
+	guild     *discordgo.Guild
+	botMember *discordgo.Member
+	server    db.Server
+	comPrefix string
+	// who asked for the checkup, used to check DMs work
+	authorUid string
+	problems  []doctorProblem
+}
+
+func (sc *ServerCommand) doctor(pack *CommPackage, s db.Server) {
+	botMember, err := moeDiscord.GetMember(pack.session.State.User.ID, pack.guild.ID, pack.session)
+	if err != nil || botMember == nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I couldn't look up my own roles in this server. Please try again later.")
+		return
+	}
+	d := &serverDoctor{
+		session:   pack.session,
+		guild:     pack.guild,
+		botMember: botMember,
+		server:    s,
+		comPrefix: sc.ComPrefix,
+		authorUid: pack.message.Author.ID,
+	}
+	if !d.run() {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading this server's settings. This is an issue with moebot not discord.")
+		return
+	}
+	if len(d.problems) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "I checked everything and this server's setup looks good!")
+		return
+	}
+	var lines []string
+	for _, p := range d.problems {
+		lines = append(lines, "- "+p.Problem+"\n  Fix: "+p.Fix)
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("Found "+strconv.Itoa(len(d.problems))+" problems with this server's setup:", lines))
+}
+
+/*
+Runs every check. Returns false if moebot's own settings couldn't be loaded
+*/
+func (d *serverDoctor) run() bool {
+	d.problems = append(d.problems, serverConfigProblems(d.server, d.comPrefix)...)
+	d.checkChannels()
+	d.checkServerRoles()
+	d.checkDirectMessages()
+	return d.checkNoticeRoutes() && d.checkRoleRows() && d.checkRankTiers() && d.checkPinMove()
+}
+
+func (d *serverDoctor) add(problem string, fix string) {
+	d.problems = append(d.problems, doctorProblem{Problem: problem, Fix: fix})
+}
+
+func (d *serverDoctor) command(params string) string {
+	return "`" + d.comPrefix + " " + params + "`"
+}
+
+func (d *serverDoctor) checkChannels() {
+	channels := []struct {
+		name        string
+		channel     string
+		permissions int
+	}{
+		{"BotChannel", d.server.BotChannel.String, discordgo.PermissionReadMessages | discordgo.PermissionSendMessages},
+		{"WelcomeChannel", d.server.WelcomeChannel.String, discordgo.PermissionReadMessages | discordgo.PermissionSendMessages | discordgo.PermissionEmbedLinks},
+		{"GoodbyeChannel", d.server.GoodbyeChannel.String, discordgo.PermissionReadMessages | discordgo.PermissionSendMessages | discordgo.PermissionEmbedLinks},
+		{"RuleMessage", d.server.RuleMessageChannel.String, discordgo.PermissionReadMessages | discordgo.PermissionReadMessageHistory |
+			discordgo.PermissionAddReactions},
+	}
+	for _, c := range channels {
+		if c.channel == "" {
+			continue
+		}
+		if d.findChannel(c.channel) == nil {
+			d.add(c.name+" points at a channel that no longer exists.", "Set a new one with "+d.command("server "+c.name+" <channel ID>")+
+				" or remove it with "+d.command("server -clear "+c.name))
+			continue
+		}
+		d.checkChannelPermissions(c.name, c.channel, c.permissions)
+	}
+	if d.server.RuleMessage.Valid && d.findChannel(d.server.RuleMessageChannel.String) != nil {
+		if _, err := d.session.ChannelMessage(d.server.RuleMessageChannel.String, d.server.RuleMessage.String); err != nil {
+			d.add("The RuleMessage was deleted or I can't read it.", "Set a new one with "+d.command("server RuleMessage <channel ID> <message ID>")+
+				" or remove it with "+d.command("server -clear RuleMessage"))
+		}
+	}
+	veteranChannels, _ := parseVeteranChannels(d.server.VeteranChannels.String)
+	for channelUid := range veteranChannels {
+		if d.findChannel(channelUid) == nil {
+			d.add("A VeteranChannel multiplier is set for a channel that no longer exists.", "Remove it with "+
+				d.command("server VeteranChannel "+channelUid+" default"))
+		}
+	}
+}
+
+func (d *serverDoctor) checkChannelPermissions(name string, channelUid string, needed int) {
+	permissions, err := d.session.State.UserChannelPermissions(d.botMember.User.ID, channelUid)
+	if err != nil {
+		permissions, err = d.session.UserChannelPermissions(d.botMember.User.ID, channelUid)
+		if err != nil {
+			d.add("I couldn't check my permissions in "+name+" <#"+channelUid+">.", "Make sure I can see that channel")
+			return
+		}
+	}
+	if missing := missingPermissionNames(permissions, needed); len(missing) > 0 {
+		d.add("I'm missing permissions in "+name+" <#"+channelUid+">: "+strings.Join(missing, ", ")+".",
+			"Give one of my roles those permissions in that channel's settings")
+	}
+}
+
+func (d *serverDoctor) checkServerRoles() {
+	roles := []struct {
+		name string
+		role string
+	}{
+		{"StarterRole", d.server.StarterRole.String},
+		{"BaseRole", d.server.BaseRole.String},
+	}
+	for _, r := range roles {
+		if r.role == "" {
+			continue
+		}
+		role := moeDiscord.FindRoleById(d.guild.Roles, r.role)
+		if role == nil {
+			d.add(r.name+" points at a role that no longer exists.", "Set a new one with "+d.command("server "+r.name+" <full role name>")+
+				" or remove it with "+d.command("server -clear "+r.name))
+			continue
+		}
+		d.checkRoleManageable(r.name, role)
+	}
+}
+
+/*
+Welcome messages, captchas and verify reminders all get sent by DM, so make sure moebot can send them at all
+*/
+func (d *serverDoctor) checkDirectMessages() {
+	usesDirectMessages := (d.server.WelcomeMessage.Valid && !d.server.WelcomeChannel.Valid) || d.server.VerifyMode == db.VerifyModeCaptcha ||
+		(d.server.VerifyTimeout.Valid && d.server.VerifyTimeoutAction == db.VerifyTimeoutRemind)
+	if !usesDirectMessages {
+		return
+	}
+	dmChannel, err := d.session.UserChannelCreate(d.authorUid)
+	if err == nil {
+		_, err = d.session.ChannelMessageSend(dmChannel.ID, "This is a test message from `server doctor` in "+d.guild.Name+
+			", checking that I can send DMs.")
+	}
+	if err != nil {
+		d.add("This server sends DMs to members, but I couldn't send one to you.", "Allow direct messages from server members in your privacy "+
+			"settings and run "+d.command("server doctor")+" again. Members with DMs turned off won't get welcome messages, captchas or reminders")
+	}
+}
+
+/*
+Checks every category of notices has somewhere to go
+*/
+func (d *serverDoctor) checkNoticeRoutes() bool {
+	routes, err := db.NoticeRouteQueryServer(d.server.Id)
+	if err != nil {
+		return false
+	}
+	for _, r := range routes {
+		category := db.GetStringFromNoticeCategory(r.Category)
+		if r.Target != db.NoticeTargetChannel {
+			continue
+		}
+		if d.findChannel(r.ChannelUid.String) == nil {
+			d.add("The "+category+" notices go to a channel that no longer exists.", "Set a new one with "+
+				d.command("server notice "+category+" channel <channel ID>")+" or send them to the bot channel with "+
+				d.command("server notice "+category+" botchannel"))
+			continue
+		}
+		d.checkChannelPermissions(category+" notices", r.ChannelUid.String, discordgo.PermissionReadMessages|discordgo.PermissionSendMessages)
+	}
+	return true
+}
+
+/*
+Checks every role set up with the roleset command, and every group they belong to
+*/
+func (d *serverDoctor) checkRoleRows() bool {
+	roles, err := db.RoleQueryServer(d.server)
+	if err != nil {
+		return false
+	}
+	groups, err := db.RoleGroupQueryServer(d.server)
+	if err != nil {
+		return false
+	}
+	roleCount := make(map[int]int)
+	for _, dbRole := range roles {
+		roleCount[dbRole.GroupId]++
+		role := moeDiscord.FindRoleById(d.guild.Roles, dbRole.RoleUid)
+		if role == nil {
+			if dbRole.Trigger.Valid {
+				d.add("The trigger `"+dbRole.Trigger.String+"` gives a role that no longer exists.", "Remove it with "+
+					d.command("roleset -delete "+dbRole.RoleUid))
+			} else {
+				d.add("Role permissions are set for a role that no longer exists (ID "+dbRole.RoleUid+").", "Remove them with "+
+					d.command("roleset -delete "+dbRole.RoleUid))
+			}
+			continue
+		}
+		if dbRole.Trigger.Valid {
+			d.checkRoleManageable("The trigger `"+dbRole.Trigger.String+"`", role)
+		}
+	}
+	for _, group := range groups {
+		if roleCount[group.Id] == 0 && group.Name != db.UncategorizedGroup {
+			d.add("The group `"+group.Name+"` has no roles.", "Add one with "+d.command("roleset -role <role name> -group "+group.Name)+
+				" or delete it with "+d.command("groupset -delete "+group.Name))
+		}
+	}
+	return true
+}
+
+/*
+Checks every rank tier's role can still be given out
+*/
+func (d *serverDoctor) checkRankTiers() bool {
+	tiers, err := db.RankTierQueryServer(d.server.Id)
+	if err != nil {
+		return false
+	}
+	for _, tier := range tiers {
+		if !tier.RoleUid.Valid {
+			continue
+		}
+		role := moeDiscord.FindRoleById(d.guild.Roles, tier.RoleUid.String)
+		if role == nil {
+			d.add("The `"+tier.Name+"` tier gives a role that no longer exists.", "Set a new one with "+
+				d.command("tier role "+tier.Name+" <full role name>")+" or remove it with "+d.command("tier role "+tier.Name+" -clear"))
+			continue
+		}
+		d.checkRoleManageable("The `"+tier.Name+"` tier", role)
+	}
+	return true
+}
+
+/*
+Checks every channel with pin moving turned on can still move its pins somewhere
+*/
+func (d *serverDoctor) checkPinMove() bool {
+	channels, err := db.ChannelQueryByServer(d.server)
+	if err != nil {
+		return false
+	}
+	for _, c := range channels {
+		if !c.MovePins || !c.MoveChannelUid.Valid {
+			continue
+		}
+		if d.findChannel(c.ChannelUid) == nil {
+			// nothing to move pins from, so nothing can break
+			continue
+		}
+		if d.findChannel(c.MoveChannelUid.String) == nil {
+			d.add("Pins in <#"+c.ChannelUid+"> are moved to a channel that no longer exists.", "Set a new destination with "+
+				d.command("pinmove -channel <#"+c.ChannelUid+"> -dest <#new-channel>"))
+			continue
+		}
+		d.checkChannelPermissions("the pin destination for <#"+c.ChannelUid+">", c.MoveChannelUid.String, discordgo.PermissionReadMessages|
+			discordgo.PermissionSendMessages|discordgo.PermissionEmbedLinks|discordgo.PermissionAttachFiles)
+	}
+	return true
+}
+
+func (d *serverDoctor) checkRoleManageable(name string, role *discordgo.Role) {
+	if err := checkRoleManageable(d.guild, d.botMember, role); err != nil {
+		d.add(name+": I can't assign `"+role.Name+"`.", err.(*RoleManageError).Reason)
+	}
+}
+
+func (d *serverDoctor) findChannel(channelUid string) *discordgo.Channel {
+	for _, c := range d.guild.Channels {
+		if c.ID == channelUid {
+			return c
+		}
+	}
+	return nil
+}
+
+/*
+Checks settings that only make sense together, without needing to ask discord anything
+*/
+func serverConfigProblems(s db.Server, comPrefix string) (problems []doctorProblem) {
+	add := func(problem string, fix string) {
+		problems = append(problems, doctorProblem{Problem: problem, Fix: "`" + comPrefix + " " + fix + "`"})
+	}
+	if s.WelcomeChannel.Valid && !s.WelcomeMessage.Valid {
+		add("There's a WelcomeChannel but no WelcomeMessage.", "server WelcomeMessage <message>")
+	}
+	if s.RuleAgreement.Valid && !s.BaseRole.Valid {
+		add("There's a RuleAgreement but no BaseRole to give when someone agrees.", "server BaseRole <full role name>")
+	}
+	if s.RuleMessage.Valid && (!s.StarterRole.Valid || !s.BaseRole.Valid) {
+		add("There's a RuleMessage but the StarterRole or BaseRole isn't set.", "server StarterRole <full role name>")
+	}
+	if s.VerifyMode == db.VerifyModeCaptcha && (!s.StarterRole.Valid || !s.BaseRole.Valid) {
+		add("Captcha verification is on but the StarterRole or BaseRole isn't set.", "server StarterRole <full role name>")
+	}
+	if s.VerifyTimeout.Valid && !s.StarterRole.Valid {
+		add("There's a VerifyTimeout but no StarterRole to time out.", "server StarterRole <full role name>")
+	}
+	if s.LeaverPolicy == db.LeaverPolicyPurge && !s.LeaverPurgeDays.Valid {
+		add("The LeaverPolicy is purge but LeaverPurgeDays isn't set.", "server LeaverPurgeDays <number>")
+	}
+	if !s.BotChannel.Valid {
+		add("There's no BotChannel, so I can't tell you when something goes wrong.", "server BotChannel <channel ID>")
+	}
+	return
+}
+
+var permissionNames = []struct {
+	permission int
+	name       string
+}{
+	{discordgo.PermissionReadMessages, "Read Messages"},
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionEmbedLinks, "Embed Links"},
+	{discordgo.PermissionAttachFiles, "Attach Files"},
+	{discordgo.PermissionReadMessageHistory, "Read Message History"},
+	{discordgo.PermissionAddReactions, "Add Reactions"},
+}
+
+/*
+Names every permission in needed that isn't in have
+*/
+func missingPermissionNames(have int, needed int) (missing []string) {
+	if have&discordgo.PermissionAdministrator != 0 {
+		return
+	}
+	for _, p := range permissionNames {
+		if needed&p.permission != 0 && have&p.permission == 0 {
+			missing = append(missing, p.name)
+		}
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+func TestServerDoctor_MissingPermissionNames(t *testing.T) {
+	checks := []struct {
+		have   int
+		needed int
+		out    []string
+	}{
+		{discordgo.PermissionReadMessages | discordgo.PermissionSendMessages, discordgo.PermissionReadMessages | discordgo.PermissionSendMessages, nil},
+		{discordgo.PermissionReadMessages, discordgo.PermissionReadMessages | discordgo.PermissionSendMessages, []string{"Send Messages"}},
+		{0, discordgo.PermissionSendMessages | discordgo.PermissionAttachFiles, []string{"Send Messages", "Attach Files"}},
+		{discordgo.PermissionAdministrator, discordgo.PermissionSendMessages | discordgo.PermissionAttachFiles, nil},
+	}
+	for _, c := range checks {
+		if res := missingPermissionNames(c.have, c.needed); !reflect.DeepEqual(res, c.out) {
+			t.Errorf("Incorrect missing permissions for have: %d, needed: %d. Got: %v, expected: %v", c.have, c.needed, res, c.out)
+		}
+	}
+}
+
+func TestServerDoctor_ServerConfigProblems(t *testing.T) {
+	set := sql.NullString{String: "1", Valid: true}
+	checks := []struct {
+		server db.Server
+		count  int
+	}{
+		{db.Server{BotChannel: set}, 0},
+		{db.Server{}, 1},
+		{db.Server{BotChannel: set, WelcomeChannel: set}, 1},
+		{db.Server{BotChannel: set, RuleAgreement: set, BaseRole: set}, 0},
+		{db.Server{BotChannel: set, VerifyMode: db.VerifyModeCaptcha, StarterRole: set}, 1},
+		{db.Server{BotChannel: set, VerifyTimeout: sql.NullInt64{Int64: 1, Valid: true}}, 1},
+		{db.Server{BotChannel: set, LeaverPolicy: db.LeaverPolicyPurge, VerifyTimeout: sql.NullInt64{Int64: 1, Valid: true}}, 2},
+	}
+	for i, c := range checks {
+		if res := serverConfigProblems(c.server, "mb"); len(res) != c.count {
+			t.Errorf("Incorrect problem count for check %d. Got: %v, expected %d problems", i, res, c.count)
+		}
+	}
+}
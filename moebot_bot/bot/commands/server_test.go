@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+func TestServer_DiffServerSnapshots(t *testing.T) {
+	base := db.Server{Id: 1, GuildUid: "123", Enabled: true, WelcomeMessage: sql.NullString{String: "hi", Valid: true}}
+	checks := []struct {
+		from db.Server
+		to   db.Server
+		out  []string
+	}{
+		{base, base, nil},
+		{base, db.Server{Id: 2, GuildUid: "456", Enabled: true, WelcomeMessage: sql.NullString{String: "hi", Valid: true}}, nil},
+		{base, db.Server{Enabled: false, WelcomeMessage: sql.NullString{String: "hi", Valid: true}}, []string{"Enabled: true -> false"}},
+		{base, db.Server{Enabled: true}, []string{`WelcomeMessage: "hi" -> (none)`}},
+		{base, db.Server{Enabled: true, WelcomeMessage: sql.NullString{String: "hi", Valid: true}, VeteranDailyCap: sql.NullInt64{Int64: 500, Valid: true},
+			VerifyMode: db.VerifyModeCaptcha}, []string{"VerifyMode: rules -> captcha", "VeteranDailyCap: (none) -> 500"}},
+	}
+	for _, c := range checks {
+		if res := diffServerSnapshots(c.from, c.to); !reflect.DeepEqual(res, c.out) {
+			t.Errorf("Incorrect diff. Got: %v, expected: %v", res, c.out)
+		}
+	}
+}
@@ -17,8 +17,7 @@ func (sc *SubmitCommand) Execute(pack *CommPackage) {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, submissions are closed!")
 		return
 	}
-	// Salt
-	if pack.guild.ID != "93799773856862208" {
+	if !db.AccessListContains(db.AccessListRaffleGuild, pack.guild.ID) {
 		pack.session.ChannelMessageSend(pack.channel.ID, "Raffles are not enabled in this server! Speak to Salt to get your server added to the raffle!")
 		return
 	}
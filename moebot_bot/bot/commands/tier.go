@@ -0,0 +1,280 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+/*
+Manages a server's rank ladder, the tiers members are promoted through as they earn veteran points
+*/
+type TierCommand struct {
+	ComPrefix string
+}
+
+func (tc *TierCommand) Execute(pack *CommPackage) {
+	server, err := db.ServerQueryOrInsert(pack.guild.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading server information. This is an issue with moebot not discord.")
+		return
+	}
+	tiers, err := db.RankTierQueryServer(server.Id)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading the rank tiers. This is an issue with moebot not discord.")
+		return
+	}
+	if len(pack.params) == 0 {
+		tc.printLadder(pack, tiers)
+		return
+	}
+	if strings.EqualFold(pack.params[0], "add") {
+		tc.add(pack, server, tiers)
+		return
+	}
+	if len(pack.params) < 2 {
+		pack.session.ChannelMessageSend(pack.channel.ID, tc.GetCommandHelp(tc.ComPrefix))
+		return
+	}
+	tier := db.RankTierFindName(tiers, pack.params[1])
+	if tier == nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there's no tier named `"+pack.params[1]+"`. Use `"+tc.ComPrefix+
+			" tier` to see them all.")
+		return
+	}
+	value := strings.Join(pack.params[2:], " ")
+	switch strings.ToUpper(pack.params[0]) {
+	case "REMOVE":
+		if db.RankTierDelete(*tier) != nil {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error removing the tier. This is an issue with moebot not discord.")
+			return
+		}
+		pack.session.ChannelMessageSend(pack.channel.ID, "Removed the `"+tier.Name+"` tier. Members keep any role they already got from it.")
+		return
+	case "THRESHOLD":
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 1 {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a number of points greater than 0")
+			return
+		}
+		if other := rankTierAtThreshold(tiers, threshold); other != nil && other.Id != tier.Id {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, the `"+other.Name+"` tier is already at "+value+" points.")
+			return
+		}
+		tier.Threshold = threshold
+	case "ROLE":
+		if strings.EqualFold(value, "-clear") {
+			tier.RoleUid.Scan(nil)
+		} else {
+			role := moeDiscord.FindRoleByName(pack.guild.Roles, value)
+			if role == nil {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a valid role and make sure it's the full role name")
+				return
+			}
+			if err := CheckRoleManageable(pack.session, pack.guild, role); err != nil {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+err.Error()+" The tier was not updated.")
+				return
+			}
+			tier.RoleUid.Scan(role.ID)
+		}
+	case "GRANT":
+		if strings.EqualFold(value, "auto") {
+			tier.AutoGrant = true
+		} else if strings.EqualFold(value, "offer") {
+			tier.AutoGrant = false
+		} else {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide `auto` to give the role as soon as the tier is reached, or `offer` "+
+				"to let members claim it with `"+tc.ComPrefix+" role "+tier.Name+"`.")
+			return
+		}
+	case "ANNOUNCE":
+		if value == "" {
+			pack.session.ChannelMessageSend(pack.channel.ID, "Please provide the announcement, or `-clear` to use the default one. "+TemplateHelp)
+			return
+		} else if strings.EqualFold(value, "-clear") {
+			tier.Announcement.Scan(nil)
+		} else {
+			if len(value) > db.MaxMessageLength {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, this property has a max length of: "+db.MaxMessageLengthString)
+				return
+			}
+			if err := ValidateTemplate(value, pack.guild); err != nil {
+				pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, "+err.Error()+". Nothing was updated.\n"+TemplateHelp)
+				return
+			}
+			tier.Announcement.Scan(value)
+		}
+	default:
+		pack.session.ChannelMessageSend(pack.channel.ID, tc.GetCommandHelp(tc.ComPrefix))
+		return
+	}
+	if db.RankTierUpdate(*tier) != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error updating the tier. This is an issue with moebot not discord.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, "Updated the `"+tier.Name+"` tier!")
+}
+
+func (tc *TierCommand) add(pack *CommPackage, server db.Server, tiers []db.RankTier) {
+	if len(pack.params) != 3 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide the points needed and a one word name. Example: `"+tc.ComPrefix+
+			" tier add 500 Regular`")
+		return
+	}
+	threshold, err := strconv.Atoi(pack.params[1])
+	if err != nil || threshold < 1 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Please provide a number of points greater than 0")
+		return
+	}
+	name := pack.params[2]
+	if len(name) > db.RankTierMaxNameLength {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, tier names have a max length of: "+db.RankTierMaxNameLengthString)
+		return
+	}
+	if db.RankTierFindName(tiers, name) != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there's already a tier named `"+name+"`.")
+		return
+	}
+	if other := rankTierAtThreshold(tiers, threshold); other != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, the `"+other.Name+"` tier is already at "+pack.params[1]+" points.")
+		return
+	}
+	if db.RankTierInsert(db.RankTier{ServerId: server.Id, Name: name, Threshold: threshold}) != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error adding the tier. This is an issue with moebot not discord.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, "Added the `"+name+"` tier at "+pack.params[1]+" points. Use `"+tc.ComPrefix+" tier role "+name+
+		" <full role name>` to give it a role.")
+}
+
+func (tc *TierCommand) printLadder(pack *CommPackage, tiers []db.RankTier) {
+	if len(tiers) == 0 {
+		pack.session.ChannelMessageSend(pack.channel.ID, "This server doesn't have any rank tiers yet, so members don't earn points. Use `"+
+			tc.ComPrefix+" tier add <points> <name>` to add one.")
+		return
+	}
+	var lines []string
+	for _, t := range tiers {
+		line := "`" + t.Name + "` at " + strconv.Itoa(t.Threshold) + " points"
+		if t.RoleUid.Valid {
+			roleName := "a deleted role"
+			if role := moeDiscord.FindRoleById(pack.guild.Roles, t.RoleUid.String); role != nil {
+				roleName = "`" + role.Name + "`"
+			}
+			if t.AutoGrant {
+				line += ", gives " + roleName
+			} else {
+				line += ", offers " + roleName
+			}
+		}
+		if t.Announcement.Valid {
+			line += ", custom announcement"
+		}
+		lines = append(lines, line)
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, limitMessageLines("This server's rank tiers:", lines))
+}
+
+/*
+Gets every tier that's above fromThreshold but no higher than rank, lowest first
+*/
+func rankTiersReached(tiers []db.RankTier, fromThreshold int, rank int) (reached []db.RankTier) {
+	for _, t := range tiers {
+		if t.Threshold > fromThreshold && t.Threshold <= rank {
+			reached = append(reached, t)
+		}
+	}
+	return
+}
+
+/*
+Works out which tier a member should be recorded at after their points change. Members who dropped below a tier they reached are moved
+down, so they're announced again if they get back to it. Returns any tiers they were pushed up to as well, lowest first
+*/
+func rankTierSync(tiers []db.RankTier, rank int, tierThreshold int) (newThreshold int, reached []db.RankTier) {
+	if reached = rankTiersReached(tiers, tierThreshold, rank); len(reached) > 0 {
+		return reached[len(reached)-1].Threshold, reached
+	}
+	if current, _ := currentRankTier(tiers, rank); current != nil {
+		return current.Threshold, nil
+	}
+	return 0, nil
+}
+
+func rankTierAtThreshold(tiers []db.RankTier, threshold int) *db.RankTier {
+	for i := range tiers {
+		if tiers[i].Threshold == threshold {
+			return &tiers[i]
+		}
+	}
+	return nil
+}
+
+/*
+Builds the message sent when someone reaches a tier
+*/
+func rankTierAnnouncement(tier db.RankTier, user *discordgo.User, guild *discordgo.Guild, comPrefix string) string {
+	if tier.Announcement.Valid {
+		return RenderTemplate(tier.Announcement.String, user, guild)
+	}
+	message := "Congrats " + user.Mention() + " you've reached " + tier.Name + "!"
+	if tier.RoleUid.Valid && !tier.AutoGrant {
+		message += " Type `" + comPrefix + " role " + tier.Name + "` to get the role."
+	}
+	return message
+}
+
+/*
+Finds the tier a member with the given points is at, and the one after it. Either can be nil
+*/
+func currentRankTier(tiers []db.RankTier, rank int) (current *db.RankTier, next *db.RankTier) {
+	for i := range tiers {
+		if rank >= tiers[i].Threshold {
+			current = &tiers[i]
+		} else {
+			return current, &tiers[i]
+		}
+	}
+	return
+}
+
+/*
+Checks if a member is left out of everything rank related, like leaderboards, decay and promotions. Only the master is
+*/
+func rankExcludesUser(userUid string, masterId string) bool {
+	return userUid == masterId
+}
+
+/*
+Checks if a server set up a rank ladder. Points are only handed out in servers that did
+*/
+func serverHasRankLadder(server db.Server) bool {
+	tiers, err := db.RankTierQueryServer(server.Id)
+	return err == nil && len(tiers) > 0
+}
+
+/*
+Names a member in a list of points. Lists are sent in embeds, where a mention shows the member's name without pinging them
+*/
+func rankListName(userUid string) string {
+	return util.UserIdToMention(userUid)
+}
+
+func (tc *TierCommand) GetPermLevel() db.Permission {
+	return db.PermMod
+}
+
+func (tc *TierCommand) GetCommandKeys() []string {
+	return []string{"TIER"}
+}
+
+func (tc *TierCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s tier` - Master/Mod Shows the rank tiers members reach as they earn points. `%[1]s tier add <points> <name>`, "+
+		"`%[1]s tier remove <name>`, `%[1]s tier threshold <name> <points>`, `%[1]s tier role <name> <full role name|-clear>`, "+
+		"`%[1]s tier grant <name> auto|offer` and `%[1]s tier announce <name> <message|-clear>` change them.", commPrefix)
+}
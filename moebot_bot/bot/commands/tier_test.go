@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+func TestTier_RankTiersReached(t *testing.T) {
+	checks := []struct {
+		fromThreshold int
+		rank          int
+		out           []string
+	}{
+		{0, 5, nil},
+		{0, 10, []string{"Newcomer"}},
+		{10, 50, nil},
+		{10, 100, []string{"Regular"}},
+		{0, 600, []string{"Newcomer", "Regular", "Veteran"}},
+		{500, 1000, nil},
+	}
+	for _, c := range checks {
+		var names []string
+		for _, tier := range rankTiersReached(testRankTiers, c.fromThreshold, c.rank) {
+			names = append(names, tier.Name)
+		}
+		if !reflect.DeepEqual(names, c.out) {
+			t.Errorf("Incorrect tiers reached from %d to %d. Got: %v, expected: %v", c.fromThreshold, c.rank, names, c.out)
+		}
+	}
+}
+
+func TestTier_RankTierAnnouncement(t *testing.T) {
+	user := &discordgo.User{ID: "1", Username: "moe"}
+	guild := &discordgo.Guild{Name: "moe server"}
+	role := sql.NullString{String: "2", Valid: true}
+	checks := []struct {
+		tier db.RankTier
+		out  string
+	}{
+		{db.RankTier{Name: "Regular"}, "Congrats <@1> you've reached Regular!"},
+		{db.RankTier{Name: "Regular", RoleUid: role}, "Congrats <@1> you've reached Regular! Type `mb role Regular` to get the role."},
+		{db.RankTier{Name: "Regular", RoleUid: role, AutoGrant: true}, "Congrats <@1> you've reached Regular!"},
+		{db.RankTier{Name: "Regular", Announcement: sql.NullString{String: "{user.name} is a regular of {server}", Valid: true}},
+			"moe is a regular of moe server"},
+	}
+	for _, c := range checks {
+		if res := rankTierAnnouncement(c.tier, user, guild, "mb"); res != c.out {
+			t.Errorf("Incorrect announcement. Got: %s, expected: %s", res, c.out)
+		}
+	}
+}
+
+func TestTier_RankTierSync(t *testing.T) {
+	checks := []struct {
+		rank          int
+		tierThreshold int
+		newThreshold  int
+		reached       []string
+	}{
+		{50, 10, 10, nil},
+		{150, 10, 100, []string{"Regular"}},
+		{600, 0, 500, []string{"Newcomer", "Regular", "Veteran"}},
+		{50, 500, 10, nil},
+		{5, 100, 0, nil},
+		{0, 0, 0, nil},
+		{500, 500, 500, nil},
+	}
+	for _, c := range checks {
+		newThreshold, reached := rankTierSync(testRankTiers, c.rank, c.tierThreshold)
+		var names []string
+		for _, tier := range reached {
+			names = append(names, tier.Name)
+		}
+		if newThreshold != c.newThreshold || !reflect.DeepEqual(names, c.reached) {
+			t.Errorf("Incorrect tier sync for %d points at tier %d. Got: %d and %v, expected: %d and %v", c.rank, c.tierThreshold, newThreshold,
+				names, c.newThreshold, c.reached)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const (
+	captchaLength      = 6
+	captchaExpiry      = 10 * time.Minute
+	captchaMaxAttempts = 3
+	// typed in a DM to get a new captcha image
+	captchaNewKeyword = "NEW"
+)
+
+/*
+Captcha verification for servers using VerifyModeCaptcha. Members get a captcha by DM when they join or ask for one, and type the code back
+in the DM to swap their starter role for the base role
+*/
+type VerifyCommand struct {
+	ComPrefix string
+}
+
+func (vc *VerifyCommand) Execute(pack *CommPackage) {
+	server, err := db.ServerQueryOrInsert(pack.guild.ID)
+	if err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, there was an error loading server information. This is an issue with moebot not discord.")
+		return
+	}
+	if server.VerifyMode != db.VerifyModeCaptcha {
+		pack.session.ChannelMessageSend(pack.channel.ID, "This server doesn't use captcha verification.")
+		return
+	}
+	if !server.StarterRole.Valid || !util.StrContains(pack.member.Roles, server.StarterRole.String, util.CaseSensitive) {
+		pack.session.ChannelMessageSend(pack.channel.ID, "You're already verified in this server!")
+		return
+	}
+	if err = sendCaptcha(pack.session, pack.guild, pack.message.Author); err != nil {
+		pack.session.ChannelMessageSend(pack.channel.ID, "Sorry, I couldn't send you a PM! Please check your settings to allow direct messages from "+
+			"users on this server.")
+		return
+	}
+	pack.session.ChannelMessageSend(pack.channel.ID, pack.message.Author.Mention()+" check your PM's for your captcha!")
+}
+
+func (vc *VerifyCommand) EventHandlers() []interface{} {
+	return []interface{}{vc.memberAdd, vc.directMessage}
+}
+
+func (vc *VerifyCommand) memberAdd(session *discordgo.Session, member *discordgo.GuildMemberAdd) {
+	if member.User.Bot {
+		return
+	}
+	server, err := db.ServerQueryOrInsert(member.GuildID)
+	if err != nil || !server.Enabled || server.VerifyMode != db.VerifyModeCaptcha || !server.StarterRole.Valid {
+		return
+	}
+	guild, err := moeDiscord.GetGuild(member.GuildID, session)
+	if err != nil {
+		return
+	}
+	if err = sendCaptcha(session, guild, member.User); err != nil {
+		Notify(session, server, db.NoticeFailure, "I couldn't send a captcha to "+member.User.Mention()+". They may have DMs turned off, and can use `"+
+			vc.ComPrefix+" verify` once they've turned them on.")
+	}
+}
+
+/*
+Handles codes typed back to moebot in a DM
+*/
+func (vc *VerifyCommand) directMessage(session *discordgo.Session, message *discordgo.MessageCreate) {
+	if message.Author.ID == session.State.User.ID || message.Author.Bot {
+		return
+	}
+	channel, err := moeDiscord.GetChannel(message.ChannelID, session)
+	if err != nil || channel.Type != discordgo.ChannelTypeDM {
+		return
+	}
+	pending, err := db.CaptchaQueryUser(message.Author.ID)
+	if err != nil || len(pending) == 0 {
+		// not someone we're waiting on
+		return
+	}
+	typed := strings.ToUpper(strings.TrimSpace(message.Content))
+	latest := pending[0]
+	latestGuild, err := moeDiscord.GetGuild(latest.GuildUid, session)
+	if err != nil {
+		return
+	}
+
+	if typed == captchaNewKeyword {
+		if err = sendCaptcha(session, latestGuild, message.Author); err != nil {
+			log.Println("Error resending captcha", err)
+		}
+		return
+	}
+
+	now := time.Now()
+	for _, captcha := range pending {
+		if captcha.Code != typed || now.After(captcha.ExpiresAt) {
+			continue
+		}
+		guild, err := moeDiscord.GetGuild(captcha.GuildUid, session)
+		if err != nil {
+			return
+		}
+		server, err := db.ServerQueryOrInsert(guild.ID)
+		if err != nil {
+			session.ChannelMessageSend(channel.ID, "Sorry, there was an error loading server information. This is an issue with moebot not discord.")
+			return
+		}
+		if err = VerifyMember(session, guild, server, message.Author.ID); err != nil {
+			ReportRoleError(session, channel.ID, server, err)
+			return
+		}
+		db.CaptchaDelete(guild.ID, message.Author.ID)
+		session.ChannelMessageSend(channel.ID, "Thanks! You're now verified in "+guild.Name+".")
+		log.Println("Updated user <" + message.Author.Username + "> after solving a captcha")
+		return
+	}
+
+	// wrong or expired code, count it against the most recent captcha
+	if now.After(latest.ExpiresAt) {
+		session.ChannelMessageSend(channel.ID, "That captcha has expired. Type `new` to get a new one.")
+		return
+	}
+	attempts, err := db.CaptchaIncrementAttempts(latest.Id)
+	if err != nil {
+		return
+	}
+	if attempts < captchaMaxAttempts {
+		session.ChannelMessageSend(channel.ID, "Sorry, that's not the right code. You have "+strconv.Itoa(captchaMaxAttempts-attempts)+
+			" tries left, or type `new` for a new image.")
+		return
+	}
+	db.CaptchaDelete(latest.GuildUid, message.Author.ID)
+	session.ChannelMessageSend(channel.ID, "Sorry, that's too many wrong codes. Use `"+vc.ComPrefix+" verify` in "+latestGuild.Name+
+		" to try again.")
+	if server, err := db.ServerQueryOrInsert(latest.GuildUid); err == nil {
+		Notify(session, server, db.NoticeModeration, message.Author.Mention()+" ("+message.Author.Username+") failed the captcha "+
+			strconv.Itoa(captchaMaxAttempts)+" times.")
+	}
+}
+
+/*
+Makes a new captcha for the user in the given guild and DMs it to them
+*/
+func sendCaptcha(session *discordgo.Session, guild *discordgo.Guild, user *discordgo.User) error {
+	code := util.NewCaptchaCode(captchaLength)
+	now := time.Now()
+	if err := db.CaptchaUpsert(guild.ID, user.ID, code, now.Add(captchaExpiry)); err != nil {
+		return err
+	}
+	// anyone who never solved theirs doesn't need to be kept around
+	db.CaptchaDeleteExpired(now.Add(-24 * time.Hour))
+
+	dmChannel, err := session.UserChannelCreate(user.ID)
+	if err != nil {
+		return err
+	}
+	_, err = session.ChannelMessageSendComplex(dmChannel.ID, &discordgo.MessageSend{
+		Content: "To get access to **" + guild.Name + "**, type the code in this image here. It expires in " + captchaExpiry.String() +
+			" and you have " + strconv.Itoa(captchaMaxAttempts) + " tries. Type `new` for a different image.",
+		File: &discordgo.File{
+			Name:        "captcha.gif",
+			ContentType: "image/gif",
+			Reader:      bytes.NewReader(util.MakeCaptcha(code)),
+		},
+	})
+	return err
+}
+
+func (vc *VerifyCommand) GetPermLevel() db.Permission {
+	return db.PermAll
+}
+
+func (vc *VerifyCommand) GetCommandKeys() []string {
+	return []string{"VERIFY"}
+}
+
+func (vc *VerifyCommand) GetCommandHelp(commPrefix string) string {
+	return fmt.Sprintf("`%[1]s verify` - Sends you a new captcha, if this server uses captcha verification.", commPrefix)
+}
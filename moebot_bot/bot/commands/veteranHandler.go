@@ -16,26 +16,75 @@ import (
 )
 
 const (
-	messagePoints        = 5
-	reactionPoints       = 1
-	reactionCooldown     = 45 * time.Second
-	messageCooldown      = 30 * time.Second
 	veteranBufferSizeMax = 30
+	// the buffer is written at least this often, even when it isn't full
+	veteranBufferFlushInterval = time.Minute
 )
 
+/*
+Points waiting to be written to the database, keyed by user and guild
+*/
 type veteranBuffer struct {
-	sync.RWMutex
+	sync.Mutex
 	buffCooldown int
 	m            map[string]int
+	// when the oldest points in the buffer were added
+	oldest time.Time
+}
+
+/*
+Adds points to the buffer, returning true once enough have been added that it should be flushed
+*/
+func (b *veteranBuffer) add(key string, points int, now time.Time) (full bool) {
+	b.Lock()
+	defer b.Unlock()
+	if len(b.m) == 0 {
+		b.oldest = now
+	}
+	b.m[key] += points
+	b.buffCooldown--
+	return b.buffCooldown < 0
+}
+
+/*
+Empties the buffer, returning everything that was in it
+*/
+func (b *veteranBuffer) take() (pending map[string]int, oldest time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	pending, oldest = b.m, b.oldest
+	b.m = make(map[string]int)
+	b.buffCooldown = veteranBufferSizeMax
+	b.oldest = time.Time{}
+	return
+}
+
+/*
+Puts points back in the buffer after they couldn't be written, keeping anything added in the meantime
+*/
+func (b *veteranBuffer) restore(pending map[string]int, oldest time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	if len(b.m) == 0 || oldest.Before(b.oldest) {
+		b.oldest = oldest
+	}
+	for key, points := range pending {
+		b.m[key] += points
+	}
 }
 
 type VeteranHandler struct {
 	reactionCooldownMap util.SyncCooldownMap
 	messageCooldownMap  util.SyncCooldownMap
 	vBuffer             veteranBuffer
-	comPrefix           string
-	debugChannel        string
-	masterId            string
+	// only one flush runs at a time, so the size, timer and shutdown flushes don't race each other
+	flushLock        sync.Mutex
+	dailyPoints      veteranDailyPoints
+	voiceDailyPoints veteranDailyPoints
+	voiceSessions    voiceSessions
+	comPrefix        string
+	debugChannel     string
+	masterId         string
 }
 
 func NewVeteranHandler(comPrefix string, debugChannel string, masterId string) *VeteranHandler {
@@ -50,14 +99,20 @@ func NewVeteranHandler(comPrefix string, debugChannel string, masterId string) *
 		m:            make(map[string]int),
 		buffCooldown: veteranBufferSizeMax,
 	}
+	result.voiceSessions.m = make(map[string]voiceSession)
 	result.comPrefix = comPrefix
 	result.debugChannel = debugChannel
 	result.masterId = masterId
 	return result
 }
 
+func (vh *VeteranHandler) Setup(session *discordgo.Session) {
+	go vh.flushVeteranBufferOnTimer(session)
+	go vh.awardVoicePoints(session)
+}
+
 func (vh *VeteranHandler) EventHandlers() []interface{} {
-	return []interface{}{vh.veteranMessageCreate, vh.veteranReactionAdd}
+	return []interface{}{vh.veteranMessageCreate, vh.veteranReactionAdd, vh.veteranVoiceStateUpdate, vh.veteranGuildCreate}
 }
 
 func (vh *VeteranHandler) veteranMessageCreate(session *discordgo.Session, message *discordgo.MessageCreate) {
@@ -74,36 +129,66 @@ func (vh *VeteranHandler) veteranMessageCreate(session *discordgo.Session, messa
 	if err != nil {
 		return
 	}
-	if !server.VeteranRank.Valid || !server.VeteranRole.Valid {
-		// they didn't set up any veteran config settings, bail out
+	if !serverHasRankLadder(server) {
+		return
+	}
+
+	rules := newVeteranRules(server)
+	if rules.ignoresMessage(message.Content, vh.comPrefix) {
 		return
 	}
+	changedUsers, err := vh.handleVeteranMessage(message.Author.ID, channel, rules)
+	if err != nil {
+		session.ChannelMessageSend(vh.debugChannel, fmt.Sprint("An error occurred when trying to update veteran users ", err))
+	} else {
+		vh.notifyPromotions(session, changedUsers)
+	}
+}
+
+func (vh *VeteranHandler) notifyPromotions(session *discordgo.Session, changedUsers []db.UserServerRankWrapper) {
+	notifyRankPromotions(session, changedUsers, vh.comPrefix, vh.masterId)
+}
 
-	// ignore some common bot prefixes
-	if !(strings.HasPrefix(message.Content, "->") || strings.HasPrefix(message.Content, "~") || strings.HasPrefix(message.Content, vh.comPrefix)) {
-		changedUsers, err := vh.handleVeteranMessage(message.Author.ID, channel.GuildID)
+/*
+Gives out the roles for the tiers members just reached, and announces the highest one
+*/
+func notifyRankPromotions(session *discordgo.Session, changedUsers []db.UserServerRankWrapper, comPrefix string, masterId string) {
+	for _, user := range changedUsers {
+		if rankExcludesUser(user.UserUid, masterId) {
+			continue
+		}
+		server, err := db.ServerQueryOrInsert(user.ServerUid)
+		if err != nil {
+			continue
+		}
+		guild, err := moeDiscord.GetGuild(user.ServerUid, session)
 		if err != nil {
-			session.ChannelMessageSend(vh.debugChannel, fmt.Sprint("An error occurred when trying to update veteran users ", err))
-		} else {
-			for _, user := range changedUsers {
-				// ignore the master from any rank related stuff. Could ignore them earlier, but this is the main "public" facing point
-				if user.UserUid != vh.masterId {
-					session.ChannelMessageSend(user.SendTo, "Congrats "+util.UserIdToMention(user.UserUid)+" you can become a server veteran! Type `"+
-						vh.comPrefix+" role veteran` In this channel.")
-				}
+			continue
+		}
+		discordUser := &discordgo.User{ID: user.UserUid}
+		if member, err := moeDiscord.GetMember(user.UserUid, user.ServerUid, session); err == nil && member != nil {
+			discordUser = member.User
+		}
+		for _, tier := range user.Tiers {
+			if !tier.AutoGrant || !tier.RoleUid.Valid {
+				continue
+			}
+			role := moeDiscord.FindRoleById(guild.Roles, tier.RoleUid.String)
+			if role == nil {
+				continue
+			}
+			if err = AddMemberRole(session, guild, user.UserUid, role); err != nil {
+				ReportRoleError(session, "", server, err)
 			}
 		}
+		// only announce the highest tier, in case they jumped past a few at once
+		Notify(session, server, db.NoticePromotion, rankTierAnnouncement(user.Tiers[len(user.Tiers)-1], discordUser, guild, comPrefix))
 	}
-	// need to clear the server buffer here, since we don't have full clear functionality yet
-	db.FlushServerCache()
 }
 
-func (vh *VeteranHandler) handleVeteranMessage(userUid string, guildUid string) (users []db.UserServerRankWrapper, err error) {
-	key := buildVeteranBufferKey(userUid, guildUid)
-	if isCooldownReached(key, messageCooldown, &vh.messageCooldownMap) {
-		return vh.handleVeteranChange(userUid, guildUid, messagePoints)
-	}
-	return
+func (vh *VeteranHandler) handleVeteranMessage(userUid string, channel *discordgo.Channel, rules veteranRules) (users []db.UserServerRankWrapper, err error) {
+	return vh.handleVeteranActivity(userUid, channel, rules.channelPoints(channel.ID, rules.messagePoints), rules.messageCooldown,
+		&vh.messageCooldownMap, rules)
 }
 
 func (vh *VeteranHandler) veteranReactionAdd(session *discordgo.Session, reactionAdd *discordgo.MessageReactionAdd) {
@@ -118,82 +203,143 @@ func (vh *VeteranHandler) veteranReactionAdd(session *discordgo.Session, reactio
 	if err != nil {
 		return
 	}
-	if !server.VeteranRank.Valid || !server.VeteranRole.Valid {
-		// they didn't set up any veteran config settings, bail out
+	if !serverHasRankLadder(server) {
 		return
 	}
 
-	changedUsers, err := vh.handleVeteranReaction(reactionAdd.UserID, channel.GuildID)
+	changedUsers, err := vh.handleVeteranReaction(reactionAdd.UserID, channel, newVeteranRules(server))
 	if err != nil {
 		session.ChannelMessageSend(vh.debugChannel, fmt.Sprint("An error occurred when trying to update veteran users ", err))
 	} else {
-		for _, user := range changedUsers {
-			if user.UserUid != vh.masterId {
-				session.ChannelMessageSend(user.SendTo, "Congrats "+util.UserIdToMention(user.UserUid)+" you can become a server veteran! Type `"+
-					vh.comPrefix+" role veteran` In this channel.")
-			}
-		}
+		vh.notifyPromotions(session, changedUsers)
 	}
-	db.FlushServerCache()
 }
 
-func (vh *VeteranHandler) handleVeteranReaction(userUid string, guildUid string) (users []db.UserServerRankWrapper, err error) {
-	key := buildVeteranBufferKey(userUid, guildUid)
-	if isCooldownReached(key, reactionCooldown, &vh.reactionCooldownMap) {
-		return vh.handleVeteranChange(userUid, guildUid, reactionPoints)
+func (vh *VeteranHandler) handleVeteranReaction(userUid string, channel *discordgo.Channel, rules veteranRules) (users []db.UserServerRankWrapper, err error) {
+	return vh.handleVeteranActivity(userUid, channel, rules.channelPoints(channel.ID, rules.reactionPoints), rules.reactionCooldown,
+		&vh.reactionCooldownMap, rules)
+}
+
+/*
+Gives a member points for something they did in a channel, as long as they're off cooldown and under the daily cap
+*/
+func (vh *VeteranHandler) handleVeteranActivity(userUid string, channel *discordgo.Channel, points int, cooldown time.Duration,
+	cooldownMap *util.SyncCooldownMap, rules veteranRules) (users []db.UserServerRankWrapper, err error) {
+
+	if points <= 0 {
+		// excluded channel, don't even start the cooldown
+		return
 	}
-	return
+	key := buildVeteranBufferKey(userUid, channel.GuildID)
+	if !isCooldownReached(key, cooldown, cooldownMap) {
+		return
+	}
+	points = vh.dailyPoints.add(key, points, rules.dailyCap)
+	if points == 0 {
+		return
+	}
+	return vh.handleVeteranChange(userUid, channel.GuildID, points)
 }
 
 func (vh *VeteranHandler) handleVeteranChange(userUid string, guildUid string, points int) (users []db.UserServerRankWrapper, err error) {
-	vh.vBuffer.Lock()
-	vh.vBuffer.m[buildVeteranBufferKey(userUid, guildUid)] += points
-	vh.vBuffer.buffCooldown--
-	buffCount := vh.vBuffer.buffCooldown
-	vh.vBuffer.Unlock()
-
 	// only actually go through and process the veterans that have been buffered if we pass our max
-	if buffCount < 0 {
-		var idsToUpdate []int
-		// we've got to read and write this one unfortunately
-		vh.vBuffer.Lock()
-		defer vh.vBuffer.Unlock()
-		for key, count := range vh.vBuffer.m {
-			uid, gid := splitVeteranBufferKey(key)
-			server, err := db.ServerQueryOrInsert(gid)
-			if err != nil {
-				log.Println("Error getting server during veteran change", err)
-				return nil, err
-			}
-			user, err := db.UserQueryOrInsert(uid)
-			if err != nil {
-				log.Println("Error getting user during veteran change", err)
-				return nil, err
-			}
-			id, newPoint, messageSent, err := db.UserServerRankUpdateOrInsert(user.Id, server.Id, count)
-			if err != nil {
-				// we had an error, just don't delete the user and their points
-				continue
-			}
-			if !messageSent && server.VeteranRank.Valid && server.BotChannel.Valid && int64(newPoint) >= server.VeteranRank.Int64 {
-				// we haven't had an error so the user was updated
-				users = append(users, db.UserServerRankWrapper{
-					UserUid:   uid,
-					ServerUid: gid,
-					Rank:      newPoint,
-					SendTo:    server.BotChannel.String,
-				})
-				idsToUpdate = append(idsToUpdate, id)
-			}
+	if vh.vBuffer.add(buildVeteranBufferKey(userUid, guildUid), points, time.Now()) {
+		return vh.flushVeteranBuffer("size")
+	}
+	return nil, nil
+}
+
+func (vh *VeteranHandler) flushVeteranBufferOnTimer(session *discordgo.Session) {
+	for {
+		time.Sleep(veteranBufferFlushInterval)
+		vh.flushAndNotify(session, "timer")
+	}
+}
+
+/*
+Writes out any buffered points before moebot exits, so they aren't lost
+*/
+func (vh *VeteranHandler) Shutdown(session *discordgo.Session) {
+	vh.flushAndNotify(session, "shutdown")
+}
+
+func (vh *VeteranHandler) flushAndNotify(session *discordgo.Session, reason string) {
+	changedUsers, err := vh.flushVeteranBuffer(reason)
+	if err != nil {
+		session.ChannelMessageSend(vh.debugChannel, fmt.Sprint("An error occurred when trying to update veteran users ", err))
+	} else {
+		vh.notifyPromotions(session, changedUsers)
+	}
+}
+
+/*
+Writes every buffered point to the database in one batch, returning anyone who reached a new tier. If the batch can't be written the
+points go back in the buffer to try again next time
+*/
+func (vh *VeteranHandler) flushVeteranBuffer(reason string) (users []db.UserServerRankWrapper, err error) {
+	vh.flushLock.Lock()
+	defer vh.flushLock.Unlock()
+	pending, oldest := vh.vBuffer.take()
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	start := time.Now()
+	var changes []db.UserServerRankChange
+	guildUids := make(map[int]string)
+	userUids := make(map[int]string)
+	for key, count := range pending {
+		uid, gid := splitVeteranBufferKey(key)
+		server, err := db.ServerQueryOrInsert(gid)
+		if err != nil {
+			log.Println("Error getting server during veteran change", err)
+			vh.vBuffer.restore(pending, oldest)
+			return nil, err
+		}
+		user, err := db.UserQueryOrInsert(uid)
+		if err != nil {
+			log.Println("Error getting user during veteran change", err)
+			vh.vBuffer.restore(pending, oldest)
+			return nil, err
+		}
+		guildUids[server.Id] = gid
+		userUids[user.Id] = uid
+		changes = append(changes, db.UserServerRankChange{ServerId: server.Id, UserId: user.Id, Points: count})
+	}
+	ranks, err := db.UserServerRankAddBatch(changes)
+	db.MetricInsertVeteranFlush(db.VeteranFlushStats{
+		Reason:     reason,
+		BatchSize:  len(changes),
+		WaitedMs:   int64(start.Sub(oldest) / time.Millisecond),
+		DurationMs: int64(time.Since(start) / time.Millisecond),
+		Failed:     err != nil,
+	})
+	if err != nil {
+		vh.vBuffer.restore(pending, oldest)
+		return nil, err
+	}
+	for _, rank := range ranks {
+		tiers, err := db.RankTierQueryServer(rank.ServerId)
+		if err != nil {
+			continue
+		}
+		reached := rankTiersReached(tiers, rank.TierThreshold, rank.Rank)
+		if len(reached) == 0 {
+			continue
+		}
+		// the promotion stays pending until it can be announced, rather than being used up with nobody told
+		server, err := db.ServerQueryOrInsert(guildUids[rank.ServerId])
+		if err != nil || !noticeDeliverable(server, db.NoticePromotion) {
+			continue
 		}
-		if len(idsToUpdate) > 0 {
-			db.UserServerRankSetMessageSent(idsToUpdate)
+		if db.UserServerRankSetTier(rank.Id, reached[len(reached)-1].Threshold) == nil {
+			users = append(users, db.UserServerRankWrapper{
+				UserUid:   userUids[rank.UserId],
+				ServerUid: guildUids[rank.ServerId],
+				Rank:      rank.Rank,
+				Tiers:     reached,
+			})
 		}
-		// clear the whole map
-		vh.vBuffer.m = make(map[string]int)
-		vh.vBuffer.buffCooldown = veteranBufferSizeMax
 	}
-	db.FlushServerCache()
 	return users, nil
 }
 
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVeteranHandler_Buffer(t *testing.T) {
+	b := veteranBuffer{m: make(map[string]int), buffCooldown: 2}
+	start := time.Now()
+	if b.add("1:10", 5, start) || b.add("2:10", 1, start.Add(time.Second)) {
+		t.Errorf("Buffer was full too early: %v", b.m)
+	}
+	if !b.add("1:10", 5, start.Add(2*time.Second)) {
+		t.Errorf("Buffer should have been full: %v", b.m)
+	}
+	pending, oldest := b.take()
+	if !reflect.DeepEqual(pending, map[string]int{"1:10": 10, "2:10": 1}) || !oldest.Equal(start) {
+		t.Errorf("Incorrect buffer taken. Got: %v from %v", pending, oldest)
+	}
+	if len(b.m) != 0 || b.buffCooldown != veteranBufferSizeMax || !b.oldest.IsZero() {
+		t.Errorf("Buffer wasn't emptied: %v", b.m)
+	}
+
+	// points added while a failed flush was writing should be kept along with the restored ones
+	b.add("2:10", 3, start.Add(time.Minute))
+	b.restore(pending, oldest)
+	if !reflect.DeepEqual(b.m, map[string]int{"1:10": 10, "2:10": 4}) || !b.oldest.Equal(start) {
+		t.Errorf("Incorrect restored buffer. Got: %v from %v", b.m, b.oldest)
+	}
+}
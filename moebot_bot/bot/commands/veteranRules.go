@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+const (
+	defaultMessagePoints    = 5
+	defaultReactionPoints   = 1
+	defaultVoicePoints      = 1
+	defaultReactionCooldown = 45 * time.Second
+	defaultMessageCooldown  = 30 * time.Second
+	// common bot prefixes, moebot's own prefix is always ignored as well
+	defaultIgnoredPrefixes = "-> ~"
+	maxChannelMultiplier   = 10
+)
+
+/*
+The rules a server uses to hand out veteran points, with the defaults filled in for anything the server hasn't set
+*/
+type veteranRules struct {
+	messagePoints    int
+	reactionPoints   int
+	messageCooldown  time.Duration
+	reactionCooldown time.Duration
+	ignoredPrefixes  []string
+	minLength        int
+	// 0 means there's no cap
+	dailyCap int
+	channels map[string]float64
+	// points for each minute in voice, which have their own cap on top of dailyCap. 0 means there's no cap
+	voicePoints   int
+	voiceDailyCap int
+}
+
+func newVeteranRules(s db.Server) veteranRules {
+	r := veteranRules{
+		messagePoints:    defaultMessagePoints,
+		reactionPoints:   defaultReactionPoints,
+		messageCooldown:  defaultMessageCooldown,
+		reactionCooldown: defaultReactionCooldown,
+		ignoredPrefixes:  strings.Fields(defaultIgnoredPrefixes),
+		voicePoints:      defaultVoicePoints,
+	}
+	if s.VeteranMessagePoints.Valid {
+		r.messagePoints = int(s.VeteranMessagePoints.Int64)
+	}
+	if s.VeteranReactionPoints.Valid {
+		r.reactionPoints = int(s.VeteranReactionPoints.Int64)
+	}
+	if s.VeteranMessageCooldown.Valid {
+		r.messageCooldown = time.Duration(s.VeteranMessageCooldown.Int64) * time.Second
+	}
+	if s.VeteranReactionCooldown.Valid {
+		r.reactionCooldown = time.Duration(s.VeteranReactionCooldown.Int64) * time.Second
+	}
+	if s.VeteranIgnoredPrefixes.Valid {
+		r.ignoredPrefixes = strings.Fields(s.VeteranIgnoredPrefixes.String)
+	}
+	if s.VeteranMinLength.Valid {
+		r.minLength = int(s.VeteranMinLength.Int64)
+	}
+	if s.VeteranDailyCap.Valid {
+		r.dailyCap = int(s.VeteranDailyCap.Int64)
+	}
+	if s.VeteranVoicePoints.Valid {
+		r.voicePoints = int(s.VeteranVoicePoints.Int64)
+	}
+	if s.VeteranVoiceDailyCap.Valid {
+		r.voiceDailyCap = int(s.VeteranVoiceDailyCap.Int64)
+	}
+	// the channels were validated when they were set, so a bad entry here means someone edited the database by hand
+	r.channels, _ = parseVeteranChannels(s.VeteranChannels.String)
+	return r
+}
+
+/*
+Checks if a message is too short or looks like a command for moebot or another bot
+*/
+func (r veteranRules) ignoresMessage(content string, comPrefix string) bool {
+	if strings.HasPrefix(content, comPrefix) {
+		return true
+	}
+	for _, prefix := range r.ignoredPrefixes {
+		if strings.HasPrefix(content, prefix) {
+			return true
+		}
+	}
+	return len([]rune(strings.TrimSpace(content))) < r.minLength
+}
+
+/*
+Applies a channel's multiplier to some points. Returns 0 for excluded channels
+*/
+func (r veteranRules) channelPoints(channelUid string, points int) int {
+	multiplier, ok := r.channels[channelUid]
+	if !ok {
+		return points
+	}
+	return int(math.Round(float64(points) * multiplier))
+}
+
+/*
+Parses channelId:multiplier pairs separated by spaces
+*/
+func parseVeteranChannels(channels string) (map[string]float64, error) {
+	result := make(map[string]float64)
+	for _, entry := range strings.Fields(channels) {
+		split := strings.Split(entry, ":")
+		if len(split) != 2 {
+			return nil, errors.New("channels should look like <channel ID>:<multiplier>")
+		}
+		if _, err := strconv.ParseUint(split[0], 10, 64); err != nil {
+			return nil, errors.New(split[0] + " isn't a channel ID")
+		}
+		multiplier, err := strconv.ParseFloat(split[1], 64)
+		if err != nil || multiplier < 0 || multiplier > maxChannelMultiplier {
+			return nil, errors.New("multipliers should be a number from 0 to " + strconv.Itoa(maxChannelMultiplier))
+		}
+		result[split[0]] = multiplier
+	}
+	return result, nil
+}
+
+/*
+Formats channel multipliers the way parseVeteranChannels reads them, sorted by channel ID so the same settings always look the same
+*/
+func formatVeteranChannels(channels map[string]float64) string {
+	var entries []string
+	for channelUid, multiplier := range channels {
+		entries = append(entries, channelUid+":"+strconv.FormatFloat(multiplier, 'f', -1, 64))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, " ")
+}
+
+/*
+Counts how many points each member has earned today in each server, so the daily cap can be enforced. Only kept in memory, so a restart
+resets everyone's count for the day
+*/
+type veteranDailyPoints struct {
+	sync.Mutex
+	day string
+	m   map[string]int
+}
+
+/*
+Records points towards a member's daily total, returning how many of them they can actually have under the cap
+*/
+func (d *veteranDailyPoints) add(key string, points int, dailyCap int) int {
+	d.Lock()
+	defer d.Unlock()
+	today := time.Now().UTC().Format("2006-01-02")
+	if d.day != today || d.m == nil {
+		d.day = today
+		d.m = make(map[string]int)
+	}
+	allowed := capDailyPoints(d.m[key], points, dailyCap)
+	d.m[key] += allowed
+	return allowed
+}
+
+func capDailyPoints(earned int, points int, dailyCap int) int {
+	if dailyCap <= 0 {
+		return points
+	}
+	if earned+points > dailyCap {
+		points = dailyCap - earned
+	}
+	if points < 0 {
+		return 0
+	}
+	return points
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/camd67/moebot/moebot_bot/util/db"
+)
+
+func TestVeteranRules_Defaults(t *testing.T) {
+	r := newVeteranRules(db.Server{})
+	if r.messagePoints != defaultMessagePoints || r.reactionPoints != defaultReactionPoints || r.messageCooldown != defaultMessageCooldown ||
+		r.reactionCooldown != defaultReactionCooldown || r.minLength != 0 || r.dailyCap != 0 || len(r.ignoredPrefixes) != 2 ||
+		r.voicePoints != defaultVoicePoints || r.voiceDailyCap != 0 {
+		t.Errorf("Incorrect default rules: %+v", r)
+	}
+	r = newVeteranRules(db.Server{
+		VeteranMessagePoints:   sql.NullInt64{Int64: 2, Valid: true},
+		VeteranMessageCooldown: sql.NullInt64{Int64: 10, Valid: true},
+		VeteranIgnoredPrefixes: sql.NullString{String: "!", Valid: true},
+	})
+	if r.messagePoints != 2 || r.messageCooldown != 10*time.Second || r.reactionPoints != defaultReactionPoints || len(r.ignoredPrefixes) != 1 {
+		t.Errorf("Incorrect configured rules: %+v", r)
+	}
+}
+
+func TestVeteranRules_IgnoresMessage(t *testing.T) {
+	r := veteranRules{ignoredPrefixes: []string{"->", "~"}, minLength: 5}
+	checks := []struct {
+		content string
+		out     bool
+	}{
+		{"hello there", false},
+		{"mb help", true},
+		{"->play song", true},
+		{"~roll", true},
+		{"ok", true},
+		{"  ok   ", true},
+		{"héllo", false},
+	}
+	for _, c := range checks {
+		if res := r.ignoresMessage(c.content, "mb"); res != c.out {
+			t.Errorf("Incorrect ignore for %q. Got: %v, expected: %v", c.content, res, c.out)
+		}
+	}
+}
+
+func TestVeteranRules_ChannelPoints(t *testing.T) {
+	r := veteranRules{channels: map[string]float64{"1": 0, "2": 1.5, "3": 0.1}}
+	checks := []struct {
+		channel string
+		points  int
+		out     int
+	}{
+		{"1", 5, 0},
+		{"2", 5, 8},
+		{"3", 1, 0},
+		{"4", 5, 5},
+	}
+	for _, c := range checks {
+		if res := r.channelPoints(c.channel, c.points); res != c.out {
+			t.Errorf("Incorrect points for channel %s. Got: %d, expected: %d", c.channel, res, c.out)
+		}
+	}
+}
+
+func TestVeteranRules_ParseVeteranChannels(t *testing.T) {
+	checks := []struct {
+		in    string
+		valid bool
+		out   string
+	}{
+		{"", true, ""},
+		{"2:1.5 1:0", true, "1:0 2:1.5"},
+		{"1:2 1:3", true, "1:3"},
+		{"1", false, ""},
+		{"abc:1", false, ""},
+		{"1:-1", false, ""},
+		{"1:11", false, ""},
+	}
+	for _, c := range checks {
+		res, err := parseVeteranChannels(c.in)
+		if (err == nil) != c.valid {
+			t.Errorf("Incorrect validity for %q. Got error: %v", c.in, err)
+		} else if c.valid && formatVeteranChannels(res) != c.out {
+			t.Errorf("Incorrect channels for %q. Got: %q, expected: %q", c.in, formatVeteranChannels(res), c.out)
+		}
+	}
+}
+
+func TestVeteranRules_CapDailyPoints(t *testing.T) {
+	checks := []struct {
+		earned   int
+		points   int
+		dailyCap int
+		out      int
+	}{
+		{0, 5, 0, 5},
+		{100, 5, 0, 5},
+		{0, 5, 10, 5},
+		{8, 5, 10, 2},
+		{10, 5, 10, 0},
+		{12, 5, 10, 0},
+	}
+	for _, c := range checks {
+		if res := capDailyPoints(c.earned, c.points, c.dailyCap); res != c.out {
+			t.Errorf("Incorrect capped points for earned: %d, points: %d, cap: %d. Got: %d, expected: %d", c.earned, c.points, c.dailyCap, res, c.out)
+		}
+	}
+}
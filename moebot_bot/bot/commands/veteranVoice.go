@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/camd67/moebot/moebot_bot/util/db"
+	"github.com/camd67/moebot/moebot_bot/util/moeDiscord"
+)
+
+const veteranVoiceInterval = time.Minute
+
+/*
+Where a member is in voice, and when they were last given points for it
+*/
+type voiceSession struct {
+	channelUid string
+	lastAward  time.Time
+}
+
+/*
+Every member currently in voice, keyed the same way as the veteran buffer
+*/
+type voiceSessions struct {
+	sync.Mutex
+	m map[string]voiceSession
+}
+
+func (vh *VeteranHandler) veteranVoiceStateUpdate(session *discordgo.Session, update *discordgo.VoiceStateUpdate) {
+	if voiceMemberIsBot(session, update.GuildID, update.UserID) {
+		return
+	}
+	vh.trackVoiceState(update.VoiceState, time.Now())
+}
+
+/*
+Picks up anyone who was already in voice when moebot connected
+*/
+func (vh *VeteranHandler) veteranGuildCreate(session *discordgo.Session, guild *discordgo.GuildCreate) {
+	now := time.Now()
+	// a reconnect sends the guild again, and anyone who left while moebot was gone won't be in it
+	vh.voiceSessions.Lock()
+	for key := range vh.voiceSessions.m {
+		if _, guildUid := splitVeteranBufferKey(key); guildUid == guild.ID {
+			delete(vh.voiceSessions.m, key)
+		}
+	}
+	vh.voiceSessions.Unlock()
+	for _, state := range guild.VoiceStates {
+		if voiceMemberIsBot(session, guild.ID, state.UserID) {
+			continue
+		}
+		// voice states sent with a guild don't always have the guild filled in
+		vh.trackVoiceState(&discordgo.VoiceState{UserID: state.UserID, GuildID: guild.ID, ChannelID: state.ChannelID}, now)
+	}
+}
+
+func (vh *VeteranHandler) trackVoiceState(state *discordgo.VoiceState, now time.Time) {
+	key := buildVeteranBufferKey(state.UserID, state.GuildID)
+	vh.voiceSessions.Lock()
+	defer vh.voiceSessions.Unlock()
+	if state.ChannelID == "" {
+		delete(vh.voiceSessions.m, key)
+		return
+	}
+	// muting or deafening also sends an update, which shouldn't restart the minute they're partway through
+	if current, ok := vh.voiceSessions.m[key]; !ok || current.channelUid != state.ChannelID {
+		vh.voiceSessions.m[key] = voiceSession{channelUid: state.ChannelID, lastAward: now}
+	}
+}
+
+func (vh *VeteranHandler) awardVoicePoints(session *discordgo.Session) {
+	for {
+		time.Sleep(veteranVoiceInterval)
+		now := time.Now()
+		vh.voiceSessions.Lock()
+		due := make(map[string]voiceSession)
+		for key, vs := range vh.voiceSessions.m {
+			if now.Sub(vs.lastAward) >= veteranVoiceInterval {
+				due[key] = vs
+				vs.lastAward = now
+				vh.voiceSessions.m[key] = vs
+			}
+		}
+		vh.voiceSessions.Unlock()
+		for key, vs := range due {
+			userUid, guildUid := splitVeteranBufferKey(key)
+			changedUsers, err := vh.handleVeteranVoice(session, userUid, guildUid, vs.channelUid)
+			if err != nil {
+				session.ChannelMessageSend(vh.debugChannel, fmt.Sprint("An error occurred when trying to update veteran users ", err))
+			} else {
+				vh.notifyPromotions(session, changedUsers)
+			}
+		}
+	}
+}
+
+/*
+Gives a member a minute's worth of voice points, as long as they're somewhere that counts and they're under the caps
+*/
+func (vh *VeteranHandler) handleVeteranVoice(session *discordgo.Session, userUid string, guildUid string, channelUid string) (users []db.UserServerRankWrapper,
+	err error) {
+
+	server, err := db.ServerQueryOrInsert(guildUid)
+	if err != nil {
+		return nil, nil
+	}
+	if !serverHasRankLadder(server) {
+		return nil, nil
+	}
+	guild, err := moeDiscord.GetGuild(guildUid, session)
+	if err != nil {
+		return nil, nil
+	}
+	// the member earning points has to be human too, not just whoever they're with
+	if member, err := moeDiscord.GetMember(userUid, guildUid, session); err != nil || member == nil || member.User == nil || member.User.Bot {
+		return nil, nil
+	}
+	// copied so the state isn't locked while members are looked up, which locks it again
+	session.State.RLock()
+	voiceStates := append([]*discordgo.VoiceState(nil), guild.VoiceStates...)
+	session.State.RUnlock()
+	key := buildVeteranBufferKey(userUid, guildUid)
+	if !voiceMemberInChannel(voiceStates, userUid, channelUid) {
+		// the update saying they left was missed, so stop tracking them until they show up again
+		vh.voiceSessions.Lock()
+		if current, ok := vh.voiceSessions.m[key]; ok && current.channelUid == channelUid {
+			delete(vh.voiceSessions.m, key)
+		}
+		vh.voiceSessions.Unlock()
+		return nil, nil
+	}
+	eligible := voiceChannelEligible(voiceStates, userUid, channelUid, guild.AfkChannelID, func(uid string) bool {
+		return voiceMemberIsBot(session, guildUid, uid)
+	})
+	if !eligible {
+		return nil, nil
+	}
+	rules := newVeteranRules(server)
+	points := rules.channelPoints(channelUid, rules.voicePoints)
+	if points <= 0 {
+		return nil, nil
+	}
+	if points = vh.voiceDailyPoints.add(key, points, rules.voiceDailyCap); points == 0 {
+		return nil, nil
+	}
+	if points = vh.dailyPoints.add(key, points, rules.dailyCap); points == 0 {
+		return nil, nil
+	}
+	return vh.handleVeteranChange(userUid, guildUid, points)
+}
+
+/*
+Checks if someone in voice is a bot. Members that aren't in the state are taken to be human
+*/
+func voiceMemberIsBot(session *discordgo.Session, guildUid string, userUid string) bool {
+	member, err := session.State.Member(guildUid, userUid)
+	return err == nil && member.User != nil && member.User.Bot
+}
+
+/*
+Checks if a member is still in the given voice channel
+*/
+func voiceMemberInChannel(voiceStates []*discordgo.VoiceState, userUid string, channelUid string) bool {
+	for _, state := range voiceStates {
+		if state.UserID == userUid && state.ChannelID == channelUid {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Checks if a member's voice channel earns points. They have to still be in it, it can't be the AFK channel, and at least one other human
+has to be there with them
+*/
+func voiceChannelEligible(voiceStates []*discordgo.VoiceState, userUid string, channelUid string, afkChannelUid string, isBot func(string) bool) bool {
+	if channelUid == "" || channelUid == afkChannelUid || !voiceMemberInChannel(voiceStates, userUid, channelUid) {
+		return false
+	}
+	for _, state := range voiceStates {
+		if state.ChannelID == channelUid && state.UserID != userUid && !isBot(state.UserID) {
+			return true
+		}
+	}
+	return false
+}
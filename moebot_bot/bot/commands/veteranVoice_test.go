@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestVeteranVoice_VoiceChannelEligible(t *testing.T) {
+	isBot := func(uid string) bool {
+		return uid == "bot"
+	}
+	checks := []struct {
+		states  []*discordgo.VoiceState
+		channel string
+		out     bool
+	}{
+		{[]*discordgo.VoiceState{{UserID: "1", ChannelID: "10"}, {UserID: "2", ChannelID: "10"}}, "10", true},
+		{[]*discordgo.VoiceState{{UserID: "1", ChannelID: "10"}}, "10", false},
+		{[]*discordgo.VoiceState{{UserID: "1", ChannelID: "10"}, {UserID: "2", ChannelID: "11"}}, "10", false},
+		{[]*discordgo.VoiceState{{UserID: "1", ChannelID: "10"}, {UserID: "bot", ChannelID: "10"}}, "10", false},
+		{[]*discordgo.VoiceState{{UserID: "1", ChannelID: "afk"}, {UserID: "2", ChannelID: "afk"}}, "afk", false},
+		{[]*discordgo.VoiceState{{UserID: "2", ChannelID: "10"}, {UserID: "3", ChannelID: "10"}}, "10", false},
+		{[]*discordgo.VoiceState{{UserID: "1", ChannelID: "11"}, {UserID: "2", ChannelID: "10"}}, "10", false},
+		{nil, "", false},
+	}
+	for _, c := range checks {
+		if res := voiceChannelEligible(c.states, "1", c.channel, "afk", isBot); res != c.out {
+			t.Errorf("Incorrect eligibility for channel %s. Got: %v, expected: %v", c.channel, res, c.out)
+		}
+	}
+}
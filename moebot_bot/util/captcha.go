@@ -0,0 +1,96 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"image"
+	"image/color"
+	"image/gif"
+	"math/big"
+	mrand "math/rand"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// characters that are hard to mix up with each other, even when distorted
+	captchaAlphabet   = "ACDEFHJKLMNPRTUVWXY34679"
+	captchaCharWidth  = 34
+	captchaHeight     = 70
+	captchaNoiseDots  = 250
+	captchaNoiseLines = 5
+)
+
+/*
+Makes a random captcha code of the given length
+*/
+func NewCaptchaCode(length int) string {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(captchaAlphabet))))
+		if err != nil {
+			// crypto/rand shouldn't ever fail, but a weaker code is better than no code
+			n = big.NewInt(mrand.Int63n(int64(len(captchaAlphabet))))
+		}
+		code[i] = captchaAlphabet[n.Int64()]
+	}
+	return string(code)
+}
+
+/*
+Renders a captcha code to a gif, with each character jittered and noise drawn over the top so it's not trivial to read automatically
+*/
+func MakeCaptcha(code string) []byte {
+	rng := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+	fnt, _ := truetype.Parse(gomono.TTF)
+	size := image.Rect(0, 0, len(code)*captchaCharWidth+xBorder, captchaHeight)
+	img, d := uniformColorImage(size, color.RGBA{0xff, 0xff, 0xff, 0xff}, color.RGBA{0x00, 0x00, 0x00, 0xff}, fixed.Point26_6{}, nil)
+	for i, c := range code {
+		// every character gets its own size and position so they don't line up
+		d.Face = truetype.NewFace(fnt, &truetype.Options{
+			Size: float64(26 + rng.Intn(12)),
+		})
+		d.Src = image.NewUniform(color.RGBA{0x00, 0x00, 0x00, 0xff})
+		if rng.Intn(2) == 0 {
+			d.Src = image.NewUniform(color.RGBA{0x33, 0x33, 0x33, 0xff})
+		}
+		d.Dot.X = fixed.I(xBorder/2 + i*captchaCharWidth + rng.Intn(8) - 4)
+		d.Dot.Y = fixed.I(captchaHeight/2 + 12 + rng.Intn(16) - 8)
+		d.DrawString(string(c))
+	}
+	noiseColors := []color.RGBA{{0x66, 0x66, 0x66, 0xff}, {0x99, 0x99, 0x99, 0xff}, {0x00, 0x00, 0x00, 0xff}}
+	for i := 0; i < captchaNoiseDots; i++ {
+		img.Set(rng.Intn(size.Dx()), rng.Intn(size.Dy()), noiseColors[rng.Intn(len(noiseColors))])
+	}
+	for i := 0; i < captchaNoiseLines; i++ {
+		drawLine(img, rng.Intn(size.Dx()), rng.Intn(size.Dy()), rng.Intn(size.Dx()), rng.Intn(size.Dy()), noiseColors[rng.Intn(len(noiseColors))])
+	}
+
+	buf := new(bytes.Buffer)
+	gif.Encode(buf, img, nil)
+	return buf.Bytes()
+}
+
+func drawLine(img *image.Paletted, x0 int, y0 int, x1 int, y1 int, c color.Color) {
+	steps := abs(x1 - x0)
+	if abs(y1-y0) > steps {
+		steps = abs(y1 - y0)
+	}
+	if steps == 0 {
+		img.Set(x0, y0, c)
+		return
+	}
+	for i := 0; i <= steps; i++ {
+		img.Set(x0+(x1-x0)*i/steps, y0+(y1-y0)*i/steps, c)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
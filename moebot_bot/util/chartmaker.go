@@ -0,0 +1,152 @@
+package util
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	chartWidth        = 640
+	chartHeight       = 320
+	chartLeftBorder   = 60
+	chartRightBorder  = 90
+	chartTopBorder    = 30
+	chartBottomBorder = 30
+	chartFontSize     = 12
+	chartDashLength   = 6
+)
+
+var (
+	chartBackground = color.RGBA{0x2f, 0x31, 0x36, 0xff}
+	chartAxis       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	chartText       = color.RGBA{0xdc, 0xdd, 0xde, 0xff}
+	chartLine       = color.RGBA{0x72, 0x89, 0xda, 0xff}
+	chartThreshold  = color.RGBA{0xfa, 0xa6, 0x1a, 0xff}
+)
+
+/*
+A value at a point in time on a chart
+*/
+type ChartPoint struct {
+	Time  time.Time
+	Value int
+}
+
+/*
+A named horizontal line drawn across a chart
+*/
+type ChartThreshold struct {
+	Name  string
+	Value int
+}
+
+/*
+Draws a line chart of the given points from start to end as a PNG, with each threshold drawn as a dashed line. Points should be in order
+*/
+func MakeLineChart(title string, points []ChartPoint, thresholds []ChartThreshold, start time.Time, end time.Time) ([]byte, error) {
+	fnt, _ := truetype.Parse(gomono.TTF)
+	fontFace := truetype.NewFace(fnt, &truetype.Options{
+		Size: chartFontSize,
+	})
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	for x := 0; x < chartWidth; x++ {
+		for y := 0; y < chartHeight; y++ {
+			img.Set(x, y, chartBackground)
+		}
+	}
+
+	maxValue := 0
+	for _, p := range points {
+		if p.Value > maxValue {
+			maxValue = p.Value
+		}
+	}
+	for _, t := range thresholds {
+		if t.Value > maxValue {
+			maxValue = t.Value
+		}
+	}
+	// leave some room above the highest line so it doesn't sit on the border
+	maxValue += maxValue/10 + 1
+
+	plotLeft, plotRight := chartLeftBorder, chartWidth-chartRightBorder
+	plotTop, plotBottom := chartTopBorder, chartHeight-chartBottomBorder
+	toX := func(t time.Time) int {
+		if !end.After(start) {
+			return plotRight
+		}
+		return plotLeft + int(float64(plotRight-plotLeft)*float64(t.Sub(start))/float64(end.Sub(start)))
+	}
+	toY := func(value int) int {
+		return plotBottom - int(float64(plotBottom-plotTop)*float64(value)/float64(maxValue))
+	}
+
+	drawChartLine(img, plotLeft, plotBottom, plotRight, plotBottom, chartAxis, 1, false)
+	drawChartLine(img, plotLeft, plotTop, plotLeft, plotBottom, chartAxis, 1, false)
+	for _, t := range thresholds {
+		y := toY(t.Value)
+		drawChartLine(img, plotLeft, y, plotRight, y, chartThreshold, 1, true)
+		drawChartText(img, fontFace, t.Name, plotRight+6, y+chartFontSize/3, chartThreshold)
+	}
+	for i := 1; i < len(points); i++ {
+		drawChartLine(img, toX(points[i-1].Time), toY(points[i-1].Value), toX(points[i].Time), toY(points[i].Value), chartLine, 2, false)
+	}
+
+	drawChartText(img, fontFace, title, plotLeft, chartTopBorder-10, chartText)
+	drawChartText(img, fontFace, "0", plotLeft-6-font.MeasureString(fontFace, "0").Ceil(), plotBottom+chartFontSize/3, chartText)
+	maxLabel := strconv.Itoa(maxValue)
+	drawChartText(img, fontFace, maxLabel, plotLeft-6-font.MeasureString(fontFace, maxLabel).Ceil(), plotTop+chartFontSize/3, chartText)
+	drawChartText(img, fontFace, start.Format("Jan 2"), plotLeft, plotBottom+chartFontSize+6, chartText)
+	endLabel := end.Format("Jan 2")
+	drawChartText(img, fontFace, endLabel, plotRight-font.MeasureString(fontFace, endLabel).Ceil(), plotBottom+chartFontSize+6, chartText)
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+Draws a straight line between two points, stepping along whichever direction is longer so there aren't any gaps
+*/
+func drawChartLine(img *image.RGBA, x0 int, y0 int, x1 int, y1 int, c color.RGBA, thickness int, dashed bool) {
+	dx, dy := x1-x0, y1-y0
+	steps := abs(dx)
+	if abs(dy) > steps {
+		steps = abs(dy)
+	}
+	for i := 0; i <= steps; i++ {
+		if dashed && (i/chartDashLength)%2 == 1 {
+			continue
+		}
+		x, y := x0, y0
+		if steps > 0 {
+			x = x0 + dx*i/steps
+			y = y0 + dy*i/steps
+		}
+		for t := 0; t < thickness; t++ {
+			img.Set(x, y+t, c)
+			img.Set(x+t, y, c)
+		}
+	}
+}
+
+func drawChartText(img *image.RGBA, fontFace font.Face, text string, x int, y int, c color.RGBA) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: fontFace,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
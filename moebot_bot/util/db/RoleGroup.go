@@ -158,6 +158,39 @@ func RoleGroupDelete(id int) error {
 	return err
 }
 
+/*
+Inserts the given group, or updates the type of the existing group with the same name, as part of a larger transaction
+*/
+func RoleGroupInsertOrUpdateTx(tx *sql.Tx, rg RoleGroup, s Server) (id int, err error) {
+	err = tx.QueryRow(roleGroupQueryByName, rg.Name, s.Id).Scan(&id, new(int), new(string), new(GroupType))
+	if err == sql.ErrNoRows {
+		if rg.Type <= 0 {
+			rg.Type = GroupTypeAny
+		}
+		err = tx.QueryRow(roleGroupInsert, s.Id, rg.Name, rg.Type).Scan(&id)
+		if err != nil {
+			log.Println("Error inserting roleGroup in transaction", err)
+		}
+		return
+	} else if err != nil {
+		log.Println("Error scanning roleGroup row in transaction", err)
+		return -1, err
+	}
+	_, err = tx.Exec(roleGroupUpdate, id, rg.Name, rg.Type)
+	if err != nil {
+		log.Println("Error updating roleGroup in transaction: Id - " + strconv.Itoa(id))
+	}
+	return
+}
+
+func RoleGroupDeleteTx(tx *sql.Tx, id int) error {
+	_, err := tx.Exec(roleGroupDeleteId, id)
+	if err != nil {
+		log.Println("Error deleting role group in transaction: ", id)
+	}
+	return err
+}
+
 func roleGroupCreateTable() {
 	_, err := moeDb.Exec(roleGroupTable)
 	if err != nil {
@@ -186,6 +219,22 @@ func GetGroupTypeFromString(s string) GroupType {
 	}
 }
 
+/*
+Gets the short string for a group type. This is the same string accepted by GetGroupTypeFromString
+*/
+func GetShortStringFromGroupType(groupType GroupType) string {
+	switch groupType {
+	case GroupTypeAny:
+		return "ANY"
+	case GroupTypeExclusive:
+		return "EXC"
+	case GroupTypeExclusiveNoRemove:
+		return "ENR"
+	default:
+		return "Unknown"
+	}
+}
+
 func GetStringFromGroupType(groupType GroupType) string {
 	switch groupType {
 	case GroupTypeAny:
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Master managed lists of users and guilds that get special treatment from moebot, no matter which server they're in
+*/
+type AccessListType int
+
+const (
+	// Guilds moebot may stay in while the allowlist is on
+	AccessListAllowGuild AccessListType = 0
+	// Guilds moebot always leaves
+	AccessListBlockGuild AccessListType = 1
+	// Users moebot ignores everywhere
+	AccessListBlockUser AccessListType = 2
+	// Guilds that can use the raffle and submit commands
+	AccessListRaffleGuild AccessListType = 3
+
+	OptionsForAccessListType = "allowguild, blockguild, blockuser, raffleguild"
+)
+
+type AccessListEntry struct {
+	Id        int
+	Type      AccessListType
+	Uid       string
+	Reason    sql.NullString
+	ActorUid  string
+	CreatedAt time.Time
+}
+
+const (
+	accessListTable = `CREATE TABLE IF NOT EXISTS access_list(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		Type SMALLINT NOT NULL,
+		Uid VARCHAR(20) NOT NULL,
+		Reason VARCHAR(200),
+		ActorUid VARCHAR(20) NOT NULL,
+		CreatedAt TIMESTAMP NOT NULL DEFAULT now(),
+		UNIQUE (Type, Uid)
+	)`
+
+	AccessListMaxReasonLength       = 200
+	AccessListMaxReasonLengthString = "200"
+
+	accessListUpsert = `INSERT INTO access_list(Type, Uid, Reason, ActorUid) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (Type, Uid) DO UPDATE SET Reason = excluded.Reason, ActorUid = excluded.ActorUid, CreatedAt = now()`
+	accessListDelete    = `DELETE FROM access_list WHERE Type = $1 AND Uid = $2`
+	accessListQueryType = `SELECT Id, Type, Uid, Reason, ActorUid, CreatedAt FROM access_list WHERE Type = $1 ORDER BY CreatedAt`
+	accessListQueryAll  = `SELECT Type, Uid FROM access_list`
+
+	// Salt's server was the only one allowed to raffle before it was a list. Entries seeded by moebot itself have no actor
+	accessListSeedRaffleGuild = `INSERT INTO access_list(Type, Uid, Reason, ActorUid) SELECT $1::SMALLINT, '93799773856862208', 'Salt', ''
+		WHERE NOT EXISTS (SELECT 1 FROM bot_setting WHERE Key = $2) ON CONFLICT DO NOTHING`
+)
+
+// Every list is checked on every message, so they're kept in memory and updated on every write
+var accessListCache = struct {
+	sync.RWMutex
+	loaded        bool
+	lists         map[AccessListType]map[string]bool
+	allowlistMode bool
+}{}
+
+/*
+Adds a user or guild to a list, or updates the reason if they're already on it
+*/
+func AccessListInsert(listType AccessListType, uid string, reason string, actorUid string) error {
+	var dbReason sql.NullString
+	if reason != "" {
+		dbReason.Scan(reason)
+	}
+	_, err := moeDb.Exec(accessListUpsert, listType, uid, dbReason, actorUid)
+	if err != nil {
+		log.Println("Error inserting access list entry", err)
+		return err
+	}
+	accessListCache.Lock()
+	defer accessListCache.Unlock()
+	if accessListCache.loaded {
+		if accessListCache.lists[listType] == nil {
+			accessListCache.lists[listType] = make(map[string]bool)
+		}
+		accessListCache.lists[listType][uid] = true
+	}
+	return nil
+}
+
+/*
+Removes a user or guild from a list. Returns false if they weren't on it
+*/
+func AccessListDelete(listType AccessListType, uid string) (removed bool, err error) {
+	result, err := moeDb.Exec(accessListDelete, listType, uid)
+	if err != nil {
+		log.Println("Error deleting access list entry", err)
+		return
+	}
+	rowCount, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting deleted access list entry count", err)
+		return
+	}
+	accessListCache.Lock()
+	defer accessListCache.Unlock()
+	if accessListCache.loaded {
+		delete(accessListCache.lists[listType], uid)
+	}
+	return rowCount > 0, nil
+}
+
+func AccessListQueryType(listType AccessListType) (entries []AccessListEntry, err error) {
+	rows, err := moeDb.Query(accessListQueryType, listType)
+	if err != nil {
+		log.Println("Error querying access list", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e AccessListEntry
+		if err = rows.Scan(&e.Id, &e.Type, &e.Uid, &e.Reason, &e.ActorUid, &e.CreatedAt); err != nil {
+			log.Println("Error scanning access list entry", err)
+			return
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+/*
+Checks if a user or guild is on a list. Errors loading the lists are logged, and treated as not being on the list
+*/
+func AccessListContains(listType AccessListType, uid string) bool {
+	if !accessListLoad() {
+		return false
+	}
+	accessListCache.RLock()
+	defer accessListCache.RUnlock()
+	return accessListCache.lists[listType][uid]
+}
+
+/*
+Checks if moebot should pay any attention to a guild, based on the blocklist and allowlist
+*/
+func AccessGuildAllowed(guildUid string) bool {
+	if !accessListLoad() {
+		// better to keep working than to ignore everyone because the database hiccuped
+		return true
+	}
+	accessListCache.RLock()
+	defer accessListCache.RUnlock()
+	if accessListCache.lists[AccessListBlockGuild][guildUid] {
+		return false
+	}
+	return !accessListCache.allowlistMode || accessListCache.lists[AccessListAllowGuild][guildUid]
+}
+
+func AccessAllowlistMode() bool {
+	if !accessListLoad() {
+		return false
+	}
+	accessListCache.RLock()
+	defer accessListCache.RUnlock()
+	return accessListCache.allowlistMode
+}
+
+/*
+Turns the guild allowlist on or off. While it's on moebot only stays in guilds on the allowguild list
+*/
+func AccessSetAllowlistMode(on bool) error {
+	if err := BotSettingSet(BotSettingAllowlistMode, strconv.FormatBool(on)); err != nil {
+		return err
+	}
+	accessListCache.Lock()
+	defer accessListCache.Unlock()
+	accessListCache.allowlistMode = on
+	return nil
+}
+
+func accessListLoad() bool {
+	accessListCache.RLock()
+	loaded := accessListCache.loaded
+	accessListCache.RUnlock()
+	if loaded {
+		return true
+	}
+	accessListCache.Lock()
+	defer accessListCache.Unlock()
+	if accessListCache.loaded {
+		return true
+	}
+	mode, err := BotSettingQuery(BotSettingAllowlistMode)
+	if err != nil && err != sql.ErrNoRows {
+		return false
+	}
+	rows, err := moeDb.Query(accessListQueryAll)
+	if err != nil {
+		log.Println("Error loading access lists", err)
+		return false
+	}
+	defer rows.Close()
+	lists := make(map[AccessListType]map[string]bool)
+	for rows.Next() {
+		var listType AccessListType
+		var uid string
+		if err = rows.Scan(&listType, &uid); err != nil {
+			log.Println("Error scanning access list entry", err)
+			return false
+		}
+		if lists[listType] == nil {
+			lists[listType] = make(map[string]bool)
+		}
+		lists[listType][uid] = true
+	}
+	accessListCache.lists = lists
+	accessListCache.allowlistMode = mode == strconv.FormatBool(true)
+	accessListCache.loaded = true
+	return true
+}
+
+func GetAccessListTypeFromString(s string) AccessListType {
+	switch strings.ToUpper(s) {
+	case "ALLOWGUILD":
+		return AccessListAllowGuild
+	case "BLOCKGUILD":
+		return AccessListBlockGuild
+	case "BLOCKUSER":
+		return AccessListBlockUser
+	case "RAFFLEGUILD":
+		return AccessListRaffleGuild
+	default:
+		return -1
+	}
+}
+
+func GetStringFromAccessListType(listType AccessListType) string {
+	switch listType {
+	case AccessListAllowGuild:
+		return "allowguild"
+	case AccessListBlockGuild:
+		return "blockguild"
+	case AccessListBlockUser:
+		return "blockuser"
+	case AccessListRaffleGuild:
+		return "raffleguild"
+	default:
+		return "unknown"
+	}
+}
+
+func accessListCreateTable() {
+	_, err := moeDb.Exec(accessListTable)
+	if err != nil {
+		log.Println("Error creating access list table", err)
+		return
+	}
+	_, err = moeDb.Exec(accessListSeedRaffleGuild, AccessListRaffleGuild, botSettingRaffleGuildSeeded)
+	if err != nil {
+		log.Println("Error seeding raffle guild access list", err)
+		return
+	}
+	BotSettingSet(botSettingRaffleGuildSeeded, "true")
+}
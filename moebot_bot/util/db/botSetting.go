@@ -0,0 +1,50 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+)
+
+/*
+Settings for moebot as a whole rather than any one server, changed by the master at runtime
+*/
+const (
+	botSettingTable = `CREATE TABLE IF NOT EXISTS bot_setting(
+		Key VARCHAR(50) NOT NULL PRIMARY KEY,
+		Value TEXT NOT NULL
+	)`
+
+	botSettingQuery  = `SELECT Value FROM bot_setting WHERE Key = $1`
+	botSettingUpsert = `INSERT INTO bot_setting(Key, Value) VALUES ($1, $2) ON CONFLICT (Key) DO UPDATE SET Value = excluded.Value`
+
+	BotSettingAllowlistMode = "allowlist_mode"
+	// set once the raffle guild list has been seeded, so a guild the master removes isn't added back on the next start
+	botSettingRaffleGuildSeeded = "raffle_guild_seeded"
+)
+
+/*
+Gets a setting's value. Returns sql.ErrNoRows if it's never been set
+*/
+func BotSettingQuery(key string) (value string, err error) {
+	err = moeDb.QueryRow(botSettingQuery, key).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error querying bot setting "+key, err)
+	}
+	return
+}
+
+func BotSettingSet(key string, value string) error {
+	_, err := moeDb.Exec(botSettingUpsert, key, value)
+	if err != nil {
+		log.Println("Error updating bot setting "+key, err)
+	}
+	return err
+}
+
+func botSettingCreateTable() {
+	_, err := moeDb.Exec(botSettingTable)
+	if err != nil {
+		log.Println("Error creating bot setting table", err)
+		return
+	}
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+/*
+How new members prove they've read the rules (or at least aren't a bot)
+*/
+type VerifyMode int
+
+const (
+	// Type the RuleAgreement phrase or react to the RuleMessage
+	VerifyModeRules VerifyMode = 0
+	// Type back a code from an image sent by DM
+	VerifyModeCaptcha VerifyMode = 1
+
+	OptionsForVerifyMode = "rules, captcha"
+)
+
+type Captcha struct {
+	Id        int
+	GuildUid  string
+	UserUid   string
+	Code      string
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+const (
+	captchaTable = `CREATE TABLE IF NOT EXISTS captcha(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		GuildUid VARCHAR(20) NOT NULL,
+		UserUid VARCHAR(20) NOT NULL,
+		Code VARCHAR(20) NOT NULL,
+		Attempts INTEGER NOT NULL DEFAULT 0,
+		ExpiresAt TIMESTAMP NOT NULL,
+		UNIQUE (GuildUid, UserUid)
+	)`
+
+	captchaUpsert = `INSERT INTO captcha(GuildUid, UserUid, Code, ExpiresAt) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (GuildUid, UserUid) DO UPDATE SET Code = excluded.Code, Attempts = 0, ExpiresAt = excluded.ExpiresAt`
+	captchaQueryUser         = `SELECT Id, GuildUid, UserUid, Code, Attempts, ExpiresAt FROM captcha WHERE UserUid = $1 ORDER BY ExpiresAt DESC`
+	captchaIncrementAttempts = `UPDATE captcha SET Attempts = Attempts + 1 WHERE Id = $1 RETURNING Attempts`
+	captchaDelete            = `DELETE FROM captcha WHERE GuildUid = $1 AND UserUid = $2`
+	captchaDeleteExpired     = `DELETE FROM captcha WHERE ExpiresAt < $1`
+)
+
+/*
+Stores a new captcha for a member, replacing any they already had
+*/
+func CaptchaUpsert(guildUid string, userUid string, code string, expiresAt time.Time) error {
+	_, err := moeDb.Exec(captchaUpsert, guildUid, userUid, code, expiresAt)
+	if err != nil {
+		log.Println("Error upserting captcha", err)
+	}
+	return err
+}
+
+/*
+Gets every pending captcha for a user, newest first. A user can have one pending captcha per guild
+*/
+func CaptchaQueryUser(userUid string) (captchas []Captcha, err error) {
+	rows, err := moeDb.Query(captchaQueryUser, userUid)
+	if err != nil {
+		log.Println("Error querying captchas", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c Captcha
+		if err = rows.Scan(&c.Id, &c.GuildUid, &c.UserUid, &c.Code, &c.Attempts, &c.ExpiresAt); err != nil {
+			log.Println("Error scanning captcha", err)
+			return
+		}
+		captchas = append(captchas, c)
+	}
+	return
+}
+
+func CaptchaIncrementAttempts(id int) (attempts int, err error) {
+	err = moeDb.QueryRow(captchaIncrementAttempts, id).Scan(&attempts)
+	if err != nil {
+		log.Println("Error incrementing captcha attempts", err)
+	}
+	return
+}
+
+func CaptchaDelete(guildUid string, userUid string) error {
+	_, err := moeDb.Exec(captchaDelete, guildUid, userUid)
+	if err != nil {
+		log.Println("Error deleting captcha", err)
+	}
+	return err
+}
+
+func CaptchaDeleteExpired(now time.Time) error {
+	_, err := moeDb.Exec(captchaDeleteExpired, now)
+	if err != nil {
+		log.Println("Error deleting expired captchas", err)
+	}
+	return err
+}
+
+func GetVerifyModeFromString(s string) VerifyMode {
+	switch strings.ToUpper(s) {
+	case "RULES":
+		return VerifyModeRules
+	case "CAPTCHA":
+		return VerifyModeCaptcha
+	default:
+		return -1
+	}
+}
+
+func GetStringFromVerifyMode(mode VerifyMode) string {
+	switch mode {
+	case VerifyModeRules:
+		return "rules"
+	case VerifyModeCaptcha:
+		return "captcha"
+	default:
+		return "unknown"
+	}
+}
+
+func captchaCreateTable() {
+	_, err := moeDb.Exec(captchaTable)
+	if err != nil {
+		log.Println("Error creating captcha table", err)
+		return
+	}
+}
@@ -30,6 +30,7 @@ func SetupDatabase(dbPass string, moeDataPass string) {
 	// actually connect with moebot now
 	moeDb = openDb(createConnString("moebot", moeDataPass, "moebot"))
 	createTables()
+	go serverCacheRecordMetrics()
 	log.Println("Finished initalizing the DB and creating tables")
 }
 
@@ -49,21 +50,33 @@ func createTables() {
 	// NOTE: varchar(20) for any snowflake ID's, which is the max for UINT64
 	// SERVER
 	serverCreateTable()
+	serverVersionCreateTable()
+	noticeRouteCreateTable()
 	// USER
 	userCreateTable()
 	userServerRankCreateTable()
+	rankTierCreateTable()
+	rankEventCreateTable()
+	memberEventCreateTable()
+	verifyReminderCreateTable()
+	captchaCreateTable()
 	// ROLE
 	roleGroupCreateTable()
 	roleCreateTable()
+	roleCodeCreateTable()
 	// CHANNEL
 	channelCreateTable()
 	// RAFFLE ENTRY
-	moeDb.Exec(raffleTable)
+	raffleCreateTable()
 	//POLL
-	moeDb.Exec(pollTable)
+	pollCreateTable()
 	moeDb.Exec(pollOptionTable)
+	pollBallotCreateTable()
 	// METRIC
 	metricCreateTable()
+	// ACCESS
+	botSettingCreateTable()
+	accessListCreateTable()
 }
 
 /*
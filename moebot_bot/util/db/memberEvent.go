@@ -0,0 +1,204 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+type MemberEventType int
+
+const (
+	MemberEventJoin  MemberEventType = 1
+	MemberEventLeave MemberEventType = 2
+)
+
+/*
+What happens to a member's rank and raffle data after they leave a server
+*/
+type LeaverPolicy int
+
+const (
+	// Leave everything as is
+	LeaverPolicyKeep LeaverPolicy = 0
+	// Hide the member's rank and raffle entries until they come back
+	LeaverPolicyFreeze LeaverPolicy = 1
+	// Hide the member's data, then delete it once they've been gone for LeaverPurgeDays
+	LeaverPolicyPurge LeaverPolicy = 2
+
+	OptionsForLeaverPolicy = "keep, freeze, purge"
+)
+
+/*
+Summary of a member's join and leave history in a single guild
+*/
+type MemberHistory struct {
+	Joins     int
+	Leaves    int
+	LastJoin  sql.NullString
+	LastLeave sql.NullString
+}
+
+/*
+A member who left a guild and hasn't come back
+*/
+type MemberLeaver struct {
+	EventId  int
+	GuildUid string
+	UserUid  string
+}
+
+const (
+	memberEventTable = `CREATE TABLE IF NOT EXISTS member_event(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		GuildUid VARCHAR(20) NOT NULL,
+		UserUid VARCHAR(20) NOT NULL,
+		EventType SMALLINT NOT NULL,
+		EventTime TIMESTAMP NOT NULL DEFAULT now(),
+		Purged BOOLEAN NOT NULL DEFAULT false
+	)`
+
+	memberEventIndex = `CREATE INDEX IF NOT EXISTS member_event_guild_user_idx ON member_event(GuildUid, UserUid)`
+
+	memberEventInsert  = `INSERT INTO member_event(GuildUid, UserUid, EventType) VALUES ($1, $2, $3)`
+	memberEventHistory = `SELECT
+		COUNT(*) FILTER (WHERE EventType = $3),
+		COUNT(*) FILTER (WHERE EventType = $4),
+		to_char(MAX(EventTime) FILTER (WHERE EventType = $3), 'YYYY-MM-DD HH24:MI'),
+		to_char(MAX(EventTime) FILTER (WHERE EventType = $4), 'YYYY-MM-DD HH24:MI')
+		FROM member_event WHERE GuildUid = $1 AND UserUid = $2`
+	// only the latest event for each member matters, if it's a leave then they haven't come back since
+	memberEventQueryPurgeable = `SELECT me.Id, me.GuildUid, me.UserUid FROM member_event AS me
+		JOIN server ON server.GuildUid = me.GuildUid
+		WHERE server.LeaverPolicy = $1 AND server.LeaverPurgeDays IS NOT NULL AND me.EventType = $2 AND NOT me.Purged
+		AND me.EventTime < now() - server.LeaverPurgeDays * INTERVAL '1 day'
+		AND me.Id = (SELECT MAX(latest.Id) FROM member_event AS latest WHERE latest.GuildUid = me.GuildUid AND latest.UserUid = me.UserUid)`
+	memberEventSetPurged = `UPDATE member_event SET Purged = true WHERE Id = $1`
+
+	userServerRankDeleteMember = `DELETE FROM user_server_rank USING server, user_profile
+		WHERE server.Id = user_server_rank.ServerId AND user_profile.Id = user_server_rank.UserId AND server.GuildUid = $1 AND user_profile.UserUid = $2`
+	userServerRankSetFrozen = `UPDATE user_server_rank SET Frozen = $3 FROM server, user_profile
+		WHERE server.Id = user_server_rank.ServerId AND user_profile.Id = user_server_rank.UserId AND server.GuildUid = $1 AND user_profile.UserUid = $2`
+	raffleDeleteMember = `DELETE FROM raffle_entry WHERE GuildUid = $1 AND UserUid = $2`
+	raffleSetFrozen    = `UPDATE raffle_entry SET Frozen = $3 WHERE GuildUid = $1 AND UserUid = $2`
+)
+
+func MemberEventInsert(guildUid string, userUid string, eventType MemberEventType) error {
+	_, err := moeDb.Exec(memberEventInsert, guildUid, userUid, eventType)
+	if err != nil {
+		log.Println("Error inserting member event", err)
+	}
+	return err
+}
+
+func MemberEventQueryHistory(guildUid string, userUid string) (history MemberHistory, err error) {
+	row := moeDb.QueryRow(memberEventHistory, guildUid, userUid, MemberEventJoin, MemberEventLeave)
+	if err = row.Scan(&history.Joins, &history.Leaves, &history.LastJoin, &history.LastLeave); err != nil {
+		log.Println("Error querying member history", err)
+	}
+	return
+}
+
+/*
+Gets every member who left a server with the purge policy and has been gone for longer than that server's purge days
+*/
+func MemberEventQueryPurgeable() (leavers []MemberLeaver, err error) {
+	rows, err := moeDb.Query(memberEventQueryPurgeable, LeaverPolicyPurge, MemberEventLeave)
+	if err != nil {
+		log.Println("Error querying purgeable members", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var leaver MemberLeaver
+		if err = rows.Scan(&leaver.EventId, &leaver.GuildUid, &leaver.UserUid); err != nil {
+			log.Println("Error scanning purgeable member", err)
+			return
+		}
+		leavers = append(leavers, leaver)
+	}
+	return
+}
+
+/*
+Deletes a leaver's rank, rank history and raffle data and marks their leave as handled, all or nothing
+*/
+func MemberPurge(leaver MemberLeaver) (err error) {
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning member purge transaction", err)
+		return
+	}
+	for _, statement := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{userServerRankDeleteMember, []interface{}{leaver.GuildUid, leaver.UserUid}},
+		{rankEventDeleteMember, []interface{}{leaver.GuildUid, leaver.UserUid}},
+		{raffleDeleteMember, []interface{}{leaver.GuildUid, leaver.UserUid}},
+		{memberEventSetPurged, []interface{}{leaver.EventId}},
+	} {
+		if _, err = tx.Exec(statement.query, statement.args...); err != nil {
+			log.Println("Error purging member data", err)
+			tx.Rollback()
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing member purge", err)
+	}
+	return
+}
+
+/*
+Hides or restores a member's rank and raffle entries in a guild
+*/
+func MemberSetFrozen(guildUid string, userUid string, frozen bool) error {
+	if _, err := moeDb.Exec(userServerRankSetFrozen, guildUid, userUid, frozen); err != nil {
+		log.Println("Error updating frozen user server rank", err)
+		return err
+	}
+	if _, err := moeDb.Exec(raffleSetFrozen, guildUid, userUid, frozen); err != nil {
+		log.Println("Error updating frozen raffle entry", err)
+		return err
+	}
+	return nil
+}
+
+func GetLeaverPolicyFromString(s string) LeaverPolicy {
+	switch strings.ToUpper(s) {
+	case "KEEP":
+		return LeaverPolicyKeep
+	case "FREEZE":
+		return LeaverPolicyFreeze
+	case "PURGE":
+		return LeaverPolicyPurge
+	default:
+		return -1
+	}
+}
+
+func GetStringFromLeaverPolicy(policy LeaverPolicy) string {
+	switch policy {
+	case LeaverPolicyKeep:
+		return "keep"
+	case LeaverPolicyFreeze:
+		return "freeze"
+	case LeaverPolicyPurge:
+		return "purge"
+	default:
+		return "unknown"
+	}
+}
+
+func memberEventCreateTable() {
+	_, err := moeDb.Exec(memberEventTable)
+	if err != nil {
+		log.Println("Error creating member event table", err)
+		return
+	}
+	_, err = moeDb.Exec(memberEventIndex)
+	if err != nil {
+		log.Println("Error creating member event index", err)
+	}
+}
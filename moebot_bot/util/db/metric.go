@@ -14,8 +14,26 @@ const (
 		Metric representing a timer. This should store JSON data regarding timers and time data
 	*/
 	MetricTypeTimer MetricType = 1
+	/*
+		Metric representing the server cache's hit and miss counts over an interval. Stores ServerCacheStats as JSON
+	*/
+	MetricTypeServerCache MetricType = 2
+	/*
+		Metric representing a single flush of the buffered veteran points. Stores VeteranFlushStats as JSON
+	*/
+	MetricTypeVeteranFlush MetricType = 3
 )
 
+type VeteranFlushStats struct {
+	// What triggered the flush: size, timer or shutdown
+	Reason    string `json:"reason"`
+	BatchSize int    `json:"batchSize"`
+	// How long the oldest points waited in the buffer, and how long writing them took
+	WaitedMs   int64 `json:"waitedMs"`
+	DurationMs int64 `json:"durationMs"`
+	Failed     bool  `json:"failed"`
+}
+
 type MetricTimerJson struct {
 	Events []event.TimerMark `json:"events"`
 	UserId int               `json:"userId"`
@@ -53,6 +71,32 @@ func MetricInsertTimer(metric event.Timer, user UserProfile) error {
 	return err
 }
 
+func MetricInsertServerCache(stats ServerCacheStats) error {
+	jsonData, err := json.Marshal(stats)
+	if err != nil {
+		log.Println("Failed to serialize JSON data for server cache metric", err)
+		return err
+	}
+	_, err = moeDb.Exec(metricInsert, MetricTypeServerCache, jsonData)
+	if err != nil {
+		log.Println("Failed to write to metric table", err)
+	}
+	return err
+}
+
+func MetricInsertVeteranFlush(stats VeteranFlushStats) error {
+	jsonData, err := json.Marshal(stats)
+	if err != nil {
+		log.Println("Failed to serialize JSON data for veteran flush metric", err)
+		return err
+	}
+	_, err = moeDb.Exec(metricInsert, MetricTypeVeteranFlush, jsonData)
+	if err != nil {
+		log.Println("Failed to write to metric table", err)
+	}
+	return err
+}
+
 func metricCreateTable() {
 	_, err := moeDb.Exec(metricTable)
 	if err != nil {
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+/*
+The kinds of operational notices moebot sends to a server's admins
+*/
+type NoticeCategory int
+
+const (
+	// Something in moebot's settings or the server's roles and permissions needs fixing
+	NoticeConfig NoticeCategory = 0
+	// Members that reached a new rank
+	NoticePromotion NoticeCategory = 1
+	// Member activity admins may want to know about, such as rejoins, kicks and failed verification
+	NoticeModeration NoticeCategory = 2
+	// Pins that couldn't be moved
+	NoticePinMove NoticeCategory = 3
+	// moebot failed to do something it was supposed to
+	NoticeFailure NoticeCategory = 4
+
+	OptionsForNoticeCategory = "config, promotion, moderation, pinmove, failure"
+)
+
+var AllNoticeCategories = []NoticeCategory{NoticeConfig, NoticePromotion, NoticeModeration, NoticePinMove, NoticeFailure}
+
+/*
+Where a category of notices gets sent
+*/
+type NoticeTarget int
+
+const (
+	// The server's BotChannel. Used for any category without a route
+	NoticeTargetBotChannel NoticeTarget = 0
+	NoticeTargetChannel    NoticeTarget = 1
+	// A DM to the guild owner
+	NoticeTargetOwner NoticeTarget = 2
+	NoticeTargetOff   NoticeTarget = 3
+
+	OptionsForNoticeTarget = "botchannel, channel <channel ID>, owner, off"
+)
+
+type NoticeRoute struct {
+	Id         int
+	ServerId   int
+	Category   NoticeCategory
+	Target     NoticeTarget
+	ChannelUid sql.NullString // Only set when Target is NoticeTargetChannel
+}
+
+const (
+	noticeRouteTable = `CREATE TABLE IF NOT EXISTS notice_route(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		ServerId INTEGER NOT NULL REFERENCES server(Id) ON DELETE CASCADE,
+		Category SMALLINT NOT NULL,
+		Target SMALLINT NOT NULL,
+		ChannelUid VARCHAR(20),
+		UNIQUE (ServerId, Category)
+	)`
+
+	noticeRouteQuery       = `SELECT Id, ServerId, Category, Target, ChannelUid FROM notice_route WHERE ServerId = $1 AND Category = $2`
+	noticeRouteQueryServer = `SELECT Id, ServerId, Category, Target, ChannelUid FROM notice_route WHERE ServerId = $1`
+	noticeRouteUpsert      = `INSERT INTO notice_route(ServerId, Category, Target, ChannelUid) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (ServerId, Category) DO UPDATE SET Target = excluded.Target, ChannelUid = excluded.ChannelUid`
+	noticeRouteDelete = `DELETE FROM notice_route WHERE ServerId = $1 AND Category = $2`
+)
+
+/*
+Gets where a category of notices goes for a server. Categories that were never routed go to the BotChannel
+*/
+func NoticeRouteQuery(serverId int, category NoticeCategory) (r NoticeRoute, err error) {
+	err = moeDb.QueryRow(noticeRouteQuery, serverId, category).Scan(&r.Id, &r.ServerId, &r.Category, &r.Target, &r.ChannelUid)
+	if err == sql.ErrNoRows {
+		return NoticeRoute{ServerId: serverId, Category: category, Target: NoticeTargetBotChannel}, nil
+	} else if err != nil {
+		log.Println("Error querying notice route", err)
+	}
+	return
+}
+
+/*
+Gets the route for every category for a server, in the same order as AllNoticeCategories
+*/
+func NoticeRouteQueryServer(serverId int) (routes []NoticeRoute, err error) {
+	rows, err := moeDb.Query(noticeRouteQueryServer, serverId)
+	if err != nil {
+		log.Println("Error querying notice routes", err)
+		return
+	}
+	defer rows.Close()
+	stored := make(map[NoticeCategory]NoticeRoute)
+	for rows.Next() {
+		var r NoticeRoute
+		if err = rows.Scan(&r.Id, &r.ServerId, &r.Category, &r.Target, &r.ChannelUid); err != nil {
+			log.Println("Error scanning notice route", err)
+			return
+		}
+		stored[r.Category] = r
+	}
+	for _, category := range AllNoticeCategories {
+		r, ok := stored[category]
+		if !ok {
+			r = NoticeRoute{ServerId: serverId, Category: category, Target: NoticeTargetBotChannel}
+		}
+		routes = append(routes, r)
+	}
+	return
+}
+
+/*
+Changes where a category of notices goes. Routing to the BotChannel just removes the route
+*/
+func NoticeRouteSet(r NoticeRoute) (err error) {
+	if r.Target == NoticeTargetBotChannel {
+		_, err = moeDb.Exec(noticeRouteDelete, r.ServerId, r.Category)
+	} else {
+		_, err = moeDb.Exec(noticeRouteUpsert, r.ServerId, r.Category, r.Target, r.ChannelUid)
+	}
+	if err != nil {
+		log.Println("Error updating notice route", err)
+	}
+	return
+}
+
+func GetNoticeCategoryFromString(s string) NoticeCategory {
+	switch strings.ToUpper(s) {
+	case "CONFIG":
+		return NoticeConfig
+	case "PROMOTION":
+		return NoticePromotion
+	case "MODERATION":
+		return NoticeModeration
+	case "PINMOVE":
+		return NoticePinMove
+	case "FAILURE":
+		return NoticeFailure
+	default:
+		return -1
+	}
+}
+
+func GetStringFromNoticeCategory(category NoticeCategory) string {
+	switch category {
+	case NoticeConfig:
+		return "config"
+	case NoticePromotion:
+		return "promotion"
+	case NoticeModeration:
+		return "moderation"
+	case NoticePinMove:
+		return "pinmove"
+	case NoticeFailure:
+		return "failure"
+	default:
+		return "unknown"
+	}
+}
+
+func GetNoticeTargetFromString(s string) NoticeTarget {
+	switch strings.ToUpper(s) {
+	case "BOTCHANNEL":
+		return NoticeTargetBotChannel
+	case "CHANNEL":
+		return NoticeTargetChannel
+	case "OWNER":
+		return NoticeTargetOwner
+	case "OFF":
+		return NoticeTargetOff
+	default:
+		return -1
+	}
+}
+
+func GetStringFromNoticeRoute(r NoticeRoute) string {
+	switch r.Target {
+	case NoticeTargetBotChannel:
+		return "bot channel"
+	case NoticeTargetChannel:
+		return "<#" + r.ChannelUid.String + ">"
+	case NoticeTargetOwner:
+		return "DM to the owner"
+	case NoticeTargetOff:
+		return "off"
+	default:
+		return "unknown"
+	}
+}
+
+func noticeRouteCreateTable() {
+	_, err := moeDb.Exec(noticeRouteTable)
+	if err != nil {
+		log.Println("Error creating notice route table", err)
+		return
+	}
+}
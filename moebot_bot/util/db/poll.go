@@ -1,6 +1,24 @@
 package db
 
-import "log"
+import (
+	"log"
+
+	"github.com/lib/pq"
+)
+
+/*
+How members vote in a poll
+*/
+type PollType int
+
+const (
+	// one option each, picking another takes back the first
+	PollSingle PollType = 0
+	// up to MaxChoices options each
+	PollMulti PollType = 1
+	// members rank options by DM, and the winner is found with instant-runoff
+	PollRanked PollType = 2
+)
 
 type Poll struct {
 	Id         int
@@ -10,6 +28,15 @@ type Poll struct {
 	ChannelId  int
 	UserUid    string
 	MessageUid string
+	// When the poll closes on its own, if it was given a deadline
+	ClosesAt pq.NullTime
+	// When to remind the channel the poll is closing. Cleared once the reminder is sent
+	RemindAt pq.NullTime
+	Type     PollType
+	// How many options each member can pick in a multi-choice poll
+	MaxChoices int
+	// Every member's ranking in a ranked-choice poll. Only loaded when counting votes
+	Ballots []*PollBallot
 }
 
 const (
@@ -22,22 +49,32 @@ const (
 		Open BOOLEAN NOT NULL DEFAULT TRUE
 	)`
 
-	pollSelect = `SELECT Id, Title, ChannelId, UserUid, MessageUid, Open FROM poll WHERE Id = $1`
+	pollSelect = `SELECT Id, Title, ChannelId, UserUid, MessageUid, Open, ClosesAt, RemindAt, Type, MaxChoices FROM poll WHERE Id = $1`
 
-	pollSelectOpen = `SELECT Id, Title, ChannelId, UserUid, MessageUid, Open FROM poll WHERE Open = TRUE`
+	pollSelectOpen = `SELECT Id, Title, ChannelId, UserUid, MessageUid, Open, ClosesAt, RemindAt, Type, MaxChoices FROM poll WHERE Open = TRUE`
 
 	pollClose = `UPDATE poll SET Open = FALSE WHERE Id = $1`
 
-	pollInsert = `INSERT INTO poll (Title, ChannelId, UserUid) VALUES($1, $2, $3) RETURNING Id`
+	pollInsert = `INSERT INTO poll (Title, ChannelId, UserUid, ClosesAt, RemindAt, Type, MaxChoices) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING Id`
 
 	pollSetMessageId = `UPDATE poll SET MessageUid = $1 WHERE Id = $2`
+
+	pollClearRemindAt = `UPDATE poll SET RemindAt = NULL WHERE Id = $1`
 )
 
+var pollUpdateTable = []string{
+	`ALTER TABLE poll ADD COLUMN IF NOT EXISTS ClosesAt TIMESTAMP`,
+	`ALTER TABLE poll ADD COLUMN IF NOT EXISTS RemindAt TIMESTAMP`,
+	`ALTER TABLE poll ADD COLUMN IF NOT EXISTS Type SMALLINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE poll ADD COLUMN IF NOT EXISTS MaxChoices SMALLINT NOT NULL DEFAULT 1`,
+}
+
 func PollQuery(id int) (*Poll, error) {
 	var err error
 	row := moeDb.QueryRow(pollSelect, id)
 	result := new(Poll)
-	if err = row.Scan(&result.Id, &result.Title, &result.ChannelId, &result.UserUid, &result.MessageUid, &result.Open); err != nil {
+	if err = row.Scan(&result.Id, &result.Title, &result.ChannelId, &result.UserUid, &result.MessageUid, &result.Open, &result.ClosesAt,
+		&result.RemindAt, &result.Type, &result.MaxChoices); err != nil {
 		log.Println("Error querying for poll", err)
 		return nil, err
 	}
@@ -58,7 +95,7 @@ func PollsOpenQuery() ([]*Poll, error) {
 	result := []*Poll{}
 	for rows.Next() {
 		p := new(Poll)
-		rows.Scan(&p.Id, &p.Title, &p.ChannelId, &p.UserUid, &p.MessageUid, &p.Open)
+		rows.Scan(&p.Id, &p.Title, &p.ChannelId, &p.UserUid, &p.MessageUid, &p.Open, &p.ClosesAt, &p.RemindAt, &p.Type, &p.MaxChoices)
 		result = append(result, p)
 	}
 	return result, nil
@@ -74,7 +111,7 @@ func PollClose(id int) error {
 }
 
 func PollAdd(poll *Poll) error {
-	err := moeDb.QueryRow(pollInsert, poll.Title, poll.ChannelId, poll.UserUid).Scan(&poll.Id)
+	err := moeDb.QueryRow(pollInsert, poll.Title, poll.ChannelId, poll.UserUid, poll.ClosesAt, poll.RemindAt, poll.Type, poll.MaxChoices).Scan(&poll.Id)
 	if err != nil {
 		log.Println("Error creating the poll", err)
 		return err
@@ -90,3 +127,22 @@ func PollSetMessageId(poll *Poll) error {
 	}
 	return nil
 }
+
+/*
+Marks a poll's closing reminder as sent, so it isn't sent again after a restart
+*/
+func PollClearRemindAt(id int) error {
+	_, err := moeDb.Exec(pollClearRemindAt, id)
+	if err != nil {
+		log.Println("Error clearing the reminder for the poll", err)
+		return err
+	}
+	return nil
+}
+
+func pollCreateTable() {
+	moeDb.Exec(pollTable)
+	for _, alter := range pollUpdateTable {
+		moeDb.Exec(alter)
+	}
+}
@@ -0,0 +1,87 @@
+package db
+
+import "log"
+
+/*
+One member's ranking in a ranked-choice poll, favorite first
+*/
+type PollBallot struct {
+	UserUid   string
+	OptionIds []int
+}
+
+const (
+	pollBallotTable = `CREATE TABLE IF NOT EXISTS poll_ballot(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		PollId INTEGER NOT NULL REFERENCES poll(Id) ON DELETE CASCADE,
+		UserUid VARCHAR(20) NOT NULL,
+		OptionId INTEGER NOT NULL REFERENCES poll_option(Id) ON DELETE CASCADE,
+		Rank SMALLINT NOT NULL,
+		UNIQUE (PollId, UserUid, Rank)
+	)`
+
+	pollBallotSelectPoll = `SELECT UserUid, OptionId FROM poll_ballot WHERE PollId = $1 ORDER BY UserUid, Rank`
+
+	pollBallotDelete = `DELETE FROM poll_ballot WHERE PollId = $1 AND UserUid = $2`
+
+	pollBallotInsert = `INSERT INTO poll_ballot (PollId, UserUid, OptionId, Rank) VALUES($1, $2, $3, $4)`
+)
+
+func PollBallotQuery(pollId int) ([]*PollBallot, error) {
+	rows, err := moeDb.Query(pollBallotSelectPoll, pollId)
+	if err != nil {
+		log.Println("Error querying for poll ballots", err)
+		return nil, err
+	}
+	defer rows.Close()
+	result := []*PollBallot{}
+	var current *PollBallot
+	for rows.Next() {
+		var userUid string
+		var optionId int
+		if err = rows.Scan(&userUid, &optionId); err != nil {
+			log.Println("Error scanning poll ballot", err)
+			return nil, err
+		}
+		if current == nil || current.UserUid != userUid {
+			current = &PollBallot{UserUid: userUid}
+			result = append(result, current)
+		}
+		current.OptionIds = append(current.OptionIds, optionId)
+	}
+	return result, nil
+}
+
+/*
+Replaces a member's ranking in a poll with a new one
+*/
+func PollBallotSet(pollId int, ballot *PollBallot) error {
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning poll ballot transaction", err)
+		return err
+	}
+	if _, err = tx.Exec(pollBallotDelete, pollId, ballot.UserUid); err != nil {
+		log.Println("Error deleting previous poll ballot", err)
+		tx.Rollback()
+		return err
+	}
+	for i, optionId := range ballot.OptionIds {
+		if _, err = tx.Exec(pollBallotInsert, pollId, ballot.UserUid, optionId, i+1); err != nil {
+			log.Println("Error inserting poll ballot", err)
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing poll ballot", err)
+	}
+	return err
+}
+
+func pollBallotCreateTable() {
+	_, err := moeDb.Exec(pollBallotTable)
+	if err != nil {
+		log.Println("Error creating poll ballot table", err)
+	}
+}
@@ -34,7 +34,7 @@ const (
 					WHERE re.UserUid = $1 AND re.GuildUid = $2`
 
 	raffleQueryAny = raffleSelect + `FROM raffle_entry AS re
-						WHERE re.GuildUid = $1`
+						WHERE re.GuildUid = $1 AND NOT re.Frozen`
 
 	raffleTable = `CREATE TABLE IF NOT EXISTS raffle_entry(
 					Id SERIAL NOT NULL PRIMARY KEY,
@@ -44,6 +44,7 @@ const (
 					TicketCount INTEGER NOT NULL DEFAULT 0,
 					RaffleData VARCHAR(1000) NOT NULL,
 					LastTicketUpdate BIGINT NOT NULL DEFAULT 0,
+					Frozen BOOLEAN NOT NULL DEFAULT false,
 					UNIQUE (GuildUid, UserUid)
 				)`
 
@@ -56,6 +57,10 @@ const (
 	RaffleDataSeparator = "|"
 )
 
+var raffleUpdateTable = []string{
+	`ALTER TABLE raffle_entry ADD COLUMN IF NOT EXISTS Frozen BOOLEAN NOT NULL DEFAULT false`,
+}
+
 func RaffleEntryAdd(entry RaffleEntry) error {
 	_, err := moeDb.Exec(raffleInsert, entry.GuildUid, entry.UserUid, entry.RaffleType, entry.TicketCount, entry.RaffleData)
 	if err != nil {
@@ -127,3 +132,18 @@ func RaffleEntryQueryAny(guildUid string) (raffleEntries []RaffleEntry, err erro
 func (re *RaffleEntry) SetRaffleData(raffleData string) {
 	re.RaffleData = raffleData
 }
+
+func raffleCreateTable() {
+	_, err := moeDb.Exec(raffleTable)
+	if err != nil {
+		log.Println("Error creating raffle table", err)
+		return
+	}
+	for _, alter := range raffleUpdateTable {
+		_, err = moeDb.Exec(alter)
+		if err != nil {
+			log.Println("Error altering raffle table", err)
+			return
+		}
+	}
+}
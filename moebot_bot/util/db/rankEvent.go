@@ -0,0 +1,285 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+/*
+A change to a user's rank in a server, kept so points can be totaled over a window of time
+*/
+type RankEvent struct {
+	Id       int
+	ServerId int
+	UserId   int
+	Points   int
+	Type     RankEventType
+	// Why a mod adjusted the points, and who did it. Only set for adjustments
+	Reason    sql.NullString
+	ActorId   sql.NullInt64
+	CreatedAt time.Time
+}
+
+/*
+A mod's change to someone's points, with the mod's UID filled in. ActorUid isn't valid if the mod's profile was deleted
+*/
+type RankAdjustment struct {
+	Points    int
+	Reason    string
+	ActorUid  sql.NullString
+	CreatedAt time.Time
+}
+
+/*
+What caused a rank change
+*/
+type RankEventType int
+
+const (
+	RankEventActivity   RankEventType = 0
+	RankEventDecay      RankEventType = 1
+	RankEventAdjustment RankEventType = 2
+
+	RankEventReasonMaxLength       = 200
+	RankEventReasonMaxLengthString = "200"
+)
+
+/*
+How far back a leaderboard counts points from
+*/
+type LeaderboardWindow int
+
+const (
+	LeaderboardAllTime LeaderboardWindow = 0
+	LeaderboardMonth   LeaderboardWindow = 1
+	LeaderboardWeek    LeaderboardWindow = 2
+
+	OptionsForLeaderboardWindow = "all, month, week"
+)
+
+/*
+How much a user's points changed over a single day
+*/
+type RankEventDay struct {
+	Day    time.Time
+	Points int
+}
+
+type LeaderboardEntry struct {
+	UserUid string
+	Points  int
+}
+
+const (
+	rankEventTable = `CREATE TABLE IF NOT EXISTS rank_event(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		ServerId INTEGER NOT NULL REFERENCES server(Id) ON DELETE CASCADE,
+		UserId INTEGER NOT NULL REFERENCES user_profile(Id) ON DELETE CASCADE,
+		Points INTEGER NOT NULL,
+		Type SMALLINT NOT NULL DEFAULT 0,
+		Reason VARCHAR(200),
+		ActorId INTEGER REFERENCES user_profile(Id) ON DELETE SET NULL,
+		CreatedAt TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+
+	// events used to be stamped with the database's local time, which didn't line up with the UTC week and month windows
+	rankEventMigrateUtc = `DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'rank_event' AND column_name = 'createdat'
+			AND data_type = 'timestamp without time zone') THEN
+			ALTER TABLE rank_event ALTER COLUMN CreatedAt TYPE TIMESTAMPTZ;
+		END IF;
+	END $$`
+
+	rankEventIndex = `CREATE INDEX IF NOT EXISTS rank_event_server_created_idx ON rank_event(ServerId, CreatedAt)`
+	// a single member's history is looked up for charts and profiles
+	rankEventUserIndex = `CREATE INDEX IF NOT EXISTS rank_event_server_user_created_idx ON rank_event(ServerId, UserId, CreatedAt)`
+
+	rankEventInsert      = `INSERT INTO rank_event(ServerId, UserId, Points, Type) VALUES ($1, $2, $3, $4)`
+	rankEventInsertBatch = `INSERT INTO rank_event(ServerId, UserId, Points, Type)
+		SELECT change.ServerId, change.UserId, change.Points, $4::SMALLINT FROM unnest($1::INTEGER[], $2::INTEGER[], $3::INTEGER[]) AS change(ServerId, UserId, Points)`
+	rankEventInsertAdjustment = `INSERT INTO rank_event(ServerId, UserId, Points, Type, Reason, ActorId) VALUES ($1, $2, $3, $4, $5, $6)`
+	rankEventQueryAdjustments = `SELECT rank_event.Points, rank_event.Reason, actor.UserUid, rank_event.CreatedAt FROM rank_event
+		LEFT JOIN user_profile actor ON actor.Id = rank_event.ActorId
+		WHERE rank_event.ServerId = $1 AND rank_event.UserId = $2 AND rank_event.Type = $3
+		ORDER BY rank_event.CreatedAt DESC, rank_event.Id DESC
+		LIMIT $4`
+	rankEventQueryDays = `SELECT date_trunc('day', CreatedAt) AS Day, SUM(Points) FROM rank_event
+		WHERE ServerId = $1 AND UserId = $2 AND CreatedAt >= $3
+		GROUP BY Day
+		ORDER BY Day`
+	rankEventDeleteMember = `DELETE FROM rank_event USING server, user_profile
+		WHERE server.Id = rank_event.ServerId AND user_profile.Id = rank_event.UserId AND server.GuildUid = $1 AND user_profile.UserUid = $2`
+
+	// frozen members are hidden from leaderboards, the same way they're hidden everywhere else
+	leaderboardQueryAllTime = `SELECT user_profile.UserUid, user_server_rank.Rank FROM user_server_rank
+		JOIN user_profile ON user_profile.Id = user_server_rank.UserId
+		WHERE user_server_rank.ServerId = $1 AND NOT user_server_rank.Frozen AND user_server_rank.Rank > 0
+		ORDER BY user_server_rank.Rank DESC, user_server_rank.Id
+		LIMIT $2`
+	// points lost to decay don't count against what someone earned recently
+	leaderboardQuerySince = `SELECT user_profile.UserUid, SUM(rank_event.Points) AS Total FROM rank_event
+		JOIN user_profile ON user_profile.Id = rank_event.UserId
+		WHERE rank_event.ServerId = $1 AND rank_event.CreatedAt >= $2 AND rank_event.Type <> 1
+		AND EXISTS (SELECT 1 FROM user_server_rank WHERE user_server_rank.ServerId = rank_event.ServerId AND user_server_rank.UserId = rank_event.UserId
+			AND NOT user_server_rank.Frozen)
+		GROUP BY user_profile.UserUid
+		HAVING SUM(rank_event.Points) > 0
+		ORDER BY Total DESC, user_profile.UserUid
+		LIMIT $3`
+)
+
+var rankEventUpdateTable = []string{
+	`ALTER TABLE rank_event ADD COLUMN IF NOT EXISTS Type SMALLINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE rank_event ADD COLUMN IF NOT EXISTS Reason VARCHAR(200)`,
+	`ALTER TABLE rank_event ADD COLUMN IF NOT EXISTS ActorId INTEGER REFERENCES user_profile(Id) ON DELETE SET NULL`,
+}
+
+func rankEventInsertTx(tx *sql.Tx, serverId int, userId int, points int, eventType RankEventType) error {
+	_, err := tx.Exec(rankEventInsert, serverId, userId, points, eventType)
+	if err != nil {
+		log.Println("Error inserting rank event", err)
+	}
+	return err
+}
+
+func rankEventInsertAdjustmentTx(tx *sql.Tx, serverId int, userId int, points int, actorId int, reason string) error {
+	_, err := tx.Exec(rankEventInsertAdjustment, serverId, userId, points, RankEventAdjustment, reason, actorId)
+	if err != nil {
+		log.Println("Error inserting rank adjustment", err)
+	}
+	return err
+}
+
+/*
+Gets the most recent changes mods made to a user's points in a server, newest first
+*/
+func RankEventQueryAdjustments(serverId int, userId int, limit int) (adjustments []RankAdjustment, err error) {
+	rows, err := moeDb.Query(rankEventQueryAdjustments, serverId, userId, RankEventAdjustment, limit)
+	if err != nil {
+		log.Println("Error querying rank adjustments", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a RankAdjustment
+		if err = rows.Scan(&a.Points, &a.Reason, &a.ActorUid, &a.CreatedAt); err != nil {
+			log.Println("Error scanning rank adjustment", err)
+			return
+		}
+		adjustments = append(adjustments, a)
+	}
+	return
+}
+
+/*
+Gets how much a user's points changed each day since the given time, oldest first. Days without any changes are left out
+*/
+func RankEventQueryDays(serverId int, userId int, since time.Time) (days []RankEventDay, err error) {
+	rows, err := moeDb.Query(rankEventQueryDays, serverId, userId, since)
+	if err != nil {
+		log.Println("Error querying rank history", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d RankEventDay
+		if err = rows.Scan(&d.Day, &d.Points); err != nil {
+			log.Println("Error scanning rank history", err)
+			return
+		}
+		days = append(days, d)
+	}
+	return
+}
+
+func rankEventInsertBatchTx(tx *sql.Tx, serverIds []int64, userIds []int64, points []int64, eventType RankEventType) error {
+	_, err := tx.Exec(rankEventInsertBatch, pq.Array(serverIds), pq.Array(userIds), pq.Array(points), eventType)
+	if err != nil {
+		log.Println("Error inserting rank events", err)
+	}
+	return err
+}
+
+/*
+Gets the top members of a server, by total points or by points earned since the given time. A zero since means all time
+*/
+func LeaderboardQuery(serverId int, since time.Time, limit int) (entries []LeaderboardEntry, err error) {
+	var rows *sql.Rows
+	if since.IsZero() {
+		rows, err = moeDb.Query(leaderboardQueryAllTime, serverId, limit)
+	} else {
+		rows, err = moeDb.Query(leaderboardQuerySince, serverId, since, limit)
+	}
+	if err != nil {
+		log.Println("Error querying leaderboard", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e LeaderboardEntry
+		if err = rows.Scan(&e.UserUid, &e.Points); err != nil {
+			log.Println("Error scanning leaderboard entry", err)
+			return
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+func GetLeaderboardWindowFromString(s string) LeaderboardWindow {
+	switch strings.ToUpper(s) {
+	case "ALL", "ALLTIME":
+		return LeaderboardAllTime
+	case "MONTH":
+		return LeaderboardMonth
+	case "WEEK":
+		return LeaderboardWeek
+	default:
+		return -1
+	}
+}
+
+func GetStringFromLeaderboardWindow(window LeaderboardWindow) string {
+	switch window {
+	case LeaderboardAllTime:
+		return "all time"
+	case LeaderboardMonth:
+		return "this month"
+	case LeaderboardWeek:
+		return "this week"
+	default:
+		return "unknown"
+	}
+}
+
+func rankEventCreateTable() {
+	_, err := moeDb.Exec(rankEventTable)
+	if err != nil {
+		log.Println("Error creating rank event table", err)
+		return
+	}
+	_, err = moeDb.Exec(rankEventMigrateUtc)
+	if err != nil {
+		log.Println("Error migrating rank event timestamps", err)
+		return
+	}
+	for _, alter := range rankEventUpdateTable {
+		_, err = moeDb.Exec(alter)
+		if err != nil {
+			log.Println("Error altering rank event table", err)
+			return
+		}
+	}
+	for _, index := range []string{rankEventIndex, rankEventUserIndex} {
+		_, err = moeDb.Exec(index)
+		if err != nil {
+			log.Println("Error creating rank event index", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+)
+
+/*
+A step on a server's rank ladder. Members reach a tier once they have at least Threshold points
+*/
+type RankTier struct {
+	Id        int
+	ServerId  int
+	Name      string
+	Threshold int
+	// Role that comes with the tier, if any
+	RoleUid sql.NullString
+	// Template sent when someone reaches the tier. Uses a default message if null
+	Announcement sql.NullString
+	// Whether the role is given as soon as the tier is reached, or offered for members to claim with the role command
+	AutoGrant bool
+}
+
+const (
+	rankTierTable = `CREATE TABLE IF NOT EXISTS rank_tier(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		ServerId INTEGER NOT NULL REFERENCES server(Id) ON DELETE CASCADE,
+		Name VARCHAR(50) NOT NULL,
+		Threshold INTEGER NOT NULL,
+		RoleUid VARCHAR(20),
+		Announcement VARCHAR(1900),
+		AutoGrant BOOLEAN NOT NULL DEFAULT false,
+		UNIQUE (ServerId, Name),
+		UNIQUE (ServerId, Threshold)
+	)`
+
+	// Servers used to have a single VeteranRank and VeteranRole, which become the "Veteran" tier. Anyone who was already told they could
+	// become a veteran keeps that tier so they don't get told again. Servers without a VeteranRole never had veterans turned on, so they
+	// don't get a ladder
+	rankTierMigrateVeteran = `DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'server' AND column_name = 'veteranrank') THEN
+			INSERT INTO rank_tier(ServerId, Name, Threshold, RoleUid)
+				SELECT Id, 'Veteran', VeteranRank, VeteranRole FROM server WHERE VeteranRank IS NOT NULL AND VeteranRole IS NOT NULL
+				ON CONFLICT DO NOTHING;
+			UPDATE user_server_rank SET TierThreshold = server.VeteranRank FROM server
+				WHERE server.Id = user_server_rank.ServerId AND server.VeteranRank IS NOT NULL AND server.VeteranRole IS NOT NULL
+				AND user_server_rank.MessageSent;
+			ALTER TABLE server DROP COLUMN VeteranRank;
+			ALTER TABLE server DROP COLUMN IF EXISTS VeteranRole;
+			ALTER TABLE user_server_rank DROP COLUMN IF EXISTS MessageSent;
+		END IF;
+	END $$`
+
+	RankTierMaxNameLength       = 50
+	RankTierMaxNameLengthString = "50"
+
+	rankTierQueryServer = `SELECT Id, ServerId, Name, Threshold, RoleUid, Announcement, AutoGrant FROM rank_tier WHERE ServerId = $1 ORDER BY Threshold`
+	rankTierInsert      = `INSERT INTO rank_tier(ServerId, Name, Threshold, RoleUid, Announcement, AutoGrant) VALUES ($1, $2, $3, $4, $5, $6)`
+	rankTierUpdate      = `UPDATE rank_tier SET Name = $2, Threshold = $3, RoleUid = $4, Announcement = $5, AutoGrant = $6 WHERE Id = $1`
+	rankTierDelete      = `DELETE FROM rank_tier WHERE Id = $1`
+	rankTierClearRole   = `UPDATE rank_tier SET RoleUid = NULL WHERE ServerId = $1 AND RoleUid = $2`
+)
+
+// The ladder gets checked every time points are handed out, so each server's tiers are kept in memory until they change
+var rankTierCache = struct {
+	sync.RWMutex
+	m map[int][]RankTier
+}{m: make(map[int][]RankTier)}
+
+/*
+Gets a server's rank ladder, lowest tier first
+*/
+func RankTierQueryServer(serverId int) (tiers []RankTier, err error) {
+	rankTierCache.RLock()
+	cached, ok := rankTierCache.m[serverId]
+	rankTierCache.RUnlock()
+	if ok {
+		// copied so callers can change their tiers without changing the cache
+		return append([]RankTier(nil), cached...), nil
+	}
+	rows, err := moeDb.Query(rankTierQueryServer, serverId)
+	if err != nil {
+		log.Println("Error querying rank tiers", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t RankTier
+		if err = rows.Scan(&t.Id, &t.ServerId, &t.Name, &t.Threshold, &t.RoleUid, &t.Announcement, &t.AutoGrant); err != nil {
+			log.Println("Error scanning rank tier", err)
+			return nil, err
+		}
+		tiers = append(tiers, t)
+	}
+	rankTierCache.Lock()
+	rankTierCache.m[serverId] = append([]RankTier(nil), tiers...)
+	rankTierCache.Unlock()
+	return
+}
+
+/*
+Finds one of a server's tiers by name, ignoring case. Returns nil if there isn't one
+*/
+func RankTierFindName(tiers []RankTier, name string) *RankTier {
+	for i := range tiers {
+		if strings.EqualFold(tiers[i].Name, name) {
+			return &tiers[i]
+		}
+	}
+	return nil
+}
+
+func RankTierInsert(t RankTier) error {
+	_, err := moeDb.Exec(rankTierInsert, t.ServerId, t.Name, t.Threshold, t.RoleUid, t.Announcement, t.AutoGrant)
+	if err != nil {
+		log.Println("Error inserting rank tier", err)
+	}
+	rankTierCacheInvalidate(t.ServerId)
+	return err
+}
+
+func RankTierUpdate(t RankTier) error {
+	_, err := moeDb.Exec(rankTierUpdate, t.Id, t.Name, t.Threshold, t.RoleUid, t.Announcement, t.AutoGrant)
+	if err != nil {
+		log.Println("Error updating rank tier", err)
+	}
+	rankTierCacheInvalidate(t.ServerId)
+	return err
+}
+
+func RankTierDelete(t RankTier) error {
+	_, err := moeDb.Exec(rankTierDelete, t.Id)
+	if err != nil {
+		log.Println("Error deleting rank tier", err)
+	}
+	rankTierCacheInvalidate(t.ServerId)
+	return err
+}
+
+/*
+Removes a role from every tier that gives it, for when the role is deleted from discord
+*/
+func RankTierClearRole(serverId int, roleUid string) error {
+	_, err := moeDb.Exec(rankTierClearRole, serverId, roleUid)
+	if err != nil {
+		log.Println("Error clearing rank tier role", err)
+	}
+	rankTierCacheInvalidate(serverId)
+	return err
+}
+
+func rankTierCacheInvalidate(serverId int) {
+	rankTierCache.Lock()
+	delete(rankTierCache.m, serverId)
+	rankTierCache.Unlock()
+}
+
+func rankTierCreateTable() {
+	_, err := moeDb.Exec(rankTierTable)
+	if err != nil {
+		log.Println("Error creating rank tier table", err)
+		return
+	}
+	_, err = moeDb.Exec(rankTierMigrateVeteran)
+	if err != nil {
+		log.Println("Error migrating veteran settings to rank tiers", err)
+	}
+}
@@ -61,6 +61,10 @@ const (
 	roleInsert = `INSERT INTO role(ServerId, RoleUid, GroupId, Permission, ConfirmationMessage, ConfirmationSecurityAnswer, Trigger) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id`
 
 	roleDelete = `DELETE FROM role WHERE role.RoleUid = $1 AND role.ServerId = (SELECT server.id FROM server WHERE server.guilduid = $2)`
+
+	roleUpsert = `INSERT INTO role(ServerId, RoleUid, GroupId, Permission, ConfirmationMessage, ConfirmationSecurityAnswer, Trigger) VALUES($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (RoleUid) DO UPDATE SET ServerId = $1, GroupId = $3, Permission = $4, ConfirmationMessage = $5, ConfirmationSecurityAnswer = $6, Trigger = $7`
+	roleDeleteServer = `DELETE FROM role WHERE RoleUid = $1 AND ServerId = $2`
 )
 
 var (
@@ -234,6 +238,26 @@ func RoleDelete(roleUid string, guildUid string) error {
 	return err
 }
 
+/*
+Inserts or fully overwrites the given role as part of a larger transaction. Unlike RoleInsertOrUpdate every field is written as-is.
+*/
+func RoleInsertOrUpdateTx(tx *sql.Tx, role Role) error {
+	_, err := tx.Exec(roleUpsert, role.ServerId, strings.TrimSpace(role.RoleUid), role.GroupId, role.Permission, role.ConfirmationMessage,
+		role.ConfirmationSecurityAnswer, role.Trigger)
+	if err != nil {
+		log.Println("Error upserting role in transaction", err)
+	}
+	return err
+}
+
+func RoleDeleteTx(tx *sql.Tx, roleUid string, serverId int) error {
+	_, err := tx.Exec(roleDeleteServer, roleUid, serverId)
+	if err != nil {
+		log.Println("Error deleting role in transaction: ", roleUid)
+	}
+	return err
+}
+
 /*
 Gets a permission value from a string. This should be used when accepting user input.
 */
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	roleCodeTable = `CREATE TABLE IF NOT EXISTS role_code(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		Code VARCHAR(40) NOT NULL UNIQUE,
+		UserUid VARCHAR(20) NOT NULL,
+		RoleUid VARCHAR(20) NOT NULL,
+		UsedAt TIMESTAMP NOT NULL DEFAULT now()
+	)`
+
+	roleCodeInsert       = `INSERT INTO role_code(Code, UserUid, RoleUid) VALUES ($1, $2, $3) ON CONFLICT (Code) DO NOTHING`
+	roleCodeDeleteBefore = `DELETE FROM role_code WHERE UsedAt < $1`
+)
+
+/*
+Marks a role confirmation code as used. Returns false if the code was already used
+*/
+func RoleCodeUse(code string, userUid string, roleUid string) (firstUse bool, err error) {
+	result, err := moeDb.Exec(roleCodeInsert, code, userUid, roleUid)
+	if err != nil {
+		log.Println("Error inserting role code", err)
+		return false, err
+	}
+	rowCount, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error reading inserted role code count", err)
+		return false, err
+	}
+	return rowCount > 0, nil
+}
+
+/*
+Removes any used codes from before the given time. Expired codes are rejected anyways, so there's no need to keep them around
+*/
+func RoleCodeDeleteBefore(t time.Time) error {
+	_, err := moeDb.Exec(roleCodeDeleteBefore, t)
+	if err != nil {
+		log.Println("Error deleting old role codes", err)
+	}
+	return err
+}
+
+func roleCodeCreateTable() {
+	_, err := moeDb.Exec(roleCodeTable)
+	if err != nil {
+		log.Println("Error creating role code table", err)
+		return
+	}
+}
@@ -3,9 +3,9 @@ package db
 import (
 	"bytes"
 	"database/sql"
+	"fmt"
 	"log"
 	"strconv"
-	"sync"
 )
 
 /*
@@ -16,13 +16,46 @@ type Server struct {
 	GuildUid       string
 	WelcomeMessage sql.NullString // Message user gets sent when they first join the server, either via PM or public message depending on WelcomeChannel
 	RuleAgreement  sql.NullString // Message to type when the user agrees to the rules
-	VeteranRank    sql.NullInt64  // Rank at which a user can be promoted to the veteran role
-	VeteranRole    sql.NullString // Role to apply when a user can become a veteran
 	BotChannel     sql.NullString // Where any bot related information or errors get sent to.
 	Enabled        bool           // defaults to true, so that new servers that add moebot can immediately start using her. This can be turned off later
 	WelcomeChannel sql.NullString // Channel to post a welcome message. If null, send via PM's
 	StarterRole    sql.NullString // The role that is added when someone first joins a server
 	BaseRole       sql.NullString // The role that is added when someone types the RuleAgreement message. Should only exist when RuleAgreement isn't null
+	// Reply sent when someone types the RuleAgreement message. Uses the default reply if null
+	RuleAgreementReply sql.NullString
+	// If any of these are set the welcome message gets sent as an embed
+	WelcomeTitle sql.NullString
+	WelcomeColor sql.NullInt64
+	WelcomeImage sql.NullString
+	// Message sent when someone leaves the server, in GoodbyeChannel or the welcome channel if that's not set
+	GoodbyeMessage  sql.NullString
+	GoodbyeChannel  sql.NullString
+	LeaverPolicy    LeaverPolicy  // What happens to a leaver's rank and raffle data
+	LeaverPurgeDays sql.NullInt64 // How long to wait before purging a leaver's data, when LeaverPolicy is purge
+	// Message members can react to in order to agree to the rules, as an alternative to typing the RuleAgreement
+	RuleMessage        sql.NullString
+	RuleMessageChannel sql.NullString
+	// Hours a member can keep the StarterRole before VerifyTimeoutAction happens
+	VerifyTimeout       sql.NullInt64
+	VerifyTimeoutAction VerifyTimeoutAction
+	VerifyMode          VerifyMode // How new members get from the StarterRole to the BaseRole
+	// How members earn veteran points. Any that aren't set use the defaults in the veteran handler
+	VeteranMessagePoints    sql.NullInt64
+	VeteranReactionPoints   sql.NullInt64
+	VeteranMessageCooldown  sql.NullInt64  // Seconds between messages that earn points
+	VeteranReactionCooldown sql.NullInt64  // Seconds between reactions that earn points
+	VeteranIgnoredPrefixes  sql.NullString // Space separated prefixes of messages that don't earn points, usually other bots' commands
+	VeteranMinLength        sql.NullInt64  // Shortest message that earns points
+	VeteranDailyCap         sql.NullInt64  // Most points a member can earn in a day
+	// Space separated channelId:multiplier pairs for channels that earn more or less points. A multiplier of 0 excludes the channel
+	VeteranChannels sql.NullString
+	// Points earned for each minute in voice, and the most of them that can be earned in a day
+	VeteranVoicePoints   sql.NullInt64
+	VeteranVoiceDailyCap sql.NullInt64
+	// Percent of points members lose for each week they're inactive, down to DecayFloor. No decay if null
+	DecayPercent sql.NullInt64
+	DecayFloor   sql.NullInt64
+	DecayDemote  bool // Whether members who decay below a tier they reached lose it, along with its role
 }
 
 const (
@@ -31,19 +64,54 @@ const (
 		GuildUid VARCHAR(20) NOT NULL UNIQUE,
 		WelcomeMessage VARCHAR(1900),
 		RuleAgreement VARCHAR(1900),
-		VeteranRank INTEGER,
-		VeteranRole VARCHAR(20),
 		BotChannel VARCHAR(20),
 		Enabled BOOLEAN NOT NULL DEFAULT TRUE,
 		WelcomeChannel VARCHAR(20),
 		StarterRole VARCHAR(20),
-		BaseRole VARCHAR(20)
+		BaseRole VARCHAR(20),
+		RuleAgreementReply VARCHAR(1900),
+		WelcomeTitle VARCHAR(256),
+		WelcomeColor INTEGER,
+		WelcomeImage VARCHAR(512),
+		GoodbyeMessage VARCHAR(1900),
+		GoodbyeChannel VARCHAR(20),
+		LeaverPolicy SMALLINT NOT NULL DEFAULT 0,
+		LeaverPurgeDays INTEGER,
+		RuleMessage VARCHAR(20),
+		RuleMessageChannel VARCHAR(20),
+		VerifyTimeout INTEGER,
+		VerifyTimeoutAction SMALLINT NOT NULL DEFAULT 0,
+		VerifyMode SMALLINT NOT NULL DEFAULT 0,
+		LeftAt TIMESTAMP,
+		VeteranMessagePoints INTEGER,
+		VeteranReactionPoints INTEGER,
+		VeteranMessageCooldown INTEGER,
+		VeteranReactionCooldown INTEGER,
+		VeteranIgnoredPrefixes VARCHAR(100),
+		VeteranMinLength INTEGER,
+		VeteranDailyCap INTEGER,
+		VeteranChannels VARCHAR(1900),
+		DecayPercent INTEGER,
+		DecayFloor INTEGER,
+		DecayDemote BOOLEAN NOT NULL DEFAULT false,
+		VeteranVoicePoints INTEGER,
+		VeteranVoiceDailyCap INTEGER
 	)`
 
-	serverColumnNames        = `GuildUid, WelcomeMessage, RuleAgreement, VeteranRank, VeteranRole, BotChannel, Enabled, WelcomeChannel, StarterRole, BaseRole`
-	serverInsertColumnNames  = `GuildUid, WelcomeMessage, RuleAgreement, VeteranRank, VeteranRole, BotChannel, WelcomeChannel, StarterRole, BaseRole`
-	serverInsertColumnParams = `$1, $2, $3, $4, $5, $6, $7, $8, $9`
-	serverSetParams          = `WelcomeMessage = $2, RuleAgreement = $3, VeteranRank = $4, VeteranRole = $5, BotChannel = $6, Enabled = $7, StarterRole = $8, BaseRole = $9, WelcomeChannel = $10`
+	serverColumnNames = `GuildUid, WelcomeMessage, RuleAgreement, BotChannel, Enabled, WelcomeChannel, StarterRole, BaseRole,
+		RuleAgreementReply, WelcomeTitle, WelcomeColor, WelcomeImage, GoodbyeMessage, GoodbyeChannel, LeaverPolicy, LeaverPurgeDays,
+		RuleMessage, RuleMessageChannel, VerifyTimeout, VerifyTimeoutAction, VerifyMode, VeteranMessagePoints, VeteranReactionPoints,
+		VeteranMessageCooldown, VeteranReactionCooldown, VeteranIgnoredPrefixes, VeteranMinLength, VeteranDailyCap, VeteranChannels,
+		DecayPercent, DecayFloor, DecayDemote, VeteranVoicePoints, VeteranVoiceDailyCap`
+	serverInsertColumnNames  = `GuildUid, WelcomeMessage, RuleAgreement, BotChannel, WelcomeChannel, StarterRole, BaseRole`
+	serverInsertColumnParams = `$1, $2, $3, $4, $5, $6, $7`
+	serverSetParams          = `WelcomeMessage = $2, RuleAgreement = $3, BotChannel = $4, Enabled = $5, StarterRole = $6, BaseRole = $7, WelcomeChannel = $8,
+		RuleAgreementReply = $9, WelcomeTitle = $10, WelcomeColor = $11, WelcomeImage = $12, GoodbyeMessage = $13, GoodbyeChannel = $14,
+		LeaverPolicy = $15, LeaverPurgeDays = $16, RuleMessage = $17, RuleMessageChannel = $18, VerifyTimeout = $19, VerifyTimeoutAction = $20,
+		VerifyMode = $21, VeteranMessagePoints = $22, VeteranReactionPoints = $23, VeteranMessageCooldown = $24, VeteranReactionCooldown = $25,
+		VeteranIgnoredPrefixes = $26, VeteranMinLength = $27, VeteranDailyCap = $28, VeteranChannels = $29,
+		DecayPercent = $30, DecayFloor = $31, DecayDemote = $32,
+		VeteranVoicePoints = $33, VeteranVoiceDailyCap = $34`
 
 	serverQuery      = `SELECT Id, ` + serverColumnNames + ` FROM server WHERE Id = $1`
 	serverQueryGuild = `SELECT Id, ` + serverColumnNames + ` FROM server WHERE GuildUid = $1`
@@ -51,10 +119,14 @@ const (
 	serverUpdate     = `UPDATE server SET ` + serverSetParams + ` WHERE Id = $1`
 )
 
+const (
+	WelcomeTitleMaxLength           = 256
+	WelcomeImageMaxLength           = 512
+	VeteranIgnoredPrefixesMaxLength = 100
+)
+
 var (
 	serverUpdateTable = []string{
-		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranRank INTEGER`,
-		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranRole VARCHAR(20)`,
 		`ALTER TABLE server ADD COLUMN IF NOT EXISTS BotChannel VARCHAR(20)`,
 		`ALTER TABLE server ADD COLUMN IF NOT EXISTS Enabled BOOLEAN NOT NULL DEFAULT TRUE`,
 		`ALTER TABLE server ADD COLUMN IF NOT EXISTS WelcomeChannel VARCHAR(20)`,
@@ -62,29 +134,52 @@ var (
 		`ALTER TABLE server ADD COLUMN IF NOT EXISTS BaseRole VARCHAR(20)`,
 		`ALTER TABLE server DROP CONSTRAINT IF EXISTS server_defaultpinchannelid_fkey`,
 		`ALTER TABLE server DROP COLUMN IF EXISTS DefaultPinChannelId`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS RuleAgreementReply VARCHAR(1900)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS WelcomeTitle VARCHAR(256)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS WelcomeColor INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS WelcomeImage VARCHAR(512)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS GoodbyeMessage VARCHAR(1900)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS GoodbyeChannel VARCHAR(20)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS LeaverPolicy SMALLINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS LeaverPurgeDays INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS RuleMessage VARCHAR(20)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS RuleMessageChannel VARCHAR(20)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VerifyTimeout INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VerifyTimeoutAction SMALLINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VerifyMode SMALLINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS LeftAt TIMESTAMP`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranMessagePoints INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranReactionPoints INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranMessageCooldown INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranReactionCooldown INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranIgnoredPrefixes VARCHAR(100)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranMinLength INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranDailyCap INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranChannels VARCHAR(1900)`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS DecayPercent INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS DecayFloor INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS DecayDemote BOOLEAN NOT NULL DEFAULT false`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranVoicePoints INTEGER`,
+		`ALTER TABLE server ADD COLUMN IF NOT EXISTS VeteranVoiceDailyCap INTEGER`,
 	}
-
-	serverMemoryBuffer = struct {
-		sync.RWMutex
-		m map[string]Server
-	}{m: make(map[string]Server)}
 )
 
+/*
+Gets the server for a guild, creating it if this is the first time moebot has seen the guild. Reads go through the server cache
+*/
 func ServerQueryOrInsert(guildUid string) (s Server, e error) {
-	serverMemoryBuffer.RLock()
-	if memServer, ok := serverMemoryBuffer.m[guildUid]; ok {
-		serverMemoryBuffer.RUnlock()
-		return memServer, nil
+	s, generation, ok := serverCacheGet(guildUid)
+	if ok {
+		return s, nil
 	}
-	serverMemoryBuffer.RUnlock()
 	row := moeDb.QueryRow(serverQueryGuild, guildUid)
 	if e = serverScan(row, &s); e != nil {
 		if e == sql.ErrNoRows {
 			// no row, so insert it add in default values
 			toInsert := Server{GuildUid: guildUid}
 			var insertId int
-			e = moeDb.QueryRow(serverInsert, &toInsert.GuildUid, &s.WelcomeMessage, &s.RuleAgreement, &s.VeteranRank, &s.VeteranRole,
-				&s.BotChannel, &s.WelcomeChannel, &s.StarterRole, &s.BaseRole).Scan(&insertId)
+			e = moeDb.QueryRow(serverInsert, &toInsert.GuildUid, &s.WelcomeMessage, &s.RuleAgreement, &s.BotChannel, &s.WelcomeChannel,
+				&s.StarterRole, &s.BaseRole).Scan(&insertId)
 			if e != nil {
 				log.Println("Error inserting role to db ", e)
 				return Server{}, e
@@ -95,19 +190,25 @@ func ServerQueryOrInsert(guildUid string) (s Server, e error) {
 				return Server{}, e
 			}
 			// normal flow of inserting a new row
-			serverMemoryBuffer.Lock()
-			serverMemoryBuffer.m[guildUid] = s
-			serverMemoryBuffer.Unlock()
+			serverCachePut(s, generation)
 			return s, e
 		}
+		log.Println("Error querying server", e)
+		return Server{}, e
 	}
 	// normal flow of querying a row
+	serverCachePut(s, generation)
 	return
 }
 
 func serverScan(row *sql.Row, s *Server) error {
-	return row.Scan(&s.Id, &s.GuildUid, &s.WelcomeMessage, &s.RuleAgreement, &s.VeteranRank, &s.VeteranRole, &s.BotChannel, &s.Enabled,
-		&s.WelcomeChannel, &s.StarterRole, &s.BaseRole)
+	return row.Scan(&s.Id, &s.GuildUid, &s.WelcomeMessage, &s.RuleAgreement, &s.BotChannel, &s.Enabled,
+		&s.WelcomeChannel, &s.StarterRole, &s.BaseRole, &s.RuleAgreementReply, &s.WelcomeTitle, &s.WelcomeColor, &s.WelcomeImage,
+		&s.GoodbyeMessage, &s.GoodbyeChannel, &s.LeaverPolicy, &s.LeaverPurgeDays,
+		&s.RuleMessage, &s.RuleMessageChannel, &s.VerifyTimeout, &s.VerifyTimeoutAction, &s.VerifyMode, &s.VeteranMessagePoints,
+		&s.VeteranReactionPoints, &s.VeteranMessageCooldown, &s.VeteranReactionCooldown, &s.VeteranIgnoredPrefixes, &s.VeteranMinLength,
+		&s.VeteranDailyCap, &s.VeteranChannels, &s.DecayPercent, &s.DecayFloor, &s.DecayDemote,
+		&s.VeteranVoicePoints, &s.VeteranVoiceDailyCap)
 }
 
 func ServerSprint(s Server) (out string) {
@@ -148,6 +249,84 @@ func ServerSprint(s Server) (out string) {
 			buf.WriteString("{!!! MISCONFIG !!!: `Rule agreement found but no base role set`}")
 		}
 	}
+	if s.RuleAgreementReply.Valid {
+		buf.WriteString("{RuleAgreementReply: `")
+		if len(s.RuleAgreementReply.String) > 25 {
+			buf.WriteString(s.RuleAgreementReply.String[0:25])
+			buf.WriteString("...")
+		} else {
+			buf.WriteString(s.RuleAgreementReply.String)
+		}
+		buf.WriteString("`}")
+	}
+	if s.WelcomeTitle.Valid {
+		buf.WriteString("{WelcomeTitle: `")
+		buf.WriteString(s.WelcomeTitle.String)
+		buf.WriteString("`}")
+	}
+	if s.WelcomeColor.Valid {
+		buf.WriteString("{WelcomeColor: `")
+		buf.WriteString(fmt.Sprintf("#%06X", s.WelcomeColor.Int64))
+		buf.WriteString("`}")
+	}
+	if s.WelcomeImage.Valid {
+		buf.WriteString("{WelcomeImage: `")
+		buf.WriteString(s.WelcomeImage.String)
+		buf.WriteString("`}")
+	}
+	if s.GoodbyeMessage.Valid {
+		buf.WriteString("{GoodbyeMessage: `")
+		if len(s.GoodbyeMessage.String) > 25 {
+			buf.WriteString(s.GoodbyeMessage.String[0:25])
+			buf.WriteString("...")
+		} else {
+			buf.WriteString(s.GoodbyeMessage.String)
+		}
+		buf.WriteString("`}")
+	}
+	if s.GoodbyeChannel.Valid {
+		buf.WriteString("{GoodbyeChannel: `")
+		buf.WriteString(s.GoodbyeChannel.String)
+		buf.WriteString("`}")
+	}
+	buf.WriteString("{LeaverPolicy: `")
+	buf.WriteString(GetStringFromLeaverPolicy(s.LeaverPolicy))
+	if s.LeaverPolicy == LeaverPolicyPurge {
+		if s.LeaverPurgeDays.Valid {
+			buf.WriteString(" after " + strconv.Itoa(int(s.LeaverPurgeDays.Int64)) + " days")
+		} else {
+			buf.WriteString("`}{!!! MISCONFIG !!!: `purge policy but no LeaverPurgeDays set")
+		}
+	}
+	buf.WriteString("`}")
+	if s.VerifyMode != VerifyModeRules {
+		buf.WriteString("{VerifyMode: `")
+		buf.WriteString(GetStringFromVerifyMode(s.VerifyMode))
+		buf.WriteString("`}")
+		if !s.StarterRole.Valid || !s.BaseRole.Valid {
+			buf.WriteString("{!!! MISCONFIG !!!: `Captcha verification needs a starter and base role set`}")
+		}
+	}
+	if s.RuleMessage.Valid {
+		buf.WriteString("{RuleMessage: `")
+		buf.WriteString(s.RuleMessage.String)
+		buf.WriteString("` in `")
+		buf.WriteString(s.RuleMessageChannel.String)
+		buf.WriteString("`}")
+		if !s.StarterRole.Valid || !s.BaseRole.Valid {
+			buf.WriteString("{!!! MISCONFIG !!!: `Rule message found but no starter or base role set`}")
+		}
+	}
+	if s.VerifyTimeout.Valid {
+		buf.WriteString("{VerifyTimeout: `")
+		buf.WriteString(GetStringFromVerifyTimeoutAction(s.VerifyTimeoutAction))
+		buf.WriteString(" after ")
+		buf.WriteString(strconv.Itoa(int(s.VerifyTimeout.Int64)))
+		buf.WriteString(" hours`}")
+		if !s.StarterRole.Valid {
+			buf.WriteString("{!!! MISCONFIG !!!: `Verify timeout found but no starter role set`}")
+		}
+	}
 	if s.BotChannel.Valid {
 		buf.WriteString("{BotChannel: `")
 		buf.WriteString(s.BotChannel.String)
@@ -168,38 +347,57 @@ func ServerSprint(s Server) (out string) {
 		buf.WriteString(strconv.FormatBool(s.Enabled))
 		buf.WriteString("`}")
 	}
-	if s.VeteranRank.Valid {
-		buf.WriteString("{VeteranRank: `")
-		buf.WriteString(strconv.Itoa(int(s.VeteranRank.Int64)))
-		buf.WriteString("`}")
-		if !s.VeteranRole.Valid {
-			buf.WriteString("{!!! MISCONFIG !!!: `veteran rank provided but no role provided!`}")
+	veteranInts := []struct {
+		name  string
+		value sql.NullInt64
+	}{
+		{"VeteranMessagePoints", s.VeteranMessagePoints},
+		{"VeteranReactionPoints", s.VeteranReactionPoints},
+		{"VeteranMessageCooldown", s.VeteranMessageCooldown},
+		{"VeteranReactionCooldown", s.VeteranReactionCooldown},
+		{"VeteranMinLength", s.VeteranMinLength},
+		{"VeteranDailyCap", s.VeteranDailyCap},
+		{"VeteranVoicePoints", s.VeteranVoicePoints},
+		{"VeteranVoiceDailyCap", s.VeteranVoiceDailyCap},
+	}
+	for _, v := range veteranInts {
+		if v.value.Valid {
+			buf.WriteString("{" + v.name + ": `")
+			buf.WriteString(strconv.Itoa(int(v.value.Int64)))
+			buf.WriteString("`}")
 		}
 	}
-	if s.VeteranRole.Valid {
-		buf.WriteString("{VeteranRole: `")
-		buf.WriteString(s.VeteranRole.String)
+	if s.VeteranIgnoredPrefixes.Valid {
+		buf.WriteString("{VeteranIgnoredPrefixes: `")
+		buf.WriteString(s.VeteranIgnoredPrefixes.String)
+		buf.WriteString("`}")
+	}
+	if s.VeteranChannels.Valid {
+		buf.WriteString("{VeteranChannels: `")
+		buf.WriteString(s.VeteranChannels.String)
 		buf.WriteString("`}")
-		if !s.VeteranRank.Valid {
-			buf.WriteString("{!!! MISCONFIG !!!: `veteran role provided but no rank provided!`}")
+	}
+	if s.DecayPercent.Valid {
+		buf.WriteString("{Decay: `")
+		buf.WriteString(strconv.Itoa(int(s.DecayPercent.Int64)))
+		buf.WriteString("% per inactive week, floor of ")
+		buf.WriteString(strconv.Itoa(int(s.DecayFloor.Int64)))
+		if s.DecayDemote {
+			buf.WriteString(", demotes")
 		}
+		buf.WriteString("`}")
 	}
 	return buf.String()
 }
 
-func FlushServerCache() {
-	serverMemoryBuffer.Lock()
-	defer serverMemoryBuffer.Unlock()
-	serverMemoryBuffer.m = make(map[string]Server)
-}
-
-func ServerFullUpdate(s Server) (err error) {
-	_, err = moeDb.Exec(serverUpdate, s.Id, s.WelcomeMessage, s.RuleAgreement, s.VeteranRank, s.VeteranRole, s.BotChannel, s.Enabled,
-		s.StarterRole, s.BaseRole, s.WelcomeChannel)
-	if err != nil {
-		log.Println("There was an error updating the server table", err)
-	}
-	return
+func serverUpdateParams(s Server) []interface{} {
+	return []interface{}{s.Id, s.WelcomeMessage, s.RuleAgreement, s.BotChannel, s.Enabled,
+		s.StarterRole, s.BaseRole, s.WelcomeChannel, s.RuleAgreementReply, s.WelcomeTitle, s.WelcomeColor, s.WelcomeImage,
+		s.GoodbyeMessage, s.GoodbyeChannel, s.LeaverPolicy, s.LeaverPurgeDays,
+		s.RuleMessage, s.RuleMessageChannel, s.VerifyTimeout, s.VerifyTimeoutAction, s.VerifyMode, s.VeteranMessagePoints,
+		s.VeteranReactionPoints, s.VeteranMessageCooldown, s.VeteranReactionCooldown, s.VeteranIgnoredPrefixes, s.VeteranMinLength,
+		s.VeteranDailyCap, s.VeteranChannels, s.DecayPercent, s.DecayFloor, s.DecayDemote,
+		s.VeteranVoicePoints, s.VeteranVoiceDailyCap}
 }
 
 func serverCreateTable() {
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// How long a server stays cached before being read from the database again, in case something changed it outside of moebot
+	serverCacheTTL = 15 * time.Minute
+	// How often cache hit/miss counts get written to the metric table
+	serverCacheMetricInterval = time.Hour
+)
+
+/*
+Counts of how the server cache has been used since the last time they were recorded to the metric table
+*/
+type ServerCacheStats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Expired       int64 `json:"expired"`
+	Invalidations int64 `json:"invalidations"`
+	Size          int   `json:"size"`
+}
+
+type serverCacheEntry struct {
+	server    Server
+	expiresAt time.Time
+}
+
+var (
+	serverCache = struct {
+		sync.RWMutex
+		entries map[string]serverCacheEntry
+		// bumped on every invalidation, so a read that raced with an update doesn't put the old row back in the cache
+		generations map[string]int
+	}{entries: make(map[string]serverCacheEntry), generations: make(map[string]int)}
+
+	serverCacheHits          int64
+	serverCacheMisses        int64
+	serverCacheExpired       int64
+	serverCacheInvalidations int64
+)
+
+/*
+Gets a server from the cache. When it's not there, the returned generation should be passed to serverCachePut once the server has been
+read from the database
+*/
+func serverCacheGet(guildUid string) (s Server, generation int, ok bool) {
+	serverCache.RLock()
+	entry, found := serverCache.entries[guildUid]
+	generation = serverCache.generations[guildUid]
+	serverCache.RUnlock()
+	if !found {
+		atomic.AddInt64(&serverCacheMisses, 1)
+		return
+	}
+	if time.Now().After(entry.expiresAt) {
+		atomic.AddInt64(&serverCacheExpired, 1)
+		atomic.AddInt64(&serverCacheMisses, 1)
+		return
+	}
+	atomic.AddInt64(&serverCacheHits, 1)
+	return entry.server, generation, true
+}
+
+/*
+Caches a server read from the database, unless it was invalidated since the read started
+*/
+func serverCachePut(s Server, generation int) {
+	serverCache.Lock()
+	defer serverCache.Unlock()
+	if serverCache.generations[s.GuildUid] != generation {
+		return
+	}
+	serverCache.entries[s.GuildUid] = serverCacheEntry{server: s, expiresAt: time.Now().Add(serverCacheTTL)}
+}
+
+/*
+Removes a single server from the cache, so the next query reads it from the database. Must be called after every write to the server table
+*/
+func serverCacheInvalidate(guildUid string) {
+	serverCache.Lock()
+	defer serverCache.Unlock()
+	delete(serverCache.entries, guildUid)
+	serverCache.generations[guildUid]++
+	atomic.AddInt64(&serverCacheInvalidations, 1)
+}
+
+/*
+Periodically writes the cache counts to the metric table and starts counting again
+*/
+func serverCacheRecordMetrics() {
+	for range time.Tick(serverCacheMetricInterval) {
+		serverCache.RLock()
+		size := len(serverCache.entries)
+		serverCache.RUnlock()
+		stats := ServerCacheStats{
+			Hits:          atomic.SwapInt64(&serverCacheHits, 0),
+			Misses:        atomic.SwapInt64(&serverCacheMisses, 0),
+			Expired:       atomic.SwapInt64(&serverCacheExpired, 0),
+			Invalidations: atomic.SwapInt64(&serverCacheInvalidations, 0),
+			Size:          size,
+		}
+		MetricInsertServerCache(stats)
+	}
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+/*
+LeftAt isn't part of Server since it's not configuration. It's set when moebot is removed from a guild, and cleared if moebot is invited back
+before the server's data is purged
+*/
+const (
+	serverQueryLeftAt       = `SELECT LeftAt FROM server WHERE GuildUid = $1`
+	serverSetLeftAt         = `UPDATE server SET LeftAt = $2 WHERE GuildUid = $1`
+	serverQueryActiveGuilds = `SELECT GuildUid FROM server WHERE LeftAt IS NULL`
+	serverQueryPurgeable    = `SELECT Id, GuildUid FROM server WHERE LeftAt < $1`
+	serverQueryDecayGuilds  = `SELECT GuildUid FROM server WHERE LeftAt IS NULL AND DecayPercent IS NOT NULL`
+)
+
+// everything stored for a guild, deleted in order. Roles, channels, polls, ranks and versions cascade from the server row
+var serverPurgeStatements = []string{
+	`DELETE FROM role_group WHERE ServerId = $1`,
+	`DELETE FROM server WHERE Id = $1`,
+}
+
+var serverPurgeGuildStatements = []string{
+	`DELETE FROM raffle_entry WHERE GuildUid = $1`,
+	`DELETE FROM member_event WHERE GuildUid = $1`,
+	`DELETE FROM verify_reminder WHERE GuildUid = $1`,
+	`DELETE FROM captcha WHERE GuildUid = $1`,
+}
+
+/*
+Gets when moebot left the given guild. LeftAt won't be valid if moebot is still in the guild, and sql.ErrNoRows is returned if moebot has
+never seen the guild
+*/
+func ServerQueryLeftAt(guildUid string) (leftAt pq.NullTime, err error) {
+	err = moeDb.QueryRow(serverQueryLeftAt, guildUid).Scan(&leftAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error querying when moebot left a server", err)
+	}
+	return
+}
+
+/*
+Marks a guild as left now, or as active again if left is false
+*/
+func ServerSetLeft(guildUid string, left bool) error {
+	var leftAt pq.NullTime
+	if left {
+		leftAt = pq.NullTime{Time: time.Now(), Valid: true}
+	}
+	_, err := moeDb.Exec(serverSetLeftAt, guildUid, leftAt)
+	if err != nil {
+		log.Println("Error updating when moebot left a server", err)
+	}
+	return err
+}
+
+/*
+Gets every guild moebot thinks it's still in
+*/
+func ServerQueryActiveGuilds() (guildUids []string, err error) {
+	rows, err := moeDb.Query(serverQueryActiveGuilds)
+	if err != nil {
+		log.Println("Error querying active servers", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var guildUid string
+		if err = rows.Scan(&guildUid); err != nil {
+			log.Println("Error scanning active server", err)
+			return
+		}
+		guildUids = append(guildUids, guildUid)
+	}
+	return
+}
+
+/*
+Gets every guild moebot is still in that has rank decay turned on
+*/
+func ServerQueryDecayGuilds() (guildUids []string, err error) {
+	rows, err := moeDb.Query(serverQueryDecayGuilds)
+	if err != nil {
+		log.Println("Error querying decaying servers", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var guildUid string
+		if err = rows.Scan(&guildUid); err != nil {
+			log.Println("Error scanning decaying server", err)
+			return
+		}
+		guildUids = append(guildUids, guildUid)
+	}
+	return
+}
+
+/*
+Gets every server moebot left before the given time. Only Id and GuildUid are loaded
+*/
+func ServerQueryPurgeable(leftBefore time.Time) (servers []Server, err error) {
+	rows, err := moeDb.Query(serverQueryPurgeable, leftBefore)
+	if err != nil {
+		log.Println("Error querying purgeable servers", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s Server
+		if err = rows.Scan(&s.Id, &s.GuildUid); err != nil {
+			log.Println("Error scanning purgeable server", err)
+			return
+		}
+		servers = append(servers, s)
+	}
+	return
+}
+
+/*
+Deletes everything moebot has stored for a server, all or nothing
+*/
+func ServerPurge(s Server) (err error) {
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning server purge transaction", err)
+		return
+	}
+	for _, statement := range serverPurgeStatements {
+		if _, err = tx.Exec(statement, s.Id); err != nil {
+			log.Println("Error purging server "+s.GuildUid, err)
+			tx.Rollback()
+			return
+		}
+	}
+	for _, statement := range serverPurgeGuildStatements {
+		if _, err = tx.Exec(statement, s.GuildUid); err != nil {
+			log.Println("Error purging server "+s.GuildUid, err)
+			tx.Rollback()
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing server purge", err)
+		return
+	}
+	serverCacheInvalidate(s.GuildUid)
+	rankTierCacheInvalidate(s.Id)
+	return
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+)
+
+/*
+A snapshot of a server's configuration, taken every time the configuration changes
+*/
+type ServerVersion struct {
+	Id        int
+	ServerId  int
+	Version   int
+	ActorUid  sql.NullString // Who made the change. Null when moebot changed it on its own
+	Change    string
+	CreatedAt time.Time
+	Snapshot  Server
+}
+
+const (
+	serverVersionTable = `CREATE TABLE IF NOT EXISTS server_version(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		ServerId INTEGER NOT NULL REFERENCES server(Id) ON DELETE CASCADE,
+		Version INTEGER NOT NULL,
+		ActorUid VARCHAR(20),
+		Change VARCHAR(200) NOT NULL,
+		CreatedAt TIMESTAMP NOT NULL DEFAULT now(),
+		Snapshot TEXT NOT NULL,
+		UNIQUE (ServerId, Version)
+	)`
+
+	ServerVersionMaxChangeLength = 200
+
+	serverLockRow         = `SELECT Id, ` + serverColumnNames + ` FROM server WHERE Id = $1 FOR UPDATE`
+	serverVersionLatest   = `SELECT COALESCE(MAX(Version), 0) FROM server_version WHERE ServerId = $1`
+	serverVersionInsert   = `INSERT INTO server_version(ServerId, Version, ActorUid, Change, Snapshot) VALUES ($1, $2, $3, $4, $5)`
+	serverVersionQuery    = `SELECT Id, ServerId, Version, ActorUid, Change, CreatedAt, Snapshot FROM server_version WHERE ServerId = $1 AND Version = $2`
+	serverVersionQueryAll = `SELECT Id, ServerId, Version, ActorUid, Change, CreatedAt FROM server_version WHERE ServerId = $1
+		ORDER BY Version DESC LIMIT $2`
+)
+
+/*
+Updates the server row and stores a snapshot of the new configuration, all or nothing. The very first change also snapshots the configuration
+from before it, so the first change can be rolled back too
+*/
+func ServerFullUpdate(s Server, actorUid string, change string) (err error) {
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning server update transaction", err)
+		return
+	}
+	if _, err = serverUpdateVersionedTx(tx, s, actorUid, change); err != nil {
+		tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing server update", err)
+		return
+	}
+	serverCacheInvalidate(s.GuildUid)
+	return
+}
+
+/*
+Restores the server to the configuration stored in the given version. The rollback itself is stored as a new version
+*/
+func ServerRollback(serverId int, version int, actorUid string) (s Server, err error) {
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning server rollback transaction", err)
+		return
+	}
+	target, err := serverVersionScan(tx.QueryRow(serverVersionQuery, serverId, version), serverId)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	s = target.Snapshot
+	if _, err = serverUpdateVersionedTx(tx, s, actorUid, "rollback to v"+strconv.Itoa(version)); err != nil {
+		tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing server rollback", err)
+		return
+	}
+	serverCacheInvalidate(s.GuildUid)
+	return
+}
+
+func ServerVersionQuery(serverId int, version int) (ServerVersion, error) {
+	return serverVersionScan(moeDb.QueryRow(serverVersionQuery, serverId, version), serverId)
+}
+
+/*
+Gets the most recent versions of a server's configuration, newest first. Snapshots aren't loaded
+*/
+func ServerVersionQueryAll(serverId int, limit int) (versions []ServerVersion, err error) {
+	rows, err := moeDb.Query(serverVersionQueryAll, serverId, limit)
+	if err != nil {
+		log.Println("Error querying server versions", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v ServerVersion
+		if err = rows.Scan(&v.Id, &v.ServerId, &v.Version, &v.ActorUid, &v.Change, &v.CreatedAt); err != nil {
+			log.Println("Error scanning server version", err)
+			return
+		}
+		versions = append(versions, v)
+	}
+	return
+}
+
+func serverVersionScan(row *sql.Row, serverId int) (v ServerVersion, err error) {
+	var snapshot string
+	err = row.Scan(&v.Id, &v.ServerId, &v.Version, &v.ActorUid, &v.Change, &v.CreatedAt, &snapshot)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Error querying server version", err)
+		}
+		return
+	}
+	if err = json.Unmarshal([]byte(snapshot), &v.Snapshot); err != nil {
+		log.Println("Error reading server version snapshot", err)
+		return
+	}
+	// the ID never changes, so don't trust the snapshot's copy of it
+	v.Snapshot.Id = serverId
+	return
+}
+
+func serverUpdateVersionedTx(tx *sql.Tx, s Server, actorUid string, change string) (version int, err error) {
+	var current Server
+	if err = serverScan(tx.QueryRow(serverLockRow, s.Id), &current); err != nil {
+		log.Println("Error locking server row for update", err)
+		return
+	}
+	if err = tx.QueryRow(serverVersionLatest, s.Id).Scan(&version); err != nil {
+		log.Println("Error querying latest server version", err)
+		return
+	}
+	if version == 0 {
+		// first change we've seen, keep what was there before it
+		version++
+		if err = serverVersionInsertTx(tx, current, version, "", "initial configuration"); err != nil {
+			return
+		}
+	}
+	s.GuildUid = current.GuildUid
+	if _, err = tx.Exec(serverUpdate, serverUpdateParams(s)...); err != nil {
+		log.Println("There was an error updating the server table", err)
+		return
+	}
+	version++
+	err = serverVersionInsertTx(tx, s, version, actorUid, change)
+	return
+}
+
+func serverVersionInsertTx(tx *sql.Tx, s Server, version int, actorUid string, change string) error {
+	snapshot, err := json.Marshal(s)
+	if err != nil {
+		log.Println("Error serializing server snapshot", err)
+		return err
+	}
+	var actor sql.NullString
+	if actorUid != "" {
+		actor.Scan(actorUid)
+	}
+	if len(change) > ServerVersionMaxChangeLength {
+		change = change[:ServerVersionMaxChangeLength]
+	}
+	_, err = tx.Exec(serverVersionInsert, s.Id, version, actor, change, string(snapshot))
+	if err != nil {
+		log.Println("Error inserting server version", err)
+	}
+	return err
+}
+
+func serverVersionCreateTable() {
+	_, err := moeDb.Exec(serverVersionTable)
+	if err != nil {
+		log.Println("Error creating server version table", err)
+		return
+	}
+}
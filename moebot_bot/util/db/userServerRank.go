@@ -3,23 +3,48 @@ package db
 import (
 	"database/sql"
 	"log"
-	"strconv"
-	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type UserServerRank struct {
-	Id          int
-	ServerId    int
-	UserId      int
-	Rank        int
-	MessageSent bool
+	Id       int
+	ServerId int
+	UserId   int
+	Rank     int
+	// Threshold of the highest rank tier the user has been promoted to, so each tier is only announced once
+	TierThreshold int
 }
 
 type UserServerRankWrapper struct {
 	UserUid   string
 	ServerUid string
 	Rank      int
-	SendTo    string
+	// Tiers the user just reached, lowest first
+	Tiers []RankTier
+}
+
+/*
+Points to add to a user's rank in a server
+*/
+type UserServerRankChange struct {
+	ServerId int
+	UserId   int
+	Points   int
+}
+
+/*
+A member who's been inactive long enough for their points to decay
+*/
+type UserServerRankDecay struct {
+	Id            int
+	UserId        int
+	UserUid       string
+	Rank          int
+	TierThreshold int
+	// Whether they've already been warned that their next decay demotes them
+	DecayWarned bool
 }
 
 const (
@@ -28,70 +53,349 @@ const (
 		ServerId INTEGER NOT NULL REFERENCES server(id) ON DELETE CASCADE,
 		UserId INTEGER NOT NULL REFERENCES user_profile(id) ON DELETE CASCADE,
 		Rank INTEGER NOT NULL DEFAULT 0,
-		MessageSent BOOLEAN NOT NULL DEFAULT false
+		Frozen BOOLEAN NOT NULL DEFAULT false,
+		TierThreshold INTEGER NOT NULL DEFAULT 0,
+		LastActive TIMESTAMP NOT NULL DEFAULT now(),
+		LastDecay TIMESTAMP,
+		DecayWarned BOOLEAN NOT NULL DEFAULT false
 	)`
 
-	userServerRankQuery = `SELECT user_server_rank.Id, user_server_rank.ServerId, user_server_rank.UserId, user_server_rank.Rank, user_server_rank.MessageSent FROM user_server_rank
+	userServerRankQuery = `SELECT user_server_rank.Id, user_server_rank.ServerId, user_server_rank.UserId, user_server_rank.Rank, user_server_rank.TierThreshold
+		FROM user_server_rank
 		JOIN server ON server.Id = user_server_rank.ServerId
 		JOIN user_profile ON user_profile.Id = user_server_rank.UserId
 		WHERE server.GuildUid = $1 AND user_profile.UserUid = $2`
-	userServerRankQueryId       = `SELECT Id, Rank, MessageSent FROM user_server_rank WHERE ServerId = $1 AND UserId = $2`
-	userServerRankUpdate        = `UPDATE user_server_rank SET Rank = Rank + $2 WHERE Id = $1 RETURNING user_server_rank.Id, user_server_rank.Rank, user_server_rank.MessageSent`
-	userServerRankInsert        = `INSERT INTO user_server_rank(ServerId, UserId, Rank) VALUES ($1, $2, $3) RETURNING user_server_rank.Id, user_server_rank.Rank, user_server_rank.MessageSent`
-	userServerRankUpdateMessage = `UPDATE user_server_rank SET MessageSent = true WHERE Id = ANY ($1::integer[])`
+	userServerRankQueryServer = `SELECT user_profile.UserUid, user_server_rank.Rank FROM user_server_rank
+		JOIN server ON server.Id = user_server_rank.ServerId
+		JOIN user_profile ON user_profile.Id = user_server_rank.UserId
+		WHERE server.GuildUid = $1 AND NOT user_server_rank.Frozen`
+	// adds to everyone who already has a rank, then inserts the rest, all in one statement
+	userServerRankAddBatch = `WITH change AS (
+			SELECT * FROM unnest($1::INTEGER[], $2::INTEGER[], $3::INTEGER[]) AS change(ServerId, UserId, Points)
+		), updated AS (
+			UPDATE user_server_rank SET Rank = user_server_rank.Rank + change.Points, LastActive = now(), DecayWarned = false
+			FROM change WHERE user_server_rank.ServerId = change.ServerId AND user_server_rank.UserId = change.UserId
+			RETURNING user_server_rank.Id, user_server_rank.ServerId, user_server_rank.UserId, user_server_rank.Rank, user_server_rank.TierThreshold
+		), inserted AS (
+			INSERT INTO user_server_rank(ServerId, UserId, Rank)
+			SELECT change.ServerId, change.UserId, change.Points FROM change
+			WHERE NOT EXISTS (SELECT 1 FROM updated WHERE updated.ServerId = change.ServerId AND updated.UserId = change.UserId)
+			RETURNING user_server_rank.Id, user_server_rank.ServerId, user_server_rank.UserId, user_server_rank.Rank, user_server_rank.TierThreshold
+		)
+		SELECT * FROM updated UNION ALL SELECT * FROM inserted`
+	userServerRankUpdateTier = `UPDATE user_server_rank SET TierThreshold = $2 WHERE Id = $1`
+
+	// adjustments lock the row so two mods changing the same member at once can't lose either change
+	userServerRankLock   = `SELECT Id, ServerId, UserId, Rank, TierThreshold FROM user_server_rank WHERE ServerId = $1 AND UserId = $2 FOR UPDATE`
+	userServerRankCreate = `INSERT INTO user_server_rank(ServerId, UserId) VALUES ($1, $2) RETURNING Id, ServerId, UserId, Rank, TierThreshold`
+	userServerRankSet    = `UPDATE user_server_rank SET Rank = $2 WHERE Id = $1`
+
+	// members only decay once per inactive week, so the last decay counts the same as their last activity
+	userServerRankQueryInactive = `SELECT user_server_rank.Id, user_server_rank.UserId, user_profile.UserUid, user_server_rank.Rank,
+		user_server_rank.TierThreshold, user_server_rank.DecayWarned
+		FROM user_server_rank
+		JOIN user_profile ON user_profile.Id = user_server_rank.UserId
+		WHERE user_server_rank.ServerId = $1 AND NOT user_server_rank.Frozen AND user_server_rank.Rank > $2 AND user_server_rank.LastActive < $3
+		AND (user_server_rank.LastDecay IS NULL OR user_server_rank.LastDecay < $3)
+		ORDER BY user_server_rank.Rank DESC`
+	// LastActive is checked again in case they did something since they were loaded
+	userServerRankDecay = `UPDATE user_server_rank SET Rank = $2, TierThreshold = $3, LastDecay = now(), DecayWarned = false
+		WHERE Id = $1 AND LastActive < $4`
+	userServerRankDecayWarned = `UPDATE user_server_rank SET LastDecay = now(), DecayWarned = true WHERE Id = $1 AND LastActive < $2`
 )
 
+// the leaderboard sorts by rank, and points get looked up by server and user all the time
+var userServerRankIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS user_server_rank_server_rank_idx ON user_server_rank(ServerId, Rank DESC)`,
+	`CREATE INDEX IF NOT EXISTS user_server_rank_server_user_idx ON user_server_rank(ServerId, UserId)`,
+}
+
+var userServerRankUpdateTable = []string{
+	`ALTER TABLE user_server_rank ADD COLUMN IF NOT EXISTS Frozen BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE user_server_rank ADD COLUMN IF NOT EXISTS TierThreshold INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE user_server_rank ADD COLUMN IF NOT EXISTS LastActive TIMESTAMP NOT NULL DEFAULT now()`,
+	`ALTER TABLE user_server_rank ADD COLUMN IF NOT EXISTS LastDecay TIMESTAMP`,
+	`ALTER TABLE user_server_rank ADD COLUMN IF NOT EXISTS DecayWarned BOOLEAN NOT NULL DEFAULT false`,
+}
+
 func UserServerRankQuery(userUid string, guildUid string) (usr *UserServerRank, err error) {
 	row := moeDb.QueryRow(userServerRankQuery, guildUid, userUid)
 	u := UserServerRank{}
-	err = row.Scan(&u.Id, &u.ServerId, &u.UserId, &u.Rank, &u.MessageSent)
+	err = row.Scan(&u.Id, &u.ServerId, &u.UserId, &u.Rank, &u.TierThreshold)
 	return &u, err
 }
 
-func UserServerRankUpdateOrInsert(userId int, serverId int, points int) (id int, newPoint int, messageSent bool, err error) {
-	u := UserServerRank{
-		ServerId: serverId,
-		UserId:   userId,
-	}
-	row := moeDb.QueryRow(userServerRankQueryId, u.ServerId, u.UserId)
-	if err = row.Scan(&u.Id, &u.Rank, &u.MessageSent); err != nil {
-		if err == sql.ErrNoRows {
-			// no row, so insert it
-			err = moeDb.QueryRow(userServerRankInsert, serverId, userId, points).Scan(&id, &newPoint, &messageSent)
-			if err != nil {
-				log.Println("Error inserting userServerRank to db ", err)
-				return
-			}
+/*
+Gets the rank of every ranked user in a guild, keyed by user UID
+*/
+func UserServerRankQueryServer(guildUid string) (ranks map[string]int, err error) {
+	rows, err := moeDb.Query(userServerRankQueryServer, guildUid)
+	if err != nil {
+		log.Println("Error querying for server ranks", err)
+		return
+	}
+	defer rows.Close()
+	ranks = make(map[string]int)
+	for rows.Next() {
+		var userUid string
+		var rank int
+		if err = rows.Scan(&userUid, &rank); err != nil {
+			log.Println("Error scanning from user server rank table:", err)
 			return
 		}
-	} else {
-		// already have a row, update it
-		err = moeDb.QueryRow(userServerRankUpdate, u.Id, points).Scan(&id, &newPoint, &messageSent)
-		if err != nil {
-			log.Println("Error updating userServerRank", err)
+		ranks[userUid] = rank
+	}
+	return
+}
+
+/*
+Adds points to many users' ranks at once, returning their new ranks. The points are recorded in the rank history as well. Each server
+and user should only have one change
+*/
+func UserServerRankAddBatch(changes []UserServerRankChange) (ranks []UserServerRank, err error) {
+	serverIds := make([]int64, len(changes))
+	userIds := make([]int64, len(changes))
+	points := make([]int64, len(changes))
+	for i, c := range changes {
+		serverIds[i] = int64(c.ServerId)
+		userIds[i] = int64(c.UserId)
+		points[i] = int64(c.Points)
+	}
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning user server rank transaction", err)
+		return
+	}
+	rows, err := tx.Query(userServerRankAddBatch, pq.Array(serverIds), pq.Array(userIds), pq.Array(points))
+	if err != nil {
+		log.Println("Error adding user server ranks", err)
+		tx.Rollback()
+		return
+	}
+	for rows.Next() {
+		var u UserServerRank
+		if err = rows.Scan(&u.Id, &u.ServerId, &u.UserId, &u.Rank, &u.TierThreshold); err != nil {
+			log.Println("Error scanning added user server rank", err)
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		ranks = append(ranks, u)
+	}
+	rows.Close()
+	if err = rankEventInsertBatchTx(tx, serverIds, userIds, points, RankEventActivity); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing user server rank batch", err)
+		return nil, err
+	}
+	return
+}
+
+/*
+Changes a user's points on a mod's behalf, recording who did it and why. The points are added, or replace the user's points when set is
+true. Points never go below 0. Returns the user's points before and after
+*/
+func UserServerRankAdjust(serverId int, userId int, points int, set bool, actorId int, reason string) (previous int, u UserServerRank, err error) {
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning rank adjustment transaction", err)
+		return
+	}
+	if u, err = userServerRankLockTx(tx, serverId, userId); err != nil {
+		tx.Rollback()
+		return
+	}
+	previous = u.Rank
+	newRank := points
+	if !set {
+		newRank += u.Rank
+	}
+	if newRank < 0 {
+		newRank = 0
+	}
+	if err = userServerRankSetTx(tx, &u, newRank, actorId, reason); err != nil {
+		tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing rank adjustment", err)
+	}
+	return
+}
+
+/*
+Moves points from one user to another on a mod's behalf. Nothing changes and transferred is false if the first user doesn't have enough
+points
+*/
+func UserServerRankTransfer(serverId int, fromId int, toId int, points int, actorId int, reason string) (from UserServerRank, to UserServerRank,
+	transferred bool, err error) {
+
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning rank transfer transaction", err)
+		return
+	}
+	// always lock in the same order, so two opposite transfers can't deadlock
+	first, second := fromId, toId
+	if toId < fromId {
+		first, second = toId, fromId
+	}
+	locked := make(map[int]UserServerRank)
+	for _, userId := range []int{first, second} {
+		var u UserServerRank
+		if u, err = userServerRankLockTx(tx, serverId, userId); err != nil {
+			tx.Rollback()
 			return
 		}
+		locked[userId] = u
+	}
+	from, to = locked[fromId], locked[toId]
+	if from.Rank < points {
+		tx.Rollback()
+		return from, to, false, nil
 	}
-	return u.Id, u.Rank, u.MessageSent, nil
+	if err = userServerRankSetTx(tx, &from, from.Rank-points, actorId, reason); err != nil {
+		tx.Rollback()
+		return
+	}
+	if err = userServerRankSetTx(tx, &to, to.Rank+points, actorId, reason); err != nil {
+		tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing rank transfer", err)
+		return
+	}
+	return from, to, true, nil
+}
+
+/*
+Locks a user's rank in a server for the rest of the transaction, creating it if they don't have one yet
+*/
+func userServerRankLockTx(tx *sql.Tx, serverId int, userId int) (u UserServerRank, err error) {
+	err = tx.QueryRow(userServerRankLock, serverId, userId).Scan(&u.Id, &u.ServerId, &u.UserId, &u.Rank, &u.TierThreshold)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(userServerRankCreate, serverId, userId).Scan(&u.Id, &u.ServerId, &u.UserId, &u.Rank, &u.TierThreshold)
+	}
+	if err != nil {
+		log.Println("Error locking user server rank", err)
+	}
+	return
 }
 
-func UserServerRankSetMessageSent(entries []int) (err error) {
-	ids := make([]string, len(entries))
-	for i, e := range entries {
-		ids[i] = strconv.Itoa(e)
+func userServerRankSetTx(tx *sql.Tx, u *UserServerRank, newRank int, actorId int, reason string) (err error) {
+	if newRank == u.Rank {
+		return
+	}
+	if _, err = tx.Exec(userServerRankSet, u.Id, newRank); err != nil {
+		log.Println("Error setting user server rank", err)
+		return
+	}
+	if err = rankEventInsertAdjustmentTx(tx, u.ServerId, u.UserId, newRank-u.Rank, actorId, reason); err != nil {
+		return
 	}
-	idCollection := "{" + strings.Join(ids, ",") + "}"
-	_, err = moeDb.Exec(userServerRankUpdateMessage, idCollection)
+	u.Rank = newRank
+	return
+}
+
+/*
+Records the highest tier a user has been promoted to
+*/
+func UserServerRankSetTier(id int, tierThreshold int) (err error) {
+	_, err = moeDb.Exec(userServerRankUpdateTier, id, tierThreshold)
 	if err != nil {
-		log.Println("Error updating many user server ranks", err)
+		log.Println("Error updating user server rank tier", err)
 	}
 	return
 }
 
+/*
+Gets every member of a server above the given floor who hasn't been active, or decayed, since the given time. Highest rank first
+*/
+func UserServerRankQueryInactive(serverId int, floor int, inactiveSince time.Time) (members []UserServerRankDecay, err error) {
+	rows, err := moeDb.Query(userServerRankQueryInactive, serverId, floor, inactiveSince)
+	if err != nil {
+		log.Println("Error querying inactive user server ranks", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m UserServerRankDecay
+		if err = rows.Scan(&m.Id, &m.UserId, &m.UserUid, &m.Rank, &m.TierThreshold, &m.DecayWarned); err != nil {
+			log.Println("Error scanning inactive user server rank", err)
+			return
+		}
+		members = append(members, m)
+	}
+	return
+}
+
+/*
+Lowers an inactive member's rank and tier, recording the points lost in the rank history. Returns false without changing anything if
+the member was active after inactiveSince
+*/
+func UserServerRankApplyDecay(m UserServerRankDecay, serverId int, newRank int, tierThreshold int, inactiveSince time.Time) (applied bool, err error) {
+	tx, err := moeDb.Begin()
+	if err != nil {
+		log.Println("Error beginning rank decay transaction", err)
+		return
+	}
+	result, err := tx.Exec(userServerRankDecay, m.Id, newRank, tierThreshold, inactiveSince)
+	if err != nil {
+		log.Println("Error decaying user server rank", err)
+		tx.Rollback()
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if err = rankEventInsertTx(tx, serverId, m.UserId, newRank-m.Rank, RankEventDecay); err != nil {
+		tx.Rollback()
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		log.Println("Error committing rank decay", err)
+		return
+	}
+	return true, nil
+}
+
+/*
+Records that a member was warned their next decay demotes them. The warning takes the place of this week's decay, so they get a week
+to come back before anything is lost
+*/
+func UserServerRankSetDecayWarned(id int, inactiveSince time.Time) (warned bool, err error) {
+	result, err := moeDb.Exec(userServerRankDecayWarned, id, inactiveSince)
+	if err != nil {
+		log.Println("Error marking user server rank as warned", err)
+		return
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
 func userServerRankCreateTable() {
 	_, err := moeDb.Exec(userServerRankTable)
 	if err != nil {
 		log.Println("Error creating user server rank table", err)
 		return
 	}
+	for _, alter := range userServerRankUpdateTable {
+		_, err = moeDb.Exec(alter)
+		if err != nil {
+			log.Println("Error altering user server rank table", err)
+			return
+		}
+	}
+	for _, index := range userServerRankIndexes {
+		_, err = moeDb.Exec(index)
+		if err != nil {
+			log.Println("Error creating user server rank index", err)
+			return
+		}
+	}
 }
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"log"
+	"strings"
+)
+
+/*
+What to do with members who haven't agreed to the rules after the server's VerifyTimeout
+*/
+type VerifyTimeoutAction int
+
+const (
+	VerifyTimeoutRemind VerifyTimeoutAction = 0
+	VerifyTimeoutKick   VerifyTimeoutAction = 1
+
+	OptionsForVerifyTimeoutAction = "remind, kick"
+)
+
+const (
+	verifyReminderTable = `CREATE TABLE IF NOT EXISTS verify_reminder(
+		Id SERIAL NOT NULL PRIMARY KEY,
+		GuildUid VARCHAR(20) NOT NULL,
+		UserUid VARCHAR(20) NOT NULL,
+		RemindedAt TIMESTAMP NOT NULL DEFAULT now(),
+		UNIQUE (GuildUid, UserUid)
+	)`
+
+	verifyReminderInsert = `INSERT INTO verify_reminder(GuildUid, UserUid) VALUES ($1, $2) ON CONFLICT (GuildUid, UserUid) DO NOTHING`
+	verifyReminderDelete = `DELETE FROM verify_reminder WHERE GuildUid = $1 AND UserUid = $2`
+)
+
+/*
+Records that a member was reminded to agree to the rules. Returns false if they were already reminded
+*/
+func VerifyReminderInsert(guildUid string, userUid string) (firstReminder bool, err error) {
+	result, err := moeDb.Exec(verifyReminderInsert, guildUid, userUid)
+	if err != nil {
+		log.Println("Error inserting verify reminder", err)
+		return false, err
+	}
+	rowCount, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error reading inserted verify reminder count", err)
+		return false, err
+	}
+	return rowCount > 0, nil
+}
+
+/*
+Forgets any reminder sent to a member, so they get reminded again if they ever need to agree to the rules again
+*/
+func VerifyReminderDelete(guildUid string, userUid string) error {
+	_, err := moeDb.Exec(verifyReminderDelete, guildUid, userUid)
+	if err != nil {
+		log.Println("Error deleting verify reminder", err)
+	}
+	return err
+}
+
+func GetVerifyTimeoutActionFromString(s string) VerifyTimeoutAction {
+	switch strings.ToUpper(s) {
+	case "REMIND":
+		return VerifyTimeoutRemind
+	case "KICK":
+		return VerifyTimeoutKick
+	default:
+		return -1
+	}
+}
+
+func GetStringFromVerifyTimeoutAction(action VerifyTimeoutAction) string {
+	switch action {
+	case VerifyTimeoutRemind:
+		return "remind"
+	case VerifyTimeoutKick:
+		return "kick"
+	default:
+		return "unknown"
+	}
+}
+
+func verifyReminderCreateTable() {
+	_, err := moeDb.Exec(verifyReminderTable)
+	if err != nil {
+		log.Println("Error creating verify reminder table", err)
+		return
+	}
+}
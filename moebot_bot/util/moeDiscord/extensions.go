@@ -43,3 +43,22 @@ func FindRoleById(roles []*discordgo.Role, toFind string) *discordgo.Role {
 	}
 	return nil
 }
+
+/*
+Gets every member of a guild, paging through discord's member list as needed
+*/
+func GetAllMembers(guildUid string, session *discordgo.Session) (members []*discordgo.Member, err error) {
+	const pageSize = 1000
+	afterId := ""
+	for {
+		page, err := session.GuildMembers(guildUid, afterId, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, page...)
+		if len(page) < pageSize {
+			return members, nil
+		}
+		afterId = page[len(page)-1].User.ID
+	}
+}
@@ -45,3 +45,18 @@ func GetMember(memberUid string, guildUid string, session *discordgo.Session) (m
 	// found a valid member in the state
 	return
 }
+
+/*
+Asks discord if someone is in a guild. The state is skipped since large guilds don't keep every member in it
+*/
+func IsGuildMember(memberUid string, guildUid string, session *discordgo.Session) (isMember bool, err error) {
+	_, err = session.GuildMember(guildUid, memberUid)
+	if restErr, ok := err.(*discordgo.RESTError); ok && restErr.Response != nil && restErr.Response.StatusCode == 404 {
+		return false, nil
+	}
+	if err != nil {
+		log.Println("Error checking member/guild: "+memberUid+"/"+guildUid, err)
+		return false, err
+	}
+	return true, nil
+}
@@ -97,6 +97,16 @@ func ExtractChannelIdFromString(message string) (id string, valid bool) {
 	return id, err == nil
 }
 
+/*
+Gets a user's ID from a mention, or from the ID on its own
+*/
+func ExtractUserIdFromString(message string) (id string, valid bool) {
+	// user mentions go with the format of <@1234567>, or <@!1234567> when they have a nickname
+	id = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(message, "<@"), "!"), ">")
+	_, err := strconv.ParseUint(id, 10, 64)
+	return id, err == nil
+}
+
 func MakeStringBold(s string) string {
 	return "**" + s + "**"
 }